@@ -4,18 +4,43 @@ import (
 	_ "embed"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/wk-y/rama-swap/server/scheduler"
 )
 
 type args struct {
-	Ramalama    []string
-	Port        *int
-	Host        *string
-	IdleTimeout *time.Duration
+	Ramalama     []string
+	LlamaServer  []string
+	ModelsDir    *string
+	Config       *string
+	Port         *int
+	Host         *string
+	Listen       []listenAddress
+	SocketMode   *fs.FileMode
+	IdleTimeout  *time.Duration
+	BackendPorts *scheduler.PortRange
+	APIKeysFile  *string
+	UsageLedger  *string
+
+	TLSCert     *string
+	TLSKey      *string
+	TLSClientCA *string
+
+	MaxRequestsPerMinute  *int
+	MaxConcurrentRequests *int
+	MaxTokensPerDay       *int64
+
+	StripThinkTags bool
+
+	RecordDir    *string
+	RecordKeep   *int
+	RecordRedact bool
 }
 
 // cli should include the name of the command itself
@@ -47,6 +72,51 @@ func parseArgs(cli []string) (a args, rest []string, err error) {
 			a.Ramalama = cli[:end]
 			cli = cli[end+1:]
 
+		case "-llama-server":
+			if a.LlamaServer != nil {
+				return args{}, nil, fmt.Errorf("%s may only be passed at most once", cli[0])
+			}
+
+			cli = cli[1:]
+			end := slices.Index(cli, ";")
+
+			if end < 0 {
+				return args{}, nil, errors.New("expected terminating \";\" for -llama-server")
+			}
+
+			if end == 0 {
+				return args{}, nil, errors.New("expected non-empty command after -llama-server")
+			}
+
+			a.LlamaServer = cli[:end]
+			cli = cli[end+1:]
+
+		case "-config":
+			if a.Config != nil {
+				return args{}, nil, fmt.Errorf("%s may only be passed at most once", cli[0])
+			}
+
+			if len(cli) < 2 {
+				return args{}, nil, fmt.Errorf("expected file path after %s", cli[0])
+			}
+
+			a.Config = &cli[1]
+
+			cli = cli[2:]
+
+		case "-models-dir":
+			if a.ModelsDir != nil {
+				return args{}, nil, fmt.Errorf("%s may only be passed at most once", cli[0])
+			}
+
+			if len(cli) < 2 {
+				return args{}, nil, fmt.Errorf("expected directory after %s", cli[0])
+			}
+
+			a.ModelsDir = &cli[1]
+
+			cli = cli[2:]
+
 		case "-port":
 			if a.Port != nil {
 				return args{}, nil, fmt.Errorf("%s may only be passed at most once", cli[0])
@@ -78,6 +148,39 @@ func parseArgs(cli []string) (a args, rest []string, err error) {
 
 			cli = cli[2:]
 
+		case "-listen":
+			if len(cli) < 2 {
+				return args{}, nil, fmt.Errorf("expected address after %s", cli[0])
+			}
+
+			address, err := parseListenAddress(cli[1])
+			if err != nil {
+				return args{}, nil, fmt.Errorf("invalid address after %s: %v", cli[0], err)
+			}
+
+			a.Listen = append(a.Listen, address)
+
+			cli = cli[2:]
+
+		case "-socket-mode":
+			if a.SocketMode != nil {
+				return args{}, nil, fmt.Errorf("%s may only be passed at most once", cli[0])
+			}
+
+			if len(cli) < 2 {
+				return args{}, nil, fmt.Errorf("expected octal permissions after %s", cli[0])
+			}
+
+			mode, err := strconv.ParseUint(cli[1], 8, 32)
+			if err != nil || mode > 0o777 {
+				return args{}, nil, fmt.Errorf("invalid permissions %v after %s", cli[1], cli[0])
+			}
+
+			socketMode := fs.FileMode(mode)
+			a.SocketMode = &socketMode
+
+			cli = cli[2:]
+
 		case "-idle-timeout":
 			if a.IdleTimeout != nil {
 				return args{}, nil, fmt.Errorf("%s may only be passed at most once", cli[0])
@@ -95,6 +198,183 @@ func parseArgs(cli []string) (a args, rest []string, err error) {
 
 			cli = cli[2:]
 
+		case "-backend-ports":
+			if a.BackendPorts != nil {
+				return args{}, nil, fmt.Errorf("%s may only be passed at most once", cli[0])
+			}
+
+			if len(cli) < 2 {
+				return args{}, nil, fmt.Errorf("expected port range after %s", cli[0])
+			}
+
+			ports, err := parsePortRange(cli[1])
+			if err != nil {
+				return args{}, nil, fmt.Errorf("invalid port range after %s: %v", cli[0], err)
+			}
+			a.BackendPorts = &ports
+
+			cli = cli[2:]
+
+		case "-api-keys":
+			if a.APIKeysFile != nil {
+				return args{}, nil, fmt.Errorf("%s may only be passed at most once", cli[0])
+			}
+
+			if len(cli) < 2 {
+				return args{}, nil, fmt.Errorf("expected file path after %s", cli[0])
+			}
+
+			a.APIKeysFile = &cli[1]
+
+			cli = cli[2:]
+
+		case "-usage-ledger":
+			if a.UsageLedger != nil {
+				return args{}, nil, fmt.Errorf("%s may only be passed at most once", cli[0])
+			}
+
+			if len(cli) < 2 {
+				return args{}, nil, fmt.Errorf("expected file path after %s", cli[0])
+			}
+
+			a.UsageLedger = &cli[1]
+
+			cli = cli[2:]
+
+		case "-tls-cert":
+			if a.TLSCert != nil {
+				return args{}, nil, fmt.Errorf("%s may only be passed at most once", cli[0])
+			}
+
+			if len(cli) < 2 {
+				return args{}, nil, fmt.Errorf("expected file path after %s", cli[0])
+			}
+
+			a.TLSCert = &cli[1]
+
+			cli = cli[2:]
+
+		case "-tls-key":
+			if a.TLSKey != nil {
+				return args{}, nil, fmt.Errorf("%s may only be passed at most once", cli[0])
+			}
+
+			if len(cli) < 2 {
+				return args{}, nil, fmt.Errorf("expected file path after %s", cli[0])
+			}
+
+			a.TLSKey = &cli[1]
+
+			cli = cli[2:]
+
+		case "-tls-client-ca":
+			if a.TLSClientCA != nil {
+				return args{}, nil, fmt.Errorf("%s may only be passed at most once", cli[0])
+			}
+
+			if len(cli) < 2 {
+				return args{}, nil, fmt.Errorf("expected file path after %s", cli[0])
+			}
+
+			a.TLSClientCA = &cli[1]
+
+			cli = cli[2:]
+
+		case "-max-requests-per-minute":
+			if a.MaxRequestsPerMinute != nil {
+				return args{}, nil, fmt.Errorf("%s may only be passed at most once", cli[0])
+			}
+
+			if len(cli) < 2 {
+				return args{}, nil, fmt.Errorf("expected number after %s", cli[0])
+			}
+
+			n, err := strconv.Atoi(cli[1])
+			if err != nil {
+				return args{}, nil, fmt.Errorf("invalid number after %s: %v", cli[0], err)
+			}
+
+			a.MaxRequestsPerMinute = &n
+
+			cli = cli[2:]
+
+		case "-max-concurrent-requests":
+			if a.MaxConcurrentRequests != nil {
+				return args{}, nil, fmt.Errorf("%s may only be passed at most once", cli[0])
+			}
+
+			if len(cli) < 2 {
+				return args{}, nil, fmt.Errorf("expected number after %s", cli[0])
+			}
+
+			n, err := strconv.Atoi(cli[1])
+			if err != nil {
+				return args{}, nil, fmt.Errorf("invalid number after %s: %v", cli[0], err)
+			}
+
+			a.MaxConcurrentRequests = &n
+
+			cli = cli[2:]
+
+		case "-max-tokens-per-day":
+			if a.MaxTokensPerDay != nil {
+				return args{}, nil, fmt.Errorf("%s may only be passed at most once", cli[0])
+			}
+
+			if len(cli) < 2 {
+				return args{}, nil, fmt.Errorf("expected number after %s", cli[0])
+			}
+
+			n, err := strconv.ParseInt(cli[1], 10, 64)
+			if err != nil {
+				return args{}, nil, fmt.Errorf("invalid number after %s: %v", cli[0], err)
+			}
+
+			a.MaxTokensPerDay = &n
+
+			cli = cli[2:]
+
+		case "-strip-think-tags":
+			a.StripThinkTags = true
+
+			cli = cli[1:]
+
+		case "-record":
+			if a.RecordDir != nil {
+				return args{}, nil, fmt.Errorf("%s may only be passed at most once", cli[0])
+			}
+
+			if len(cli) < 2 {
+				return args{}, nil, fmt.Errorf("expected directory after %s", cli[0])
+			}
+
+			a.RecordDir = &cli[1]
+
+			cli = cli[2:]
+
+		case "-record-keep":
+			if a.RecordKeep != nil {
+				return args{}, nil, fmt.Errorf("%s may only be passed at most once", cli[0])
+			}
+
+			if len(cli) < 2 {
+				return args{}, nil, fmt.Errorf("expected number after %s", cli[0])
+			}
+
+			n, err := strconv.Atoi(cli[1])
+			if err != nil || n < 1 {
+				return args{}, nil, fmt.Errorf("invalid number after %s", cli[0])
+			}
+
+			a.RecordKeep = &n
+
+			cli = cli[2:]
+
+		case "-record-redact":
+			a.RecordRedact = true
+
+			cli = cli[1:]
+
 		case "--":
 			rest = append(rest, cli...)
 			return a, rest, nil
@@ -113,8 +393,33 @@ func parseArgs(cli []string) (a args, rest []string, err error) {
 	return a, rest, nil
 }
 
+// parsePortRange parses FIRST-LAST, or a single port.
+func parsePortRange(s string) (scheduler.PortRange, error) {
+	firstStr, lastStr, isRange := strings.Cut(s, "-")
+	if !isRange {
+		lastStr = firstStr
+	}
+
+	first, err := strconv.Atoi(firstStr)
+	if err != nil {
+		return scheduler.PortRange{}, err
+	}
+
+	last, err := strconv.Atoi(lastStr)
+	if err != nil {
+		return scheduler.PortRange{}, err
+	}
+
+	if first < 1 || last > 65535 || first > last {
+		return scheduler.PortRange{}, fmt.Errorf("%s is not a range of ports", s)
+	}
+
+	return scheduler.PortRange{First: first, Last: last}, nil
+}
+
 func printHelp(commandName string) {
-	fmt.Printf("Usage: %s [OPTION]...\n\n", commandName)
+	fmt.Printf("Usage: %s [OPTION]...\n", commandName)
+	fmt.Printf("       %s replay [-url URL] [-model MODEL] [-api-key KEY] FILE\n\n", commandName)
 	fmt.Println(help)
 }
 
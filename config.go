@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/wk-y/rama-swap/server/scheduler"
+)
+
+// config is the contents of the file given to -config.
+type config struct {
+	// Upstreams are models served by externally managed OpenAI-compatible servers.
+	Upstreams []scheduler.Upstream `json:"upstreams"`
+
+	// Models holds per-model settings, by model name.
+	Models map[string]modelConfig `json:"models"`
+}
+
+type modelConfig struct {
+	Readiness *readinessConfig `json:"readiness"`
+
+	// IdleTimeout is a duration, or "never" to keep the model loaded.
+	IdleTimeout string `json:"idle_timeout"`
+}
+
+// readinessConfig is the config file form of scheduler.ReadinessProbe.
+type readinessConfig struct {
+	TCP         bool   `json:"tcp"`
+	Path        string `json:"path"`
+	Status      int    `json:"status"`
+	JSONField   string `json:"json_field"`
+	JSONValue   string `json:"json_value"`
+	Interval    string `json:"interval"`
+	MaxInterval string `json:"max_interval"`
+}
+
+func (r readinessConfig) probe() (scheduler.ReadinessProbe, error) {
+	probe := scheduler.ReadinessProbe{
+		TCP:       r.TCP,
+		Path:      r.Path,
+		Status:    r.Status,
+		JSONField: r.JSONField,
+		JSONValue: r.JSONValue,
+	}
+
+	var err error
+	if r.Interval != "" {
+		if probe.Interval, err = time.ParseDuration(r.Interval); err != nil {
+			return probe, fmt.Errorf("invalid interval: %v", err)
+		}
+	}
+
+	if r.MaxInterval != "" {
+		if probe.MaxInterval, err = time.ParseDuration(r.MaxInterval); err != nil {
+			return probe, fmt.Errorf("invalid max_interval: %v", err)
+		}
+	}
+
+	return probe, nil
+}
+
+// modelOptions converts the settings for each model.
+func (c config) modelOptions() (map[string]scheduler.ModelOptions, error) {
+	options := map[string]scheduler.ModelOptions{}
+	for name, model := range c.Models {
+		var opts scheduler.ModelOptions
+		if model.Readiness != nil {
+			probe, err := model.Readiness.probe()
+			if err != nil {
+				return nil, fmt.Errorf("model %s readiness: %v", name, err)
+			}
+			opts.Readiness = probe
+		}
+
+		if model.IdleTimeout != "" {
+			timeout, err := parseIdleTimeout(model.IdleTimeout)
+			if err != nil {
+				return nil, fmt.Errorf("model %s idle_timeout: %v", name, err)
+			}
+			opts.IdleTimeout = &timeout
+		}
+		options[name] = opts
+	}
+	return options, nil
+}
+
+func loadConfig(path string) (config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return config{}, err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+
+	var c config
+	if err := decoder.Decode(&c); err != nil {
+		return config{}, fmt.Errorf("failed to parse config: %v", err)
+	}
+
+	for i, upstream := range c.Upstreams {
+		if upstream.Name == "" || upstream.BaseURL == "" {
+			return config{}, fmt.Errorf("upstream %d must have a name and base_url", i)
+		}
+	}
+
+	if _, err := c.modelOptions(); err != nil {
+		return config{}, err
+	}
+
+	return c, nil
+}
+
+// parseIdleTimeout parses a duration, where "never" or 0 become a negative duration that never times out.
+func parseIdleTimeout(s string) (time.Duration, error) {
+	if s == "never" {
+		return -1, nil
+	}
+
+	timeout, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+
+	if timeout <= 0 {
+		return -1, nil
+	}
+	return timeout, nil
+}
@@ -0,0 +1,328 @@
+// Package fakeramalama stands in for the ramalama command in tests.
+// It lists and inspects a fixed set of models, and serves them with a scripted OpenAI-compatible server
+// whose behavior depends on the model.
+//
+// Test binaries run themselves as the fake by calling Main from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		fakeramalama.Main()
+//		os.Exit(m.Run())
+//	}
+//
+// and then use Command as the ramalama command.
+package fakeramalama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Models served by the fake.
+const (
+	ModelChat    = "fake://chat"    // answers normally
+	ModelOther   = "fake://other"   // answers normally, for swapping with ModelChat
+	ModelSlow    = "fake://slow"    // takes SlowStart to become ready
+	ModelCrash   = "fake://crash"   // exits before becoming ready
+	ModelBroken  = "fake://broken"  // fails every chat completion
+	ModelAliased = "fake://aliased" // lists itself under another id in /v1/models
+)
+
+// Models lists every model served by the fake.
+var Models = []string{ModelChat, ModelOther, ModelSlow, ModelCrash, ModelBroken, ModelAliased}
+
+// SlowStart is how long ModelSlow takes to become ready.
+const SlowStart = time.Second
+
+// Reasoning is the reasoning_content of every completion.
+const Reasoning = "Thinking it over."
+
+// Reply returns the content of a completion by model for the given last message.
+func Reply(model, lastMessage string) string {
+	return fmt.Sprintf("%s heard: %s", model, lastMessage)
+}
+
+// ToolArguments are the arguments of tool calls made by the fake.
+// When a request has tools and its last message is from the user, the first tool is called.
+const ToolArguments = `{"query": "fake"}`
+
+// subcommand is the first argument that makes the test binary act as the fake.
+const subcommand = "fake-ramalama"
+
+// Command returns the ramalama command that runs the fake.
+func Command() []string {
+	executable, err := os.Executable()
+	if err != nil {
+		panic(err)
+	}
+	return []string{executable, subcommand}
+}
+
+// Main runs the fake and exits if the process was started by Command.
+// Otherwise it returns immediately.
+func Main() {
+	if len(os.Args) < 3 || os.Args[1] != subcommand {
+		return
+	}
+	os.Exit(run(os.Args[2:]))
+}
+
+func run(args []string) int {
+	switch args[0] {
+	case "list":
+		var models []map[string]any
+		for _, model := range Models {
+			models = append(models, map[string]any{
+				"name":     model,
+				"modified": "2025-01-01T00:00:00Z",
+				"size":     1 << 20,
+			})
+		}
+		json.NewEncoder(os.Stdout).Encode(models)
+		return 0
+
+	case "inspect":
+		name := args[len(args)-1]
+		if !slices.Contains(Models, name) {
+			fmt.Fprintf(os.Stderr, "Error: %s not found\n", name)
+			return 1
+		}
+
+		json.NewEncoder(os.Stdout).Encode(map[string]any{
+			"Name":     name,
+			"Registry": "fake",
+			"Format":   "GGUF",
+			"Metadata": map[string]any{
+				"general.architecture": "llama",
+				"general.size_label":   "1B",
+				"llama.context_length": 4096,
+			},
+		})
+		return 0
+
+	case "serve":
+		port := 0
+		for i, arg := range args {
+			if arg == "-p" && i+1 < len(args) {
+				port, _ = strconv.Atoi(args[i+1])
+			}
+		}
+		return serve(args[len(args)-1], port)
+
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unsupported command %q\n", args[0])
+		return 2
+	}
+}
+
+// serve serves model on port until interrupted.
+func serve(model string, port int) int {
+	switch model {
+	case ModelCrash:
+		fmt.Fprintln(os.Stderr, "Error: scripted crash")
+		return 1
+	case ModelSlow:
+		time.Sleep(SlowStart)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"status": "ok"})
+	})
+	mux.HandleFunc("GET /v1/models", func(w http.ResponseWriter, r *http.Request) {
+		id := model
+		if model == ModelAliased {
+			id = "aliased.gguf"
+		}
+		writeJSON(w, map[string]any{
+			"object": "list",
+			"data":   []any{map[string]any{"id": id, "object": "model", "owned_by": "fake"}},
+		})
+	})
+	mux.HandleFunc("POST /v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		chatCompletion(w, r, model)
+	})
+
+	server := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+type chatRequest struct {
+	Messages []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+	Tools []struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	} `json:"tools"`
+	Stream        bool `json:"stream"`
+	StreamOptions struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+}
+
+// lastMessage returns the text of the last message, joining the text parts of structured content.
+func (request chatRequest) lastMessage() (role, text string) {
+	if len(request.Messages) == 0 {
+		return "", ""
+	}
+	message := request.Messages[len(request.Messages)-1]
+
+	if json.Unmarshal(message.Content, &text) == nil {
+		return message.Role, text
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	json.Unmarshal(message.Content, &parts)
+
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return message.Role, strings.Join(texts, " ")
+}
+
+func chatCompletion(w http.ResponseWriter, r *http.Request, model string) {
+	var request chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]any{"error": map[string]any{"message": err.Error()}})
+		return
+	}
+
+	if model == ModelBroken {
+		w.WriteHeader(http.StatusInternalServerError)
+		writeJSON(w, map[string]any{"error": map[string]any{"message": "scripted failure", "type": "server_error"}})
+		return
+	}
+
+	role, text := request.lastMessage()
+
+	message := map[string]any{"role": "assistant", "reasoning_content": Reasoning}
+	finishReason := "stop"
+	var toolCall map[string]any
+	if len(request.Tools) > 0 && role == "user" {
+		finishReason = "tool_calls"
+		toolCall = map[string]any{
+			"index":    0,
+			"id":       "call_fake",
+			"type":     "function",
+			"function": map[string]any{"name": request.Tools[0].Function.Name, "arguments": ToolArguments},
+		}
+		message["content"] = nil
+		message["tool_calls"] = []any{toolCall}
+	} else {
+		message["content"] = Reply(model, text)
+	}
+
+	usage := map[string]any{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}
+	timings := map[string]any{"prompt_n": 10, "prompt_ms": 2.0, "predicted_n": 5, "predicted_ms": 50.0}
+
+	if !request.Stream {
+		writeJSON(w, map[string]any{
+			"id":      "chatcmpl-fake",
+			"object":  "chat.completion",
+			"created": time.Now().Unix(),
+			"model":   model,
+			"choices": []any{map[string]any{"index": 0, "message": message, "finish_reason": finishReason}},
+			"usage":   usage,
+			"timings": timings,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+
+	// streams deltas as llama-server does, reasoning first and the content a word at a time
+	deltas := []map[string]any{{"role": "assistant", "reasoning_content": Reasoning}}
+	if toolCall != nil {
+		// split the arguments to exercise reassembly
+		function := toolCall["function"].(map[string]any)
+		half := len(ToolArguments) / 2
+		deltas = append(deltas,
+			map[string]any{"tool_calls": []any{map[string]any{"index": 0, "id": toolCall["id"], "type": "function",
+				"function": map[string]any{"name": function["name"], "arguments": ToolArguments[:half]}}}},
+			map[string]any{"tool_calls": []any{map[string]any{"index": 0,
+				"function": map[string]any{"arguments": ToolArguments[half:]}}}},
+		)
+	} else {
+		words := strings.SplitAfter(message["content"].(string), " ")
+		for _, word := range words {
+			deltas = append(deltas, map[string]any{"content": word})
+		}
+	}
+
+	for i, delta := range deltas {
+		chunk := map[string]any{
+			"id":      "chatcmpl-fake",
+			"object":  "chat.completion.chunk",
+			"created": time.Now().Unix(),
+			"model":   model,
+			"choices": []any{map[string]any{"index": 0, "delta": delta, "finish_reason": nil}},
+		}
+		if i == len(deltas)-1 {
+			chunk["choices"].([]any)[0].(map[string]any)["finish_reason"] = finishReason
+			chunk["timings"] = timings
+		}
+		writeEvent(w, chunk)
+	}
+
+	if request.StreamOptions.IncludeUsage {
+		writeEvent(w, map[string]any{
+			"id":      "chatcmpl-fake",
+			"object":  "chat.completion.chunk",
+			"created": time.Now().Unix(),
+			"model":   model,
+			"choices": []any{},
+			"usage":   usage,
+		})
+	}
+
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeEvent(w http.ResponseWriter, value any) {
+	data, _ := json.Marshal(value)
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// listenAddress is an address given to -listen.
+type listenAddress struct {
+	Network string // "tcp" or "unix"
+	Address string
+}
+
+// parseListenAddress parses tcp://host:port or unix:///path.
+// Addresses without a scheme are treated as tcp.
+func parseListenAddress(s string) (listenAddress, error) {
+	scheme, address, ok := strings.Cut(s, "://")
+	if !ok {
+		scheme, address = "tcp", s
+	}
+
+	switch scheme {
+	case "tcp":
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return listenAddress{}, fmt.Errorf("invalid tcp address %q: %v", address, err)
+		}
+	case "unix":
+		if address == "" {
+			return listenAddress{}, errors.New("expected socket path after unix://")
+		}
+	default:
+		return listenAddress{}, fmt.Errorf("unsupported listen scheme %q", scheme)
+	}
+
+	return listenAddress{Network: scheme, Address: address}, nil
+}
+
+func (l listenAddress) String() string {
+	return l.Network + "://" + l.Address
+}
+
+// Listen opens a listener on the address.
+// For unix sockets, a stale socket file is removed first
+// and socketMode, if not nil, is applied to the new socket.
+func (l listenAddress) Listen(socketMode *fs.FileMode) (net.Listener, error) {
+	if l.Network != "unix" {
+		return net.Listen(l.Network, l.Address)
+	}
+
+	if info, err := os.Stat(l.Address); err == nil && info.Mode().Type() == fs.ModeSocket {
+		// make sure the socket isn't in use before removing it
+		if conn, err := net.Dial("unix", l.Address); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket %s is already in use", l.Address)
+		}
+
+		if err := os.Remove(l.Address); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %v", err)
+		}
+	}
+
+	if socketMode == nil {
+		return net.Listen("unix", l.Address)
+	}
+
+	// bind in a private directory and move the socket into place once its permissions are set,
+	// so that it is never reachable with the permissions given by the umask
+	dir, err := os.MkdirTemp(filepath.Dir(l.Address), ".rama-swap-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "s")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+
+	// the socket is removed by unixListener once it has been moved
+	listener.SetUnlinkOnClose(false)
+
+	if err := os.Chmod(path, *socketMode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %v", err)
+	}
+
+	if err := os.Rename(path, l.Address); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to move socket into place: %v", err)
+	}
+
+	return &unixListener{UnixListener: listener, path: l.Address}, nil
+}
+
+// unixListener is a unix socket listener that was bound under a different path than path.
+type unixListener struct {
+	*net.UnixListener
+	path string
+}
+
+// Addr implements net.Listener.
+func (l *unixListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+// Close implements net.Listener, removing the socket.
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	os.Remove(l.path)
+	return err
+}
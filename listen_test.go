@@ -0,0 +1,170 @@
+package main
+
+import (
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseListenAddress(t *testing.T) {
+	for _, tc := range []struct {
+		input     string
+		want      listenAddress
+		wantError string
+	}{
+		{input: "127.0.0.1:8080", want: listenAddress{Network: "tcp", Address: "127.0.0.1:8080"}},
+		{input: ":8080", want: listenAddress{Network: "tcp", Address: ":8080"}},
+		{input: "tcp://[::1]:8080", want: listenAddress{Network: "tcp", Address: "[::1]:8080"}},
+		{input: "unix:///run/rama-swap.sock", want: listenAddress{Network: "unix", Address: "/run/rama-swap.sock"}},
+		{input: "unix://relative.sock", want: listenAddress{Network: "unix", Address: "relative.sock"}},
+		{input: "localhost", wantError: "invalid tcp address"},
+		{input: "tcp://8080", wantError: "invalid tcp address"},
+		{input: "unix://", wantError: "expected socket path"},
+		{input: "http://localhost:8080", wantError: "unsupported listen scheme"},
+	} {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := parseListenAddress(tc.input)
+			if tc.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+					t.Errorf("Expected an error containing %q, got %v", tc.wantError, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("Expected %+v, got %+v", tc.want, got)
+			}
+			if got.String() != tc.want.Network+"://"+tc.want.Address {
+				t.Errorf("Unexpected string %q", got.String())
+			}
+		})
+	}
+}
+
+// socketPath returns the path of a socket in a new temporary directory.
+func socketPath(t *testing.T) string {
+	t.Helper()
+
+	// socket paths are limited to about 100 bytes, which t.TempDir can exceed
+	dir, err := os.MkdirTemp("", "listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return filepath.Join(dir, "rama-swap.sock")
+}
+
+func TestListenUnixSocketMode(t *testing.T) {
+	path := socketPath(t)
+	mode := fs.FileMode(0o660)
+
+	listener, err := listenAddress{Network: "unix", Address: path}.Listen(&mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Type() != fs.ModeSocket || info.Mode().Perm() != mode {
+		t.Errorf("Expected a socket with mode %v, got %v", mode, info.Mode())
+	}
+
+	if addr := listener.Addr().String(); addr != path {
+		t.Errorf("Expected the listener to report %s, got %s", path, addr)
+	}
+
+	// the temporary directory the socket was bound in is gone
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the socket to be left, got %v", entries)
+	}
+
+	// the socket still accepts connections after being moved
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to connect to the moved socket: %v", err)
+	}
+	conn.Close()
+
+	if err := listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected Close to remove the socket, got %v", err)
+	}
+}
+
+func TestListenUnixWithoutSocketMode(t *testing.T) {
+	path := socketPath(t)
+
+	listener, err := listenAddress{Network: "unix", Address: path}.Listen(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected Close to remove the socket, got %v", err)
+	}
+}
+
+func TestListenUnixStaleSocket(t *testing.T) {
+	path := socketPath(t)
+	address := listenAddress{Network: "unix", Address: path}
+
+	// leave a socket file behind, as a crashed server would
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	mode := fs.FileMode(0o600)
+	listener, err := address.Listen(&mode)
+	if err != nil {
+		t.Fatalf("Expected the stale socket to be replaced, got %v", err)
+	}
+	defer listener.Close()
+
+	// a socket that is in use isn't replaced
+	if _, err := address.Listen(&mode); err == nil || !strings.Contains(err.Error(), "already in use") {
+		t.Errorf("Expected an error for a socket in use, got %v", err)
+	}
+}
+
+func TestListenTCP(t *testing.T) {
+	address, err := parseListenAddress("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := address.Listen(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	if _, ok := listener.Addr().(*net.TCPAddr); !ok {
+		t.Errorf("Expected a tcp listener, got %v", listener.Addr())
+	}
+}
@@ -0,0 +1,175 @@
+// Package llamaserver serves GGUF files from a directory with llama-server,
+// without going through ramalama.
+package llamaserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/wk-y/rama-swap/ramalama"
+)
+
+// DefaultCommand is the command template used when Provider.Command is empty.
+var DefaultCommand = []string{"llama-server", "--host", "127.0.0.1", "--port", "{port}", "-m", "{model}", "-a", "{name}"}
+
+// splitPartPattern matches the suffix of the first file of a split GGUF model.
+var splitPartPattern = regexp.MustCompile(`-00001-of-\d{5}$`)
+
+// otherPartPattern matches the suffix of the remaining files of a split GGUF model.
+var otherPartPattern = regexp.MustCompile(`-\d{5}-of-\d{5}$`)
+
+// Provider is a ramalama.ModelProvider for a directory of GGUF files.
+// Models are named after their path relative to ModelsDir, without the .gguf extension.
+type Provider struct {
+	ModelsDir string
+
+	// Command is the template of the command used to serve a model.
+	// "{model}", "{port}" and "{name}" in arguments are replaced by the model path,
+	// the port to listen on, and the model name.
+	Command []string
+}
+
+func (p Provider) command() []string {
+	if len(p.Command) == 0 {
+		return DefaultCommand
+	}
+	return p.Command
+}
+
+// GetModels implements ramalama.ModelProvider.
+func (p Provider) GetModels() ([]ramalama.Model, error) {
+	var models []ramalama.Model
+
+	err := filepath.WalkDir(p.ModelsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".gguf") {
+			return nil
+		}
+
+		name, ok := p.modelName(path)
+		if !ok {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		models = append(models, ramalama.Model{
+			Name:     name,
+			Modified: info.ModTime().UTC().Format(time.RFC3339),
+			Size:     int(info.Size()),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models: %v", err)
+	}
+
+	return models, nil
+}
+
+// modelName returns the name of the model stored at path.
+// Multimodal projectors and all but the first part of split models aren't models by themselves.
+func (p Provider) modelName(path string) (string, bool) {
+	rel, err := filepath.Rel(p.ModelsDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	name := strings.TrimSuffix(filepath.ToSlash(rel), filepath.Ext(rel))
+	if strings.HasPrefix(filepath.Base(name), "mmproj") {
+		return "", false
+	}
+
+	if splitPartPattern.MatchString(name) {
+		return splitPartPattern.ReplaceAllString(name, ""), true
+	}
+
+	if otherPartPattern.MatchString(name) {
+		return "", false
+	}
+
+	return name, true
+}
+
+// modelPath returns the path of the file of the model named name.
+func (p Provider) modelPath(name string) (string, error) {
+	// list the directory rather than globbing, since names may contain glob metacharacters
+	prefix := filepath.Join(p.ModelsDir, filepath.FromSlash(name))
+	entries, err := os.ReadDir(filepath.Dir(prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ramalama.ErrModelNotFound{Model: name}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(filepath.Dir(prefix), entry.Name())
+		if !strings.HasPrefix(path, prefix) || entry.IsDir() {
+			continue
+		}
+
+		if modelName, ok := p.modelName(path); ok && modelName == name && strings.EqualFold(filepath.Ext(path), ".gguf") {
+			return path, nil
+		}
+	}
+
+	return "", ramalama.ErrModelNotFound{Model: name}
+}
+
+// Inspect implements ramalama.ModelProvider.
+func (p Provider) Inspect(name string) (ramalama.InspectInfo, error) {
+	path, err := p.modelPath(name)
+	if err != nil {
+		return ramalama.InspectInfo{}, err
+	}
+
+	info, err := ramalama.ReadGGUF(path)
+	if err != nil {
+		return ramalama.InspectInfo{}, err
+	}
+
+	info.Name = name
+	return info, nil
+}
+
+// ServeCommand implements ramalama.ModelProvider.
+// If the model can't be found, the command's Err is set.
+func (p Provider) ServeCommand(ctx context.Context, args ramalama.ServeArgs) *exec.Cmd {
+	path, err := p.modelPath(args.Model)
+
+	name := args.Model
+	if args.Alias != nil {
+		name = *args.Alias
+	}
+
+	replacer := strings.NewReplacer("{model}", path, "{port}", fmt.Sprint(args.Port), "{name}", name)
+
+	template := p.command()
+	cliArgs := make([]string, len(template))
+	for i, arg := range template {
+		cliArgs[i] = replacer.Replace(arg)
+	}
+
+	cmd := exec.CommandContext(ctx, cliArgs[0], cliArgs[1:]...)
+	if err != nil {
+		cmd.Err = err
+	}
+	return cmd
+}
+
+var _ ramalama.ModelProvider = Provider{}
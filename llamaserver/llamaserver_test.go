@@ -0,0 +1,72 @@
+package llamaserver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/wk-y/rama-swap/ramalama"
+)
+
+func TestProvider(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{
+		"small.gguf",
+		"org/big-00001-of-00002.gguf",
+		"org/big-00002-of-00002.gguf",
+		"org/mmproj-big.gguf",
+		"odd[1]*?.gguf",
+		"odd1x.gguf",
+		"README.md",
+	} {
+		path := filepath.Join(dir, file)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		os.WriteFile(path, nil, 0o644)
+	}
+
+	p := Provider{
+		ModelsDir: dir,
+		Command:   []string{"echo", "--port", "{port}", "-m", "{model}", "-a", "{name}"},
+	}
+
+	models, err := p.GetModels()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, model := range models {
+		names = append(names, model.Name)
+	}
+	slices.Sort(names)
+
+	if !slices.Equal(names, []string{"odd1x", "odd[1]*?", "org/big", "small"}) {
+		t.Errorf("Unexpected model names %v", names)
+	}
+
+	cmd := p.ServeCommand(context.Background(), ramalama.ServeArgs{Model: "org/big", Port: 1234})
+	if cmd.Err != nil {
+		t.Fatal(cmd.Err)
+	}
+
+	expected := []string{"echo", "--port", "1234", "-m", filepath.Join(dir, "org/big-00001-of-00002.gguf"), "-a", "org/big"}
+	if !slices.Equal(cmd.Args, expected) {
+		t.Errorf("Expected command %v, got %v", expected, cmd.Args)
+	}
+
+	// names are matched literally, not as glob patterns
+	for _, name := range []string{"odd[1]*?", "odd1x"} {
+		cmd := p.ServeCommand(context.Background(), ramalama.ServeArgs{Model: name, Port: 1234})
+		if cmd.Err != nil || cmd.Args[4] != filepath.Join(dir, name+".gguf") {
+			t.Errorf("Expected %s to be served from its own file, got %v, %v", name, cmd.Args, cmd.Err)
+		}
+	}
+
+	for _, name := range []string{"missing", "odd*", "missing/model", "../outside"} {
+		if cmd := p.ServeCommand(context.Background(), ramalama.ServeArgs{Model: name, Port: 1234}); cmd.Err == nil {
+			t.Errorf("Expected error for missing model %s", name)
+		}
+	}
+}
@@ -1,16 +1,20 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/coreos/go-systemd/v22/activation"
 
+	"github.com/wk-y/rama-swap/llamaserver"
 	"github.com/wk-y/rama-swap/ramalama"
 	"github.com/wk-y/rama-swap/server"
 	"github.com/wk-y/rama-swap/server/scheduler"
@@ -22,6 +26,19 @@ const defaultHost = "127.0.0.1"
 const EX_USAGE = 64
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		args, err := parseReplayArgs(os.Args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+			os.Exit(EX_USAGE)
+		}
+
+		if err := replay(args); err != nil {
+			log.Fatalf("Failed to replay: %v", err)
+		}
+		return
+	}
+
 	args, rest, err := parseArgs(os.Args)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
@@ -33,15 +50,31 @@ func main() {
 		os.Exit(EX_USAGE)
 	}
 
-	// set default values for unspecified flags
-	if args.Host == nil {
-		host := "127.0.0.1"
-		args.Host = &host
+	if len(args.Listen) > 0 && (args.Host != nil || args.Port != nil) {
+		fmt.Fprintf(os.Stderr, "%s: -listen cannot be combined with -host or -port\n", os.Args[0])
+		os.Exit(EX_USAGE)
 	}
 
-	if args.Port == nil {
-		port := 4917
-		args.Port = &port
+	if args.Host != nil || args.Port != nil {
+		log.Println("[WARN] -host and -port are deprecated, use -listen tcp://HOST:PORT instead")
+	}
+
+	// set default values for unspecified flags
+	if len(args.Listen) == 0 {
+		host := defaultHost
+		if args.Host != nil {
+			host = *args.Host
+		}
+
+		port := defaultPort
+		if args.Port != nil {
+			port = *args.Port
+		}
+
+		args.Listen = []listenAddress{{
+			Network: "tcp",
+			Address: net.JoinHostPort(host, strconv.Itoa(port)),
+		}}
 	}
 
 	if args.IdleTimeout == nil {
@@ -49,6 +82,16 @@ func main() {
 		args.IdleTimeout = &timeout
 	}
 
+	if args.ModelsDir != nil && args.Ramalama != nil {
+		fmt.Fprintf(os.Stderr, "%s: -models-dir cannot be combined with -ramalama\n", os.Args[0])
+		os.Exit(EX_USAGE)
+	}
+
+	if args.LlamaServer != nil && args.ModelsDir == nil {
+		fmt.Fprintf(os.Stderr, "%s: -llama-server requires -models-dir\n", os.Args[0])
+		os.Exit(EX_USAGE)
+	}
+
 	if args.Ramalama == nil {
 		if env := os.Getenv("RAMALAMA_COMMAND"); env != "" {
 			args.Ramalama = strings.Split(env, " ")
@@ -60,47 +103,183 @@ func main() {
 		}
 	}
 
-	ramalama := ramalama.Ramalama{
-		Command: args.Ramalama,
+	if (args.TLSCert == nil) != (args.TLSKey == nil) {
+		fmt.Fprintf(os.Stderr, "%s: -tls-cert and -tls-key must be passed together\n", os.Args[0])
+		os.Exit(EX_USAGE)
+	}
+
+	if args.TLSClientCA != nil && args.TLSCert == nil {
+		fmt.Fprintf(os.Stderr, "%s: -tls-client-ca requires -tls-cert and -tls-key\n", os.Args[0])
+		os.Exit(EX_USAGE)
+	}
+
+	var tlsConfig *tls.Config
+	scheme := "http"
+	if args.TLSCert != nil {
+		clientCA := ""
+		if args.TLSClientCA != nil {
+			clientCA = *args.TLSClientCA
+		}
+
+		reloader, err := newTLSReloader(*args.TLSCert, *args.TLSKey, clientCA)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificates: %v", err)
+		}
+		tlsConfig = reloader.Config()
+		scheme = "https"
+	}
+
+	var conf config
+	if args.Config != nil {
+		conf, err = loadConfig(*args.Config)
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+	}
+
+	var apiKeys []server.APIKey
+	if args.APIKeysFile != nil {
+		keys, err := server.LoadAPIKeys(*args.APIKeysFile)
+		if err != nil {
+			log.Fatalf("Failed to load API keys: %v", err)
+		}
+		apiKeys = append(apiKeys, keys...)
+	}
+
+	if env := os.Getenv("RAMA_SWAP_API_KEYS"); env != "" {
+		apiKeys = append(apiKeys, server.ParseAPIKeys(env)...)
+	}
+
+	if len(apiKeys) > 0 {
+		log.Printf("API key authentication enabled with %d key(s)\n", len(apiKeys))
+	}
+
+	var ledger *server.UsageLedger
+	if args.UsageLedger != nil {
+		ledger, err = server.OpenUsageLedger(*args.UsageLedger)
+		if err != nil {
+			log.Fatalf("Failed to open usage ledger: %v", err)
+		}
+	}
+
+	var recorder *server.Recorder
+	if args.RecordDir != nil {
+		keep := 1000
+		if args.RecordKeep != nil {
+			keep = *args.RecordKeep
+		}
+
+		recorder, err = server.OpenRecorder(*args.RecordDir, keep, args.RecordRedact)
+		if err != nil {
+			log.Fatalf("Failed to open recording directory: %v", err)
+		}
+		log.Printf("Recording backend requests to %s\n", *args.RecordDir)
+	}
+
+	var provider ramalama.ModelProvider
+	var storePath string
+	if args.ModelsDir != nil {
+		provider = llamaserver.Provider{
+			ModelsDir: *args.ModelsDir,
+			Command:   args.LlamaServer,
+		}
+		storePath = *args.ModelsDir
+	} else {
+		storePath = ramalama.DefaultStorePath()
+		provider = ramalama.Ramalama{
+			Command:   args.Ramalama,
+			StorePath: storePath,
+		}
+	}
+
+	catalog := ramalama.NewCatalog(provider)
+	go catalog.Watch(context.Background(), storePath, time.Minute)
+
+	modelOptions, err := conf.modelOptions()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	backendPorts := scheduler.DefaultPortRange
+	if args.BackendPorts != nil {
+		backendPorts = *args.BackendPorts
+	}
+
+	scheduler := scheduler.NewFcfsScheduler(provider, catalog, backendPorts, *args.IdleTimeout)
+	for model, options := range modelOptions {
+		scheduler.SetModelOptions(model, options)
+	}
+
+	for _, upstream := range conf.Upstreams {
+		if err := scheduler.AddUpstream(upstream); err != nil {
+			log.Fatalf("Failed to add upstream: %v", err)
+		}
+
+		catalog.AddStatic(ramalama.Model{
+			Name:     upstream.Name,
+			Modified: time.Now().UTC().Format(time.RFC3339),
+		}, ramalama.InspectInfo{
+			Name: upstream.Name,
+		})
+	}
+
+	server := server.NewServer(catalog, scheduler)
+	server.APIKeys = apiKeys
+	server.UsageLedger = ledger
+	server.Recorder = recorder
+	server.StripThinkTags = args.StripThinkTags
+
+	if args.MaxRequestsPerMinute != nil {
+		server.RateLimits.RequestsPerMinute = *args.MaxRequestsPerMinute
+	}
+	if args.MaxConcurrentRequests != nil {
+		server.RateLimits.Concurrent = *args.MaxConcurrentRequests
+	}
+	if args.MaxTokensPerDay != nil {
+		server.RateLimits.TokensPerDay = *args.MaxTokensPerDay
 	}
-	scheduler := scheduler.NewFcfsScheduler(ramalama, 49170, *args.IdleTimeout)
-	server := server.NewServer(ramalama, scheduler)
 
 	server.ModelNameMangler = func(s string) string {
 		return strings.ReplaceAll(s, "/", "_")
 	}
 
+	mux := http.NewServeMux()
+	server.HandleHttp(mux)
+
 	// serve on all systemd sockets
 	listeners, err := activation.Listeners()
 	if err != nil {
 		log.Fatalf("Failed checking for socket activation: %v", err)
 	}
 
-	for i, listener := range listeners {
+	for i := range listeners {
 		log.Printf("Listening on socket activation (%d)", i)
-		mux := http.NewServeMux()
-		server.HandleHttp(mux)
+	}
+
+	// serve on the configured addresses
+	for _, address := range args.Listen {
+		l, err := address.Listen(args.SocketMode)
+		if err != nil {
+			log.Fatalf("Failed to listen on %v: %v", address, err)
+		}
+
+		log.Printf("Listening on %v (%s)\n", address, scheme)
+		listeners = append(listeners, l)
+	}
+
+	for _, listener := range listeners {
+		if tlsConfig != nil {
+			listener = tls.NewListener(listener, tlsConfig)
+		}
 
 		go func() {
 			defer listener.Close()
 
-			err = http.Serve(listener, mux)
+			err := http.Serve(listener, mux)
 
 			log.Fatalf("Failed to serve: %v", err)
 		}()
 	}
 
-	// serve on the configured host/port
-	log.Printf("Listening on http://%s:%d\n", *args.Host, *args.Port)
-
-	l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", *args.Host, *args.Port))
-	if err != nil {
-		log.Fatalf("Failed to listen: %v", err)
-	}
-	defer l.Close()
-
-	server.HandleHttp(http.DefaultServeMux)
-	err = http.Serve(l, nil)
-
-	log.Fatalf("Failed to serve: %v", err)
+	select {}
 }
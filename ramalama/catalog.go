@@ -0,0 +1,314 @@
+package ramalama
+
+import (
+	"context"
+	"hash/fnv"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Catalog caches the list of installed models and their inspect results.
+// Inspect results are cached by model name and modified time,
+// so they are only recomputed when a model changes.
+type Catalog struct {
+	provider ModelProvider
+
+	refreshLock sync.Mutex // serializes calls to provider.GetModels
+
+	lock     sync.RWMutex
+	models   []Model
+	listed   bool // whether models has been loaded
+	inspects map[inspectKey]*inspectEntry
+
+	digests *digestCache
+
+	// models that don't come from provider, with their inspect results
+	static []staticModel
+}
+
+type staticModel struct {
+	model Model
+	info  InspectInfo
+}
+
+type inspectKey struct {
+	name     string
+	modified string
+}
+
+type inspectEntry struct {
+	ready chan struct{} // closed once info and err are set
+	info  InspectInfo
+	err   error
+}
+
+func NewCatalog(provider ModelProvider) *Catalog {
+	return &Catalog{
+		provider: provider,
+		inspects: map[inspectKey]*inspectEntry{},
+		digests:  newDigestCache(),
+	}
+}
+
+// Models returns the installed models, listing them if they haven't been listed before.
+// The returned slice must not be modified.
+func (c *Catalog) Models() ([]Model, error) {
+	c.lock.RLock()
+	models, listed := c.models, c.listed
+	c.lock.RUnlock()
+
+	if listed {
+		return models, nil
+	}
+
+	return c.Refresh()
+}
+
+// Refresh lists the installed models again, dropping inspect results of models that changed.
+// The returned slice must not be modified.
+func (c *Catalog) Refresh() ([]Model, error) {
+	c.refreshLock.Lock()
+	defer c.refreshLock.Unlock()
+
+	models, err := c.provider.GetModels()
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, static := range c.static {
+		models = append(models, static.model)
+	}
+
+	c.models = models
+	c.listed = true
+
+	for key := range c.inspects {
+		if !slices.ContainsFunc(models, func(model Model) bool {
+			return model.Name == key.name && model.Modified == key.modified
+		}) {
+			delete(c.inspects, key)
+		}
+	}
+
+	return models, nil
+}
+
+// AddStatic adds a model that isn't provided by the catalog's provider, such as a remote model.
+func (c *Catalog) AddStatic(model Model, info InspectInfo) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.static = append(c.static, staticModel{model: model, info: info})
+	if c.listed {
+		c.models = append(slices.Clip(c.models), model)
+	}
+}
+
+// Find returns the installed model named name.
+// If the model isn't in the cached list, the list is refreshed in case it was just installed.
+func (c *Catalog) Find(name string) (model Model, ok bool, err error) {
+	models, err := c.Models()
+	if err != nil {
+		return Model{}, false, err
+	}
+
+	if i := slices.IndexFunc(models, func(m Model) bool { return m.Name == name }); i >= 0 {
+		return models[i], true, nil
+	}
+
+	models, err = c.Refresh()
+	if err != nil {
+		return Model{}, false, err
+	}
+
+	if i := slices.IndexFunc(models, func(m Model) bool { return m.Name == name }); i >= 0 {
+		return models[i], true, nil
+	}
+
+	return Model{}, false, nil
+}
+
+// Inspect returns the inspect result for the installed model named name.
+func (c *Catalog) Inspect(name string) (InspectInfo, error) {
+	model, ok, err := c.Find(name)
+	if err != nil {
+		return InspectInfo{}, err
+	}
+
+	if !ok {
+		return InspectInfo{}, ErrModelNotFound{Model: name}
+	}
+
+	return c.inspect(model)
+}
+
+func (c *Catalog) inspect(model Model) (InspectInfo, error) {
+	key := inspectKey{name: model.Name, modified: model.Modified}
+
+	c.lock.Lock()
+	for _, static := range c.static {
+		if static.model.Name == model.Name {
+			c.lock.Unlock()
+			return static.info, nil
+		}
+	}
+
+	entry, ok := c.inspects[key]
+	if !ok {
+		entry = &inspectEntry{ready: make(chan struct{})}
+		c.inspects[key] = entry
+	}
+	c.lock.Unlock()
+
+	if ok {
+		<-entry.ready
+		return entry.info, entry.err
+	}
+
+	entry.info, entry.err = c.provider.Inspect(model.Name)
+	close(entry.ready)
+
+	if entry.err != nil {
+		// don't cache failures, they might be temporary
+		c.lock.Lock()
+		if c.inspects[key] == entry {
+			delete(c.inspects, key)
+		}
+		c.lock.Unlock()
+	}
+
+	return entry.info, entry.err
+}
+
+// Digest returns the hex encoded sha256 digest of the model file at path.
+// Digests are computed in the background on first use, and "" is returned until they are ready.
+// They are only computed again when the file's size or modified time changes.
+func (c *Catalog) Digest(path string) string {
+	return c.digests.Digest(path)
+}
+
+// inspectAll inspects every installed model so that later calls to Inspect don't have to wait.
+func (c *Catalog) inspectAll() {
+	models, err := c.Models()
+	if err != nil {
+		return
+	}
+
+	// limit the number of concurrent inspect processes
+	sem := make(chan struct{}, 4)
+	var wg sync.WaitGroup
+	for _, model := range models {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			// digests are left to the first caller of Digest, since hashing large models is slow
+			if _, err := c.inspect(model); err != nil {
+				log.Printf("Failed to inspect model %s: %v\n", model.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Watch keeps the catalog up to date until ctx is cancelled.
+// The catalog is refreshed every interval, and whenever the directories of the
+// model store at storePath change. storePath may be empty to disable watching the store.
+func (c *Catalog) Watch(ctx context.Context, storePath string, interval time.Duration) {
+	refresh := func() {
+		if _, err := c.Refresh(); err != nil {
+			log.Printf("Failed to refresh model catalog: %v\n", err)
+			return
+		}
+		c.inspectAll()
+	}
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	refresh()
+
+	lastRefresh := time.Now()
+	lastStoreState := storeState(storePath)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		state := storeState(storePath)
+		if state != lastStoreState || time.Since(lastRefresh) >= interval {
+			lastStoreState = state
+			lastRefresh = time.Now()
+			refresh()
+		}
+	}
+}
+
+// watchPollInterval is how often Watch checks for changes.
+var watchPollInterval = 2 * time.Second
+
+// storeState summarizes the directories of the model store,
+// so that models being added or removed can be detected cheaply.
+// Only directories are checked, since adding or removing a file changes its directory.
+func storeState(storePath string) uint64 {
+	if storePath == "" {
+		return 0
+	}
+
+	state := fnv.New64a()
+	filepath.WalkDir(storePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		state.Write([]byte(path))
+		state.Write([]byte(info.ModTime().String()))
+
+		// keep the walk cheap for large stores
+		if strings.Count(strings.TrimPrefix(path, storePath), string(filepath.Separator)) >= 5 {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+
+	return state.Sum64()
+}
+
+// DefaultStorePath returns the model store ramalama uses by default.
+func DefaultStorePath() string {
+	if store := os.Getenv("RAMALAMA_STORE"); store != "" {
+		return store
+	}
+
+	if os.Geteuid() == 0 {
+		return "/var/lib/ramalama"
+	}
+
+	if data := os.Getenv("XDG_DATA_HOME"); data != "" {
+		return filepath.Join(data, "ramalama")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "share", "ramalama")
+}
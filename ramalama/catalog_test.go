@@ -0,0 +1,242 @@
+package ramalama
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeProvider is a ModelProvider that counts how often it is used.
+type fakeProvider struct {
+	lock   sync.Mutex
+	models []Model
+
+	lists    atomic.Int64
+	inspects atomic.Int64
+
+	inspectGate chan struct{} // if not nil, Inspect waits for it to be closed
+	inspectErr  error
+	inspectPath string // the Path of every inspect result
+}
+
+func (p *fakeProvider) setModels(models ...Model) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.models = models
+}
+
+func (p *fakeProvider) GetModels() ([]Model, error) {
+	p.lists.Add(1)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]Model{}, p.models...), nil
+}
+
+func (p *fakeProvider) Inspect(name string) (InspectInfo, error) {
+	p.inspects.Add(1)
+	if p.inspectGate != nil {
+		<-p.inspectGate
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.inspectErr != nil {
+		return InspectInfo{}, p.inspectErr
+	}
+	return InspectInfo{Name: name, Path: p.inspectPath}, nil
+}
+
+func (p *fakeProvider) ServeCommand(ctx context.Context, args ServeArgs) *exec.Cmd {
+	return nil
+}
+
+func TestCatalogCachesModels(t *testing.T) {
+	provider := &fakeProvider{}
+	provider.setModels(Model{Name: "a", Modified: "1"})
+	catalog := NewCatalog(provider)
+
+	for range 3 {
+		if models, err := catalog.Models(); err != nil || len(models) != 1 {
+			t.Fatalf("Unexpected models %v, %v", models, err)
+		}
+	}
+	if n := provider.lists.Load(); n != 1 {
+		t.Errorf("Expected the models to be listed once, got %d", n)
+	}
+
+	// a model installed since the last listing is found by refreshing
+	provider.setModels(Model{Name: "a", Modified: "1"}, Model{Name: "b", Modified: "1"})
+	if _, ok, err := catalog.Find("b"); !ok || err != nil {
+		t.Errorf("Expected to find the new model, got %v, %v", ok, err)
+	}
+
+	if _, ok, err := catalog.Find("missing"); ok || err != nil {
+		t.Errorf("Expected a missing model not to be found, got %v, %v", ok, err)
+	}
+}
+
+func TestCatalogCachesInspect(t *testing.T) {
+	provider := &fakeProvider{inspectGate: make(chan struct{})}
+	provider.setModels(Model{Name: "a", Modified: "1"})
+	catalog := NewCatalog(provider)
+
+	// concurrent inspects of the same model share one call to the provider
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if info, err := catalog.Inspect("a"); err != nil || info.Name != "a" {
+				t.Errorf("Unexpected inspect result %+v, %v", info, err)
+			}
+		}()
+	}
+
+	for provider.inspects.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond) // let the other goroutines wait for the result
+	close(provider.inspectGate)
+	wg.Wait()
+
+	if n := provider.inspects.Load(); n != 1 {
+		t.Errorf("Expected one inspect, got %d", n)
+	}
+
+	// refreshing without changes keeps the result
+	catalog.Refresh()
+	catalog.Inspect("a")
+	if n := provider.inspects.Load(); n != 1 {
+		t.Errorf("Expected the inspect result to be kept, got %d inspects", n)
+	}
+
+	// a modified model is inspected again
+	provider.setModels(Model{Name: "a", Modified: "2"})
+	catalog.Refresh()
+	catalog.Inspect("a")
+	if n := provider.inspects.Load(); n != 2 {
+		t.Errorf("Expected the modified model to be inspected again, got %d inspects", n)
+	}
+}
+
+func TestCatalogDoesNotCacheInspectFailures(t *testing.T) {
+	provider := &fakeProvider{inspectErr: errors.New("temporary failure")}
+	provider.setModels(Model{Name: "a", Modified: "1"})
+	catalog := NewCatalog(provider)
+
+	if _, err := catalog.Inspect("a"); err == nil {
+		t.Fatalf("Expected the inspect to fail")
+	}
+
+	provider.lock.Lock()
+	provider.inspectErr = nil
+	provider.lock.Unlock()
+
+	if _, err := catalog.Inspect("a"); err != nil {
+		t.Errorf("Expected the failure not to be cached, got %v", err)
+	}
+}
+
+func TestCatalogInspectAllSkipsDigests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model.gguf")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &fakeProvider{inspectPath: path}
+	provider.setModels(Model{Name: "a", Modified: "1"})
+	catalog := NewCatalog(provider)
+
+	catalog.inspectAll()
+
+	catalog.digests.lock.Lock()
+	hashed := len(catalog.digests.digests)
+	catalog.digests.lock.Unlock()
+	if hashed != 0 {
+		t.Errorf("Expected inspecting models not to compute their digests, got %d", hashed)
+	}
+}
+
+func TestCatalogConcurrentAccess(t *testing.T) {
+	provider := &fakeProvider{}
+	provider.setModels(Model{Name: "a", Modified: "1"})
+	catalog := NewCatalog(provider)
+	catalog.AddStatic(Model{Name: "static"}, InspectInfo{Name: "static"})
+
+	var wg sync.WaitGroup
+	for i := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				switch i % 4 {
+				case 0:
+					catalog.Refresh()
+				case 1:
+					catalog.Models()
+				case 2:
+					if _, ok, err := catalog.Find("static"); !ok || err != nil {
+						t.Errorf("Expected to find the static model, got %v, %v", ok, err)
+					}
+				case 3:
+					if _, err := catalog.Inspect("a"); err != nil {
+						t.Errorf("Unexpected inspect error %v", err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCatalogWatch(t *testing.T) {
+	defer func(interval time.Duration) { watchPollInterval = interval }(watchPollInterval)
+	watchPollInterval = 10 * time.Millisecond
+
+	waitForLists := func(provider *fakeProvider, n int64) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for provider.lists.Load() < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected at least %d listings, got %d", n, provider.lists.Load())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	t.Run("interval", func(t *testing.T) {
+		provider := &fakeProvider{}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go NewCatalog(provider).Watch(ctx, "", 30*time.Millisecond)
+		waitForLists(provider, 3)
+	})
+
+	t.Run("store change", func(t *testing.T) {
+		store := t.TempDir()
+		provider := &fakeProvider{}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go NewCatalog(provider).Watch(ctx, store, time.Hour)
+		waitForLists(provider, 1)
+
+		time.Sleep(5 * watchPollInterval)
+		if n := provider.lists.Load(); n != 1 {
+			t.Errorf("Expected no refresh before the store changes, got %d listings", n)
+		}
+
+		if err := os.Mkdir(filepath.Join(store, "models"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		waitForLists(provider, 2)
+	})
+}
@@ -0,0 +1,104 @@
+package ramalama
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// blobNamePattern matches content-addressed blob file names in the ramalama store.
+var blobNamePattern = regexp.MustCompile(`^sha256[-:]([0-9a-f]{64})$`)
+
+type digestKey struct {
+	path     string
+	modified time.Time
+	size     int64
+}
+
+// digestCache computes sha256 digests of model files in the background.
+type digestCache struct {
+	lock    sync.Mutex
+	digests map[digestKey]string // an empty digest means it is being computed
+	queue   chan digestKey
+}
+
+func newDigestCache() *digestCache {
+	c := &digestCache{
+		digests: map[digestKey]string{},
+		queue:   make(chan digestKey, 1024),
+	}
+	go c.worker()
+	return c
+}
+
+// Digest returns the hex encoded sha256 digest of the file at path.
+// If the file is named after its digest, as blobs in the ramalama store are, the name is used.
+// Otherwise, "" is returned while the digest is computed in the background.
+func (c *digestCache) Digest(path string) string {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return ""
+	}
+
+	if match := blobNamePattern.FindStringSubmatch(filepath.Base(resolved)); match != nil {
+		return match[1]
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return ""
+	}
+	key := digestKey{path: resolved, modified: info.ModTime(), size: info.Size()}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	digest, ok := c.digests[key]
+	if !ok {
+		select {
+		case c.queue <- key:
+			c.digests[key] = ""
+		default: // try again on a later call
+		}
+	}
+	return digest
+}
+
+// worker hashes queued files one at a time, so that hashing doesn't saturate the disk.
+func (c *digestCache) worker() {
+	for key := range c.queue {
+		digest, err := hashFile(key.path)
+		if err != nil {
+			log.Printf("Failed to compute digest of %s: %v\n", key.path, err)
+		}
+
+		c.lock.Lock()
+		if err != nil {
+			delete(c.digests, key)
+		} else {
+			c.digests[key] = digest
+		}
+		c.lock.Unlock()
+	}
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,37 @@
+package ramalama
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigest(t *testing.T) {
+	dir := t.TempDir()
+	cache := newDigestCache()
+
+	blobDigest := strings.Repeat("ab", 32)
+	blob := filepath.Join(dir, "sha256-"+blobDigest)
+	os.WriteFile(blob, []byte("model"), 0o644)
+
+	link := filepath.Join(dir, "model.gguf")
+	os.Symlink(blob, link)
+
+	if digest := cache.Digest(link); digest != blobDigest {
+		t.Errorf("Expected digest from blob name, got %q", digest)
+	}
+
+	file := filepath.Join(dir, "other.gguf")
+	os.WriteFile(file, []byte("hello"), 0o644)
+
+	const helloDigest = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	deadline := time.Now().Add(5 * time.Second)
+	for cache.Digest(file) != helloDigest {
+		if time.Now().After(deadline) {
+			t.Fatalf("Digest was not computed, got %q", cache.Digest(file))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,5 +1,7 @@
 package ramalama
 
+import "fmt"
+
 type ErrEmptyCommand struct{}
 
 // Error implements error.
@@ -8,3 +10,14 @@ func (e ErrEmptyCommand) Error() string {
 }
 
 var _ error = ErrEmptyCommand{}
+
+type ErrModelNotFound struct {
+	Model string
+}
+
+// Error implements error.
+func (e ErrModelNotFound) Error() string {
+	return fmt.Sprintf("model %q not found", e.Model)
+}
+
+var _ error = ErrModelNotFound{}
@@ -0,0 +1,290 @@
+package ramalama
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// ErrNotGGUF is returned by ReadGGUF when the file is not a GGUF file.
+var ErrNotGGUF = errors.New("not a GGUF file")
+
+const ggufMagic = "GGUF"
+
+// maxGGUFArrayLen is the longest metadata array kept by ReadGGUF.
+// Longer arrays, such as tokenizer vocabularies, are skipped to save memory.
+const maxGGUFArrayLen = 1024
+
+// GGUF metadata value types
+const (
+	ggufTypeUint8 = iota
+	ggufTypeInt8
+	ggufTypeUint16
+	ggufTypeInt16
+	ggufTypeUint32
+	ggufTypeInt32
+	ggufTypeFloat32
+	ggufTypeBool
+	ggufTypeString
+	ggufTypeArray
+	ggufTypeUint64
+	ggufTypeInt64
+	ggufTypeFloat64
+)
+
+// ggmlTypeNames maps tensor types to names, following ggml's ggml_type.
+var ggmlTypeNames = map[uint32]string{
+	0:  "F32",
+	1:  "F16",
+	2:  "Q4_0",
+	3:  "Q4_1",
+	6:  "Q5_0",
+	7:  "Q5_1",
+	8:  "Q8_0",
+	9:  "Q8_1",
+	10: "Q2_K",
+	11: "Q3_K",
+	12: "Q4_K",
+	13: "Q5_K",
+	14: "Q6_K",
+	15: "Q8_K",
+	16: "IQ2_XXS",
+	17: "IQ2_XS",
+	18: "IQ3_XXS",
+	19: "IQ1_S",
+	20: "IQ4_NL",
+	21: "IQ3_S",
+	22: "IQ2_S",
+	23: "IQ4_XS",
+	24: "I8",
+	25: "I16",
+	26: "I32",
+	27: "I64",
+	28: "F64",
+	29: "IQ1_M",
+	30: "BF16",
+	34: "TQ1_0",
+	35: "TQ2_0",
+	39: "MXFP4",
+}
+
+// ggufReader reads GGUF primitives in the file's byte order.
+type ggufReader struct {
+	r       *bufio.Reader
+	order   binary.ByteOrder
+	version uint32
+	err     error // first error encountered, later reads are no-ops
+}
+
+func (g *ggufReader) read(data any) {
+	if g.err != nil {
+		return
+	}
+	g.err = binary.Read(g.r, g.order, data)
+}
+
+func (g *ggufReader) uint32() uint32 {
+	var v uint32
+	g.read(&v)
+	return v
+}
+
+func (g *ggufReader) uint64() uint64 {
+	var v uint64
+	g.read(&v)
+	return v
+}
+
+// count reads a length or count, which is 32-bit in GGUF version 1.
+func (g *ggufReader) count() uint64 {
+	if g.version == 1 {
+		return uint64(g.uint32())
+	}
+	return g.uint64()
+}
+
+func (g *ggufReader) string() string {
+	n := g.count()
+	if g.err != nil {
+		return ""
+	}
+
+	if n > 1<<30 {
+		g.err = fmt.Errorf("string length %d is too large", n)
+		return ""
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(g.r, buf); err != nil {
+		g.err = err
+	}
+	return string(buf)
+}
+
+// value reads a metadata value of type t.
+// Arrays longer than maxGGUFArrayLen are read but nil is returned.
+func (g *ggufReader) value(t uint32) any {
+	switch t {
+	case ggufTypeUint8:
+		var v uint8
+		g.read(&v)
+		return v
+	case ggufTypeInt8:
+		var v int8
+		g.read(&v)
+		return v
+	case ggufTypeUint16:
+		var v uint16
+		g.read(&v)
+		return v
+	case ggufTypeInt16:
+		var v int16
+		g.read(&v)
+		return v
+	case ggufTypeUint32:
+		return g.uint32()
+	case ggufTypeInt32:
+		var v int32
+		g.read(&v)
+		return v
+	case ggufTypeFloat32:
+		var v float32
+		g.read(&v)
+		return v
+	case ggufTypeBool:
+		var v uint8
+		g.read(&v)
+		return v != 0
+	case ggufTypeString:
+		return g.string()
+	case ggufTypeArray:
+		elemType := g.uint32()
+		n := g.count()
+		if g.err != nil {
+			return nil
+		}
+
+		keep := n <= maxGGUFArrayLen
+		var values []any
+		if keep {
+			values = make([]any, 0, n)
+		}
+		for i := uint64(0); i < n && g.err == nil; i++ {
+			v := g.value(elemType)
+			if keep {
+				values = append(values, v)
+			}
+		}
+
+		if !keep {
+			return nil
+		}
+		return values
+	case ggufTypeUint64:
+		return g.uint64()
+	case ggufTypeInt64:
+		var v int64
+		g.read(&v)
+		return v
+	case ggufTypeFloat64:
+		var v float64
+		g.read(&v)
+		return v
+	default:
+		if g.err == nil {
+			g.err = fmt.Errorf("unknown metadata value type %d", t)
+		}
+		return nil
+	}
+}
+
+// ReadGGUF reads the metadata and tensor info from the header of the GGUF file at path.
+// Name and Registry are left empty.
+func ReadGGUF(path string) (InspectInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return InspectInfo{}, err
+	}
+	defer f.Close()
+
+	return readGGUF(f, path)
+}
+
+func readGGUF(file io.Reader, path string) (InspectInfo, error) {
+	g := &ggufReader{r: bufio.NewReaderSize(file, 1<<16)}
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(g.r, magic); err != nil || string(magic) != ggufMagic {
+		return InspectInfo{}, ErrNotGGUF
+	}
+
+	// the version is small, so its byte order shows the file's byte order
+	var versionBytes [4]byte
+	if _, err := io.ReadFull(g.r, versionBytes[:]); err != nil {
+		return InspectInfo{}, fmt.Errorf("failed to read GGUF version: %v", err)
+	}
+
+	info := InspectInfo{
+		Format: "GGUF",
+		Path:   path,
+	}
+
+	g.order = binary.LittleEndian
+	g.version = binary.LittleEndian.Uint32(versionBytes[:])
+	if g.version > math.MaxUint16 {
+		g.order = binary.BigEndian
+		g.version = binary.BigEndian.Uint32(versionBytes[:])
+		info.Endianness = 1
+	}
+	info.Version = int64(g.version)
+
+	if g.version < 1 || g.version > 3 {
+		return InspectInfo{}, fmt.Errorf("unsupported GGUF version %d", g.version)
+	}
+
+	tensorCount := g.count()
+	kvCount := g.count()
+
+	all := make(map[string]any)
+	for i := uint64(0); i < kvCount && g.err == nil; i++ {
+		key := g.string()
+		t := g.uint32()
+		value := g.value(t)
+		if value != nil {
+			all[key] = value
+		}
+	}
+
+	for i := uint64(0); i < tensorCount && g.err == nil; i++ {
+		var tensor Tensor
+		tensor.Name = g.string()
+		tensor.NDimensions = int64(g.uint32())
+		if tensor.NDimensions > 8 {
+			return InspectInfo{}, fmt.Errorf("tensor %s has too many dimensions", tensor.Name)
+		}
+		for range tensor.NDimensions {
+			tensor.Dimensions = append(tensor.Dimensions, int64(g.count()))
+		}
+
+		t := g.uint32()
+		if name, ok := ggmlTypeNames[t]; ok {
+			tensor.Type = name
+		} else {
+			tensor.Type = fmt.Sprint(t)
+		}
+
+		tensor.Offset = int64(g.uint64())
+		info.Tensors = append(info.Tensors, tensor)
+	}
+
+	if g.err != nil {
+		return InspectInfo{}, fmt.Errorf("failed to read GGUF header: %v", g.err)
+	}
+
+	info.Metadata = newModelMetadata(all)
+	return info, nil
+}
@@ -0,0 +1,169 @@
+package ramalama
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ggufWriter builds synthetic GGUF files for tests.
+type ggufWriter struct {
+	buf     bytes.Buffer
+	order   binary.ByteOrder
+	version uint32
+}
+
+func (w *ggufWriter) write(data any) {
+	binary.Write(&w.buf, w.order, data)
+}
+
+func (w *ggufWriter) count(n int) {
+	if w.version == 1 {
+		w.write(uint32(n))
+	} else {
+		w.write(uint64(n))
+	}
+}
+
+func (w *ggufWriter) string(s string) {
+	w.count(len(s))
+	w.buf.WriteString(s)
+}
+
+func (w *ggufWriter) header(tensors, kvs int) {
+	w.buf.WriteString("GGUF")
+	w.write(w.version)
+	w.count(tensors)
+	w.count(kvs)
+}
+
+func (w *ggufWriter) kvString(key, value string) {
+	w.string(key)
+	w.write(uint32(ggufTypeString))
+	w.string(value)
+}
+
+func (w *ggufWriter) kvUint32(key string, value uint32) {
+	w.string(key)
+	w.write(uint32(ggufTypeUint32))
+	w.write(value)
+}
+
+func (w *ggufWriter) kvStringArray(key string, values []string) {
+	w.string(key)
+	w.write(uint32(ggufTypeArray))
+	w.write(uint32(ggufTypeString))
+	w.count(len(values))
+	for _, v := range values {
+		w.string(v)
+	}
+}
+
+func (w *ggufWriter) tensor(name string, dims []uint64, ggmlType uint32, offset uint64) {
+	w.string(name)
+	w.write(uint32(len(dims)))
+	for _, d := range dims {
+		w.count(int(d))
+	}
+	w.write(ggmlType)
+	w.write(offset)
+}
+
+func writeTestGGUF(t *testing.T, order binary.ByteOrder, version uint32) string {
+	w := &ggufWriter{order: order, version: version}
+	w.header(2, 5)
+	w.kvString("general.architecture", "llama")
+	w.kvString("general.size_label", "1B")
+	w.kvUint32("general.file_type", 15)
+	w.kvUint32("llama.context_length", 4096)
+	w.kvStringArray("tokenizer.ggml.tokens", make([]string, maxGGUFArrayLen+1))
+	w.tensor("token_embd.weight", []uint64{2048, 32000}, 12, 0)
+	w.tensor("output_norm.weight", []uint64{2048}, 0, 1024)
+
+	path := filepath.Join(t.TempDir(), "model.gguf")
+	if err := os.WriteFile(path, w.buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadGGUF(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		order   binary.ByteOrder
+		version uint32
+	}{
+		{"little endian v3", binary.LittleEndian, 3},
+		{"big endian v3", binary.BigEndian, 3},
+		{"little endian v1", binary.LittleEndian, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeTestGGUF(t, tc.order, tc.version)
+
+			info, err := ReadGGUF(path)
+			if err != nil {
+				t.Fatalf("Failed to read GGUF: %v", err)
+			}
+
+			if info.Version != int64(tc.version) || info.Format != "GGUF" || info.Path != path {
+				t.Errorf("Unexpected header info: %+v", info)
+			}
+
+			if arch := info.Metadata.GeneralArchitecture; arch == nil || *arch != "llama" {
+				t.Errorf("Expected architecture llama, got %v", arch)
+			}
+
+			if size := info.Metadata.GeneralSizeLabel; size == nil || *size != "1B" {
+				t.Errorf("Expected size label 1B, got %v", size)
+			}
+
+			if q := info.Metadata.Quantization(); q != "Q4_K_M" {
+				t.Errorf("Expected quantization Q4_K_M, got %q", q)
+			}
+
+			if n := info.Metadata.ContextLength(); n != 4096 {
+				t.Errorf("Expected context length 4096, got %d", n)
+			}
+
+			if _, ok := info.Metadata.All["tokenizer.ggml.tokens"]; ok {
+				t.Errorf("Expected long arrays to be skipped")
+			}
+
+			if len(info.Tensors) != 2 {
+				t.Fatalf("Expected 2 tensors, got %d", len(info.Tensors))
+			}
+
+			tensor := info.Tensors[0]
+			if tensor.Name != "token_embd.weight" || tensor.Type != "Q4_K" || tensor.NDimensions != 2 ||
+				tensor.Dimensions[0] != 2048 || tensor.Dimensions[1] != 32000 {
+				t.Errorf("Unexpected tensor info: %+v", tensor)
+			}
+
+			if info.Tensors[1].Offset != 1024 || info.Tensors[1].Type != "F32" {
+				t.Errorf("Unexpected tensor info: %+v", info.Tensors[1])
+			}
+		})
+	}
+}
+
+func TestReadGGUFInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model.safetensors")
+	os.WriteFile(path, []byte("not a gguf file"), 0o644)
+
+	if _, err := ReadGGUF(path); !errors.Is(err, ErrNotGGUF) {
+		t.Errorf("Expected ErrNotGGUF, got %v", err)
+	}
+
+	// truncated header
+	w := &ggufWriter{order: binary.LittleEndian, version: 3}
+	w.header(0, 1)
+	w.string("general.architecture")
+	os.WriteFile(path, w.buf.Bytes(), 0o644)
+
+	if _, err := ReadGGUF(path); err == nil || errors.Is(err, ErrNotGGUF) {
+		t.Errorf("Expected truncated header error, got %v", err)
+	}
+}
@@ -2,9 +2,12 @@ package ramalama
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os/exec"
 	"slices"
+	"strings"
 )
 
 type InspectInfo struct {
@@ -14,40 +17,230 @@ type InspectInfo struct {
 	Name       string        `json:"Name"`
 	Path       string        `json:"Path"`
 	Registry   string        `json:"Registry"`
-	Tensors    []struct {
-		Dimensions  []int64 `json:"dimensions"`
-		NDimensions int64   `json:"n_dimensions"`
-		Name        string  `json:"name"`
-		Offset      int64   `json:"offset"`
-		Type        string  `json:"type"`
-	} `json:"Tensors"`
-	Version int64 `json:"Version"`
+	Tensors    []Tensor      `json:"Tensors"`
+	Version    int64         `json:"Version"`
+}
+
+type Tensor struct {
+	Dimensions  []int64 `json:"dimensions"`
+	NDimensions int64   `json:"n_dimensions"`
+	Name        string  `json:"name"`
+	Offset      int64   `json:"offset"`
+	Type        string  `json:"type"`
 }
 
 type ModelMetadata struct {
 	GeneralArchitecture *string `json:"general.architecture"`
 	GeneralSizeLabel    *string `json:"general.size_label"`
+	GeneralFileType     *int64  `json:"general.file_type"`
+
+	// All holds every metadata key, including architecture specific keys
+	// such as "llama.context_length".
+	All map[string]any `json:"-"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (m *ModelMetadata) UnmarshalJSON(data []byte) error {
+	type plain ModelMetadata
+	if err := json.Unmarshal(data, (*plain)(m)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &m.All)
+}
+
+// Quantization returns the model's quantization level, such as "Q4_K_M".
+// If the file type isn't recorded in the metadata, the tensor type covering
+// the most weights is used instead. "" is returned if neither is known.
+func (i InspectInfo) Quantization() string {
+	if q := i.Metadata.Quantization(); q != "" {
+		return q
+	}
+
+	weights := map[string]int64{}
+	for _, tensor := range i.Tensors {
+		n := int64(1)
+		for _, d := range tensor.Dimensions {
+			n *= d
+		}
+		weights[tensor.Type] += n
+	}
+
+	var best string
+	for t, n := range weights {
+		if n > weights[best] || (n == weights[best] && t < best) {
+			best = t
+		}
+	}
+	return best
 }
 
+// newModelMetadata creates ModelMetadata from a map of every metadata key.
+func newModelMetadata(all map[string]any) ModelMetadata {
+	m := ModelMetadata{All: all}
+
+	if architecture, ok := all["general.architecture"].(string); ok {
+		m.GeneralArchitecture = &architecture
+	}
+
+	if sizeLabel, ok := all["general.size_label"].(string); ok {
+		m.GeneralSizeLabel = &sizeLabel
+	}
+
+	if fileType, ok := metadataInt(all["general.file_type"]); ok {
+		m.GeneralFileType = &fileType
+	}
+
+	return m
+}
+
+// metadataInt converts a numeric metadata value to an int64.
+// Values decoded from JSON are float64, while values read from GGUF files keep their type.
+func metadataInt(value any) (int64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return int64(v), true
+	case float32:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// ContextLength returns the context length the model was trained with, or 0 if unknown.
+func (m ModelMetadata) ContextLength() int64 {
+	if m.GeneralArchitecture == nil {
+		return 0
+	}
+
+	length, _ := metadataInt(m.All[*m.GeneralArchitecture+".context_length"])
+	return length
+}
+
+// Quantization returns the name of the model's file type, such as "Q4_K_M", or "" if unknown.
+func (m ModelMetadata) Quantization() string {
+	if m.GeneralFileType == nil {
+		return ""
+	}
+	return fileTypeNames[*m.GeneralFileType]
+}
+
+// fileTypeNames maps general.file_type values to names, following llama.cpp's llama_ftype.
+var fileTypeNames = map[int64]string{
+	0:  "F32",
+	1:  "F16",
+	2:  "Q4_0",
+	3:  "Q4_1",
+	7:  "Q8_0",
+	8:  "Q5_0",
+	9:  "Q5_1",
+	10: "Q2_K",
+	11: "Q3_K_S",
+	12: "Q3_K_M",
+	13: "Q3_K_L",
+	14: "Q4_K_S",
+	15: "Q4_K_M",
+	16: "Q5_K_S",
+	17: "Q5_K_M",
+	18: "Q6_K",
+	19: "IQ2_XXS",
+	20: "IQ2_XS",
+	21: "Q2_K_S",
+	22: "IQ3_XS",
+	23: "IQ3_XXS",
+	24: "IQ1_S",
+	25: "IQ4_NL",
+	26: "IQ3_S",
+	27: "IQ3_M",
+	28: "IQ2_S",
+	29: "IQ2_M",
+	30: "IQ4_XS",
+	31: "IQ1_M",
+	32: "BF16",
+	36: "TQ1_0",
+	37: "TQ2_0",
+	38: "MXFP4_MOE",
+}
+
+// Inspect returns information about an installed model.
+// GGUF headers are read directly from the model file, which is found in r.StorePath if possible.
+// Otherwise ramalama is asked for the file's path, and formats other than GGUF
+// fall back to ramalama's own (much slower) inspection.
 func (r Ramalama) Inspect(name string) (InspectInfo, error) {
-	if err := r.checkValidity(); err != nil {
+	if r.StorePath != "" {
+		path, err := storeModelPath(r.StorePath, name)
+		if err == nil {
+			info, err := ReadGGUF(path)
+			if err == nil {
+				info.Registry, info.Name, _ = strings.Cut(name, "://")
+				return info, nil
+			}
+			if !errors.Is(err, ErrNotGGUF) {
+				log.Printf("Failed to read GGUF header of %s, falling back to ramalama inspect: %v\n", name, err)
+			}
+		} else if !errors.Is(err, errNotInStore) {
+			log.Printf("Failed to find %s in the model store, falling back to ramalama inspect: %v\n", name, err)
+		}
+	}
+
+	basic, err := r.inspect(name, false)
+	if err != nil {
 		return InspectInfo{}, err
 	}
 
-	cliArgs := slices.Concat(r.Command[1:], []string{"inspect", "--json", "--all", name})
-	cmd := exec.Command(r.Command[0], cliArgs...)
+	if basic.Path == "" {
+		return r.inspect(name, true)
+	}
 
-	pipe, err := cmd.StdoutPipe()
+	info, err := ReadGGUF(basic.Path)
 	if err != nil {
-		return InspectInfo{}, fmt.Errorf("failed to pipe command: %v", err)
+		if !errors.Is(err, ErrNotGGUF) {
+			log.Printf("Failed to read GGUF header of %s, falling back to ramalama inspect: %v\n", name, err)
+		}
+		return r.inspect(name, true)
+	}
+
+	info.Name = basic.Name
+	info.Registry = basic.Registry
+	return info, nil
+}
+
+// inspect runs ramalama inspect.
+// If all is false, only the name, registry and path of the model are returned.
+func (r Ramalama) inspect(name string, all bool) (InspectInfo, error) {
+	if err := r.checkValidity(); err != nil {
+		return InspectInfo{}, err
+	}
+
+	cliArgs := slices.Concat(r.Command[1:], []string{"inspect", "--json"})
+	if all {
+		cliArgs = append(cliArgs, "--all")
 	}
+	cliArgs = append(cliArgs, name)
 
-	if err := cmd.Start(); err != nil {
-		return InspectInfo{}, fmt.Errorf("failed to start command: %v", err)
+	cmd := exec.Command(r.Command[0], cliArgs...)
+	output, err := cmd.Output()
+	if err != nil {
+		return InspectInfo{}, fmt.Errorf("ramalama error: %v", err)
 	}
 
 	var info InspectInfo
-	if err := json.NewDecoder(pipe).Decode(&info); err != nil {
+	if err := json.Unmarshal(output, &info); err != nil {
 		return InspectInfo{}, fmt.Errorf("failed to parse inspect output: %v", err)
 	}
 
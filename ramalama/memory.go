@@ -0,0 +1,106 @@
+package ramalama
+
+// ggmlBlock is how a tensor type stores its weights: in blocks of weights, each taking bytes.
+type ggmlBlock struct {
+	weights int64
+	bytes   int64
+}
+
+// ggmlBlocks maps tensor type names to their block layout, following ggml's type traits.
+var ggmlBlocks = map[string]ggmlBlock{
+	"F32":     {1, 4},
+	"F16":     {1, 2},
+	"Q4_0":    {32, 18},
+	"Q4_1":    {32, 20},
+	"Q5_0":    {32, 22},
+	"Q5_1":    {32, 24},
+	"Q8_0":    {32, 34},
+	"Q8_1":    {32, 36},
+	"Q2_K":    {256, 84},
+	"Q3_K":    {256, 110},
+	"Q4_K":    {256, 144},
+	"Q5_K":    {256, 176},
+	"Q6_K":    {256, 210},
+	"Q8_K":    {256, 292},
+	"IQ2_XXS": {256, 66},
+	"IQ2_XS":  {256, 74},
+	"IQ3_XXS": {256, 98},
+	"IQ1_S":   {256, 50},
+	"IQ4_NL":  {32, 18},
+	"IQ3_S":   {256, 110},
+	"IQ2_S":   {256, 82},
+	"IQ4_XS":  {256, 136},
+	"I8":      {1, 1},
+	"I16":     {1, 2},
+	"I32":     {1, 4},
+	"I64":     {1, 8},
+	"F64":     {1, 8},
+	"IQ1_M":   {256, 56},
+	"BF16":    {1, 2},
+	"TQ1_0":   {256, 54},
+	"TQ2_0":   {256, 66},
+	"MXFP4":   {32, 17},
+}
+
+// WeightsSize returns the number of bytes the model's tensors take, or 0 if a tensor type is unknown.
+func (i InspectInfo) WeightsSize() int64 {
+	var size int64
+	for _, tensor := range i.Tensors {
+		block, ok := ggmlBlocks[tensor.Type]
+		if !ok {
+			return 0
+		}
+
+		n := int64(1)
+		for _, d := range tensor.Dimensions {
+			n *= d
+		}
+		size += (n + block.weights - 1) / block.weights * block.bytes
+	}
+	return size
+}
+
+// KVCacheSize returns the number of bytes llama.cpp's default f16 KV cache takes for contextLength tokens,
+// or 0 if the metadata doesn't describe the model's attention.
+func (m ModelMetadata) KVCacheSize(contextLength int64) int64 {
+	if m.GeneralArchitecture == nil {
+		return 0
+	}
+	arch := *m.GeneralArchitecture
+
+	layers, _ := metadataInt(m.All[arch+".block_count"])
+	heads, _ := metadataInt(m.All[arch+".attention.head_count"])
+	embedding, _ := metadataInt(m.All[arch+".embedding_length"])
+	if layers == 0 || heads == 0 {
+		return 0
+	}
+
+	// grouped-query attention shares each KV head between several query heads
+	kvHeads, ok := metadataInt(m.All[arch+".attention.head_count_kv"])
+	if !ok {
+		kvHeads = heads
+	}
+
+	keyLength, ok := metadataInt(m.All[arch+".attention.key_length"])
+	if !ok {
+		keyLength = embedding / heads
+	}
+	valueLength, ok := metadataInt(m.All[arch+".attention.value_length"])
+	if !ok {
+		valueLength = embedding / heads
+	}
+
+	const f16Bytes = 2
+	return layers * contextLength * kvHeads * (keyLength + valueLength) * f16Bytes
+}
+
+// MemoryEstimate returns roughly how many bytes the model needs when served with its full context length:
+// its weights and its KV cache. 0 is returned if the weights' size is unknown.
+// Compute buffers and other runtime overhead aren't included.
+func (i InspectInfo) MemoryEstimate() int64 {
+	weights := i.WeightsSize()
+	if weights == 0 {
+		return 0
+	}
+	return weights + i.Metadata.KVCacheSize(i.Metadata.ContextLength())
+}
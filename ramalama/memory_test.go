@@ -0,0 +1,50 @@
+package ramalama
+
+import "testing"
+
+func TestWeightsSize(t *testing.T) {
+	info := InspectInfo{Tensors: []Tensor{
+		{Type: "Q4_K", Dimensions: []int64{2048, 32000}},
+		{Type: "F32", Dimensions: []int64{2048}},
+		{Type: "Q8_0", Dimensions: []int64{40}}, // a partial block still takes a whole one
+	}}
+
+	if size, want := info.WeightsSize(), int64(2048*32000/256*144+2048*4+2*34); size != want {
+		t.Errorf("Expected %d bytes, got %d", want, size)
+	}
+
+	info.Tensors = append(info.Tensors, Tensor{Type: "999", Dimensions: []int64{1}})
+	if size := info.WeightsSize(); size != 0 {
+		t.Errorf("Expected an unknown tensor type to make the size unknown, got %d", size)
+	}
+}
+
+func TestMemoryEstimate(t *testing.T) {
+	info := InspectInfo{
+		Metadata: newModelMetadata(map[string]any{
+			"general.architecture":          "llama",
+			"llama.context_length":          uint32(4096),
+			"llama.block_count":             uint32(16),
+			"llama.embedding_length":        uint32(2048),
+			"llama.attention.head_count":    uint32(32),
+			"llama.attention.head_count_kv": uint32(8),
+		}),
+		Tensors: []Tensor{{Type: "F16", Dimensions: []int64{1000}}},
+	}
+
+	// 16 layers of 4096 tokens, with keys and values of 8 heads of 64
+	kvCache := int64(16 * 4096 * 8 * (64 + 64) * 2)
+	if size := info.Metadata.KVCacheSize(4096); size != kvCache {
+		t.Errorf("Expected a KV cache of %d bytes, got %d", kvCache, size)
+	}
+
+	if estimate := info.MemoryEstimate(); estimate != 2000+kvCache {
+		t.Errorf("Expected an estimate of %d bytes, got %d", 2000+kvCache, estimate)
+	}
+
+	// without attention metadata only the weights are known
+	info.Metadata = newModelMetadata(map[string]any{"general.architecture": "llama"})
+	if estimate := info.MemoryEstimate(); estimate != 2000 {
+		t.Errorf("Expected an estimate of the weights alone, got %d", estimate)
+	}
+}
@@ -0,0 +1,19 @@
+package ramalama
+
+import (
+	"context"
+	"os/exec"
+)
+
+// ModelProvider lists, inspects and serves models.
+// Ramalama is the default implementation.
+type ModelProvider interface {
+	GetModels() ([]Model, error)
+	Inspect(name string) (InspectInfo, error)
+
+	// ServeCommand returns a command that serves an OpenAI-compatible API for the model.
+	// The command should exit gracefully when sent an interrupt signal.
+	ServeCommand(ctx context.Context, args ServeArgs) *exec.Cmd
+}
+
+var _ ModelProvider = Ramalama{}
@@ -9,6 +9,10 @@ import (
 
 type Ramalama struct {
 	Command []string
+
+	// StorePath is ramalama's model store, where Inspect looks for model files
+	// before asking ramalama. It may be empty to always ask ramalama.
+	StorePath string
 }
 
 // checkValidity checks that the Ramalama configuration is valid.
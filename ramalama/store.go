@@ -0,0 +1,100 @@
+package ramalama
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// storeTypes maps model name schemes to the directories ramalama stores them under.
+var storeTypes = map[string]string{
+	"ollama":      "ollama",
+	"hf":          "huggingface",
+	"huggingface": "huggingface",
+	"ms":          "modelscope",
+	"modelscope":  "modelscope",
+	"oci":         "oci",
+	"docker":      "oci",
+	"http":        "url",
+	"https":       "url",
+	"file":        "url",
+}
+
+// storeRef is a ref file, which lists the files of one tag of a model.
+type storeRef struct {
+	Hash  string `json:"hash"`
+	Files []struct {
+		Hash string `json:"hash"`
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"files"`
+}
+
+// errNotInStore is returned by storeModelPath when the model's files can't be found in the store.
+var errNotInStore = errors.New("model not found in store")
+
+// storeModelPath returns the path of the model file of the model named name in the ramalama store at store,
+// without running ramalama. Models are stored as
+//
+//	STORE/store/TYPE/PATH/refs/TAG.json
+//	STORE/store/TYPE/PATH/snapshots/HASH/FILE
+//
+// where TYPE comes from the name's scheme, PATH and TAG are the rest of the name,
+// and the ref file lists the files in the snapshot.
+func storeModelPath(store, name string) (string, error) {
+	scheme, rest, ok := strings.Cut(name, "://")
+	if !ok {
+		return "", fmt.Errorf("%w: %s has no scheme", errNotInStore, name)
+	}
+
+	storeType, ok := storeTypes[scheme]
+	if !ok {
+		return "", fmt.Errorf("%w: unsupported scheme %s", errNotInStore, scheme)
+	}
+
+	rest = strings.TrimPrefix(rest, "/")
+	tag := "latest"
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		rest, tag = rest[:i], rest[i+1:]
+	}
+
+	dir := filepath.Join(store, "store", storeType, filepath.FromSlash(rest))
+	if rel, err := filepath.Rel(store, dir); err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%w: invalid model name %s", errNotInStore, name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "refs", tag+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", errNotInStore, name)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var ref storeRef
+	if err := json.Unmarshal(data, &ref); err != nil {
+		return "", fmt.Errorf("failed to parse ref file: %v", err)
+	}
+
+	for _, file := range ref.Files {
+		if file.Type != "model" {
+			continue
+		}
+
+		path := filepath.Join(dir, "snapshots", sanitizeStoreName(ref.Hash), file.Name)
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("%w: %v", errNotInStore, err)
+		}
+		return path, nil
+	}
+
+	return "", fmt.Errorf("%w: %s has no model file", errNotInStore, name)
+}
+
+// sanitizeStoreName converts a digest like sha256:abc into the form used for file names in the store.
+func sanitizeStoreName(name string) string {
+	return strings.ReplaceAll(name, ":", "-")
+}
@@ -0,0 +1,87 @@
+package ramalama
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestStore creates a model store at store holding a GGUF model named ollama://library/tiny:1b.
+func writeTestStore(t *testing.T, store string) string {
+	t.Helper()
+
+	model, err := os.ReadFile(writeTestGGUF(t, binary.LittleEndian, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(store, "store", "ollama", "library", "tiny")
+	snapshot := filepath.Join(dir, "snapshots", "sha256-1234")
+	for _, d := range []string{filepath.Join(dir, "refs"), snapshot} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ref := `{"hash": "sha256:1234", "files": [
+		{"hash": "sha256:5678", "name": "config.json", "type": "other"},
+		{"hash": "sha256:abcd", "name": "tiny.gguf", "type": "model"}
+	]}`
+	if err := os.WriteFile(filepath.Join(dir, "refs", "1b.json"), []byte(ref), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(snapshot, "tiny.gguf")
+	if err := os.WriteFile(path, model, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestStoreModelPath(t *testing.T) {
+	store := t.TempDir()
+	want := writeTestStore(t, store)
+
+	if path, err := storeModelPath(store, "ollama://library/tiny:1b"); err != nil || path != want {
+		t.Errorf("Expected %s, got %q, %v", want, path, err)
+	}
+
+	for _, name := range []string{
+		"ollama://library/tiny",          // other tag
+		"ollama://library/other:1b",      // other model
+		"tiny:1b",                        // no scheme
+		"rlcr://library/tiny:1b",         // unknown scheme
+		"ollama://../../../etc/passwd:1", // outside the store
+	} {
+		if _, err := storeModelPath(store, name); !errors.Is(err, errNotInStore) {
+			t.Errorf("Expected %s not to be found in the store, got %v", name, err)
+		}
+	}
+}
+
+func TestInspectFromStore(t *testing.T) {
+	store := t.TempDir()
+	path := writeTestStore(t, store)
+
+	// the command doesn't exist, so the model must be found without it
+	r := Ramalama{Command: []string{filepath.Join(store, "missing-ramalama")}, StorePath: store}
+
+	info, err := r.Inspect("ollama://library/tiny:1b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Path != path || info.Registry != "ollama" || info.Name != "library/tiny:1b" || info.Format != "GGUF" {
+		t.Errorf("Unexpected inspect result %+v", info)
+	}
+
+	if info.Metadata.ContextLength() != 4096 {
+		t.Errorf("Expected the metadata to be read, got %+v", info.Metadata)
+	}
+
+	if _, err := r.Inspect("ollama://library/other:1b"); err == nil {
+		t.Errorf("Expected a model outside the store to be inspected with ramalama, which is missing")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wk-y/rama-swap/server"
+)
+
+type replayArgs struct {
+	URL    string
+	Model  *string
+	APIKey *string
+	File   string
+}
+
+// parseReplayArgs parses the arguments after "replay".
+func parseReplayArgs(cli []string) (a replayArgs, err error) {
+	var url *string
+	var files []string
+
+	for len(cli) > 0 {
+		switch cli[0] {
+		case "-h", "-help", "--help":
+			printReplayHelp(os.Args[0])
+			os.Exit(0)
+
+		case "-url":
+			if url != nil {
+				return replayArgs{}, fmt.Errorf("%s may only be passed at most once", cli[0])
+			}
+
+			if len(cli) < 2 {
+				return replayArgs{}, fmt.Errorf("expected URL after %s", cli[0])
+			}
+
+			url = &cli[1]
+
+			cli = cli[2:]
+
+		case "-model":
+			if a.Model != nil {
+				return replayArgs{}, fmt.Errorf("%s may only be passed at most once", cli[0])
+			}
+
+			if len(cli) < 2 {
+				return replayArgs{}, fmt.Errorf("expected model name after %s", cli[0])
+			}
+
+			a.Model = &cli[1]
+
+			cli = cli[2:]
+
+		case "-api-key":
+			if a.APIKey != nil {
+				return replayArgs{}, fmt.Errorf("%s may only be passed at most once", cli[0])
+			}
+
+			if len(cli) < 2 {
+				return replayArgs{}, fmt.Errorf("expected key after %s", cli[0])
+			}
+
+			a.APIKey = &cli[1]
+
+			cli = cli[2:]
+
+		default:
+			if strings.HasPrefix(cli[0], "-") {
+				return replayArgs{}, fmt.Errorf("unrecognized flag %s. Use -help to list flags.", cli[0])
+			}
+
+			files = append(files, cli[0])
+
+			cli = cli[1:]
+		}
+	}
+
+	if len(files) != 1 {
+		return replayArgs{}, errors.New("replay expects exactly one recording")
+	}
+	a.File = files[0]
+
+	a.URL = fmt.Sprintf("http://%s:%d", defaultHost, defaultPort)
+	if url != nil {
+		a.URL = strings.TrimSuffix(*url, "/")
+	}
+
+	return a, nil
+}
+
+func printReplayHelp(commandName string) {
+	fmt.Printf("Usage: %s replay [OPTION]... FILE\n\n", commandName)
+	fmt.Println("Sends the client request of a recording made with -record to a rama-swap server again.")
+	fmt.Println()
+	fmt.Printf("  -url URL       the server to send the request to (default http://%s:%d)\n", defaultHost, defaultPort)
+	fmt.Println("  -model MODEL   the model to use instead of the recorded one")
+	fmt.Println("  -api-key KEY   the API key to send to the server")
+}
+
+// replay re-sends the client request of a recording to a rama-swap server,
+// writing the response to stdout and comparing its timing with the recording's on stderr.
+func replay(a replayArgs) error {
+	recording, err := server.LoadRecording(a.File)
+	if err != nil {
+		return err
+	}
+
+	if recording.Redacted {
+		return errors.New("redacted recordings can't be replayed")
+	}
+
+	if recording.Method == "" {
+		return errors.New("recording has no client request, it was made by an older version of rama-swap")
+	}
+
+	if recording.RequestTruncated {
+		return errors.New("the recorded request body was truncated, so it can't be replayed")
+	}
+
+	model := recording.Model
+	if a.Model != nil {
+		model = *a.Model
+	}
+
+	body := server.RecordedBody(recording.Request)
+
+	// point JSON requests at the chosen model, leaving other bodies as they were
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) == nil {
+		fields["model"], _ = json.Marshal(model)
+		if body, err = json.Marshal(fields); err != nil {
+			return err
+		}
+	}
+
+	request, err := http.NewRequest(recording.Method, a.URL+recording.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if recording.ContentType != "" {
+		request.Header.Set("Content-Type", recording.ContentType)
+	}
+
+	if a.APIKey != nil {
+		request.Header.Set("Authorization", "Bearer "+*a.APIKey)
+	}
+
+	fmt.Fprintf(os.Stderr, "Replaying %s %s (%s, recorded %s) with %s\n", recording.Method, recording.Endpoint, recording.Model, recording.Time.Format(time.RFC3339), model)
+
+	start := time.Now()
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	firstByte := time.Since(start)
+
+	if _, err := io.Copy(os.Stdout, response.Body); err != nil {
+		return err
+	}
+	total := time.Since(start)
+
+	fmt.Fprintf(os.Stderr, "\nStatus %d (recorded %d)\n", response.StatusCode, recording.Status)
+	if len(recording.Exchanges) > 0 {
+		// exchange times are measured from the start of the client's request
+		fmt.Fprintf(os.Stderr, "First byte after %v (backend responded after %v)\n", firstByte.Round(time.Millisecond), recording.Exchanges[0].FirstByte.Round(time.Millisecond))
+	}
+	fmt.Fprintf(os.Stderr, "Finished after %v (recorded %v)\n", total.Round(time.Millisecond), recording.TotalDuration.Round(time.Millisecond))
+
+	return nil
+}
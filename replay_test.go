@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wk-y/rama-swap/server"
+)
+
+func TestParseReplayArgs(t *testing.T) {
+	a, err := parseReplayArgs([]string{"-url", "http://example.com:1234/", "-model", "m", "recording.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.URL != "http://example.com:1234" || a.Model == nil || *a.Model != "m" || a.APIKey != nil || a.File != "recording.json" {
+		t.Errorf("Unexpected arguments %+v", a)
+	}
+
+	for _, cli := range [][]string{
+		{},
+		{"a.json", "b.json"},
+		{"-url"},
+		{"-model", "a", "-model", "b", "recording.json"},
+		{"-unknown", "recording.json"},
+	} {
+		if _, err := parseReplayArgs(cli); err == nil {
+			t.Errorf("Expected %q to be rejected", cli)
+		}
+	}
+}
+
+// writeRecording saves recording to a file in a new temporary directory and returns its path.
+func writeRecording(t *testing.T, recording *server.Recording) string {
+	t.Helper()
+
+	data, err := json.Marshal(recording)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "recording.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReplaySendsClientRequest(t *testing.T) {
+	type seen struct {
+		method, path, contentType, authorization string
+		body                                     map[string]any
+	}
+	requests := make(chan seen, 1)
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := seen{method: r.Method, path: r.URL.Path, contentType: r.Header.Get("Content-Type"), authorization: r.Header.Get("Authorization")}
+		json.NewDecoder(r.Body).Decode(&got.body)
+		requests <- got
+		io.WriteString(w, "{}")
+	}))
+	defer target.Close()
+
+	// the backend was sent a translated request, which replay ignores
+	path := writeRecording(t, &server.Recording{
+		Model:       "recorded-model",
+		Method:      http.MethodPost,
+		Endpoint:    "/api/chat",
+		ContentType: "application/json",
+		Request:     json.RawMessage(`{"model":"recorded-model","messages":[{"role":"user","content":"hi"}]}`),
+		Exchanges: []*server.Exchange{{
+			Method:  http.MethodPost,
+			Path:    "/v1/chat/completions",
+			Request: json.RawMessage(`{"model":"recorded-model"}`),
+		}},
+	})
+
+	model, key := "other-model", "key"
+	if err := replay(replayArgs{URL: target.URL, Model: &model, APIKey: &key, File: path}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-requests
+	if got.method != http.MethodPost || got.path != "/api/chat" || got.contentType != "application/json" || got.authorization != "Bearer key" {
+		t.Errorf("Unexpected request %+v", got)
+	}
+	if got.body["model"] != "other-model" || got.body["messages"] == nil {
+		t.Errorf("Expected the client body with the chosen model, got %v", got.body)
+	}
+}
+
+func TestReplayRejects(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		recording *server.Recording
+		wantError string
+	}{
+		{
+			name:      "redacted",
+			recording: &server.Recording{Method: http.MethodPost, Endpoint: "/api/chat", Redacted: true},
+			wantError: "redacted",
+		},
+		{
+			name:      "truncated",
+			recording: &server.Recording{Method: http.MethodPost, Endpoint: "/api/chat", RequestTruncated: true},
+			wantError: "truncated",
+		},
+		{
+			name:      "no client request",
+			recording: &server.Recording{Exchanges: []*server.Exchange{{Method: http.MethodPost, Path: "/v1/chat/completions"}}},
+			wantError: "no client request",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := replay(replayArgs{URL: "http://127.0.0.1:1", File: writeRecording(t, tc.recording)})
+			if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Expected an error containing %q, got %v", tc.wantError, err)
+			}
+		})
+	}
+}
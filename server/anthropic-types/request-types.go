@@ -0,0 +1,76 @@
+package anthropictypes
+
+import "encoding/json"
+
+// Request is a request to create a message.
+type Request struct {
+	Model         string          `json:"model"`
+	MaxTokens     int64           `json:"max_tokens"`
+	System        json.RawMessage `json:"system"` // a string, or a list of text ContentBlock
+	Messages      []Message       `json:"messages"`
+	StopSequences []string        `json:"stop_sequences"`
+	Stream        bool            `json:"stream"`
+
+	Temperature *float64 `json:"temperature"`
+	TopP        *float64 `json:"top_p"`
+	TopK        *int64   `json:"top_k"`
+
+	Tools      []Tool      `json:"tools"`
+	ToolChoice *ToolChoice `json:"tool_choice"`
+	Thinking   *Thinking   `json:"thinking"`
+}
+
+type Message struct {
+	Role    string          `json:"role"`    // "user" or "assistant"
+	Content json.RawMessage `json:"content"` // a string, or a list of ContentBlock
+}
+
+// ContentBlock is a part of a message's content.
+// Fields that don't apply to the block's type are left empty.
+type ContentBlock struct {
+	Type string `json:"type"` // "text", "image", "tool_use", "tool_result", "thinking" or "redacted_thinking"
+
+	// text
+	Text string `json:"text"`
+
+	// image
+	Source *ImageSource `json:"source"`
+
+	// tool_use
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+
+	// tool_result
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"` // a string, or a list of text ContentBlock
+	IsError   bool            `json:"is_error"`
+
+	// thinking
+	Thinking string `json:"thinking"`
+}
+
+type ImageSource struct {
+	Type      string `json:"type"` // "base64" or "url"
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+	URL       string `json:"url"`
+}
+
+type Tool struct {
+	Type        string         `json:"type"` // empty or "custom", server tools are not supported
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type ToolChoice struct {
+	Type                   string `json:"type"` // "auto", "any", "tool" or "none"
+	Name                   string `json:"name"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use"`
+}
+
+type Thinking struct {
+	Type         string `json:"type"` // "enabled" or "disabled"
+	BudgetTokens int64  `json:"budget_tokens"`
+}
@@ -0,0 +1,93 @@
+package anthropictypes
+
+import "encoding/json"
+
+type Response struct {
+	ID           string           `json:"id"`
+	Type         string           `json:"type"` // must equal "message"
+	Role         string           `json:"role"` // must equal "assistant"
+	Model        string           `json:"model"`
+	Content      []*ResponseBlock `json:"content"`
+	StopReason   *string          `json:"stop_reason"` // "end_turn", "max_tokens", "stop_sequence" or "tool_use"
+	StopSequence *string          `json:"stop_sequence"`
+	Usage        Usage            `json:"usage"`
+}
+
+// ResponseBlock is a part of a response's content.
+type ResponseBlock struct {
+	Type string // "text", "thinking" or "tool_use"
+
+	Text     string
+	Thinking string
+
+	ID    string
+	Name  string
+	Input json.RawMessage
+}
+
+// MarshalJSON implements json.Marshaler, leaving out fields that don't apply to the block's type.
+func (b ResponseBlock) MarshalJSON() ([]byte, error) {
+	switch b.Type {
+	case "thinking":
+		return json.Marshal(struct {
+			Type      string `json:"type"`
+			Thinking  string `json:"thinking"`
+			Signature string `json:"signature"`
+		}{b.Type, b.Thinking, ""})
+
+	case "tool_use":
+		input := b.Input
+		if len(input) == 0 {
+			input = json.RawMessage("{}")
+		}
+		return json.Marshal(struct {
+			Type  string          `json:"type"`
+			ID    string          `json:"id"`
+			Name  string          `json:"name"`
+			Input json.RawMessage `json:"input"`
+		}{b.Type, b.ID, b.Name, input})
+
+	default:
+		return json.Marshal(struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}{b.Type, b.Text})
+	}
+}
+
+type Usage struct {
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+}
+
+// StreamEvent is a server-sent event of a streamed message.
+// Fields that don't apply to the event's type are left empty.
+type StreamEvent struct {
+	Type string `json:"type"`
+
+	Message      *Response      `json:"message,omitempty"`
+	Index        *int           `json:"index,omitempty"`
+	ContentBlock *ResponseBlock `json:"content_block,omitempty"`
+	Delta        any            `json:"delta,omitempty"` // a BlockDelta or MessageDelta
+	Usage        *Usage         `json:"usage,omitempty"`
+	Error        *Error         `json:"error,omitempty"`
+}
+
+// BlockDelta is the delta of a content_block_delta event.
+type BlockDelta struct {
+	Type        string `json:"type"` // "text_delta", "thinking_delta" or "input_json_delta"
+	Text        string `json:"text,omitempty"`
+	Thinking    string `json:"thinking,omitempty"`
+	PartialJSON string `json:"partial_json,omitempty"`
+}
+
+// MessageDelta is the delta of a message_delta event.
+type MessageDelta struct {
+	StopReason   *string `json:"stop_reason"`
+	StopSequence *string `json:"stop_sequence"`
+}
+
+type Error struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,532 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/openai/openai-go/v2"
+	"github.com/openai/openai-go/v2/packages/param"
+	"github.com/openai/openai-go/v2/shared"
+	anthropictypes "github.com/wk-y/rama-swap/server/anthropic-types"
+)
+
+// anthropicMessages implements the Anthropic Messages API by translating it to a chat completion.
+func (s *Server) anthropicMessages(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.URL)
+
+	var request anthropictypes.Request
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Model == "" {
+		log.Println("Bad messages request:", err)
+		writeError(w, r, errBadRequest("invalid request JSON"))
+		return
+	}
+
+	params, err := anthropicTranslateParams(request)
+	if err != nil {
+		log.Printf("Failed to translate request: %v\n", err)
+		writeError(w, r, errBadRequest(fmt.Sprintf("failed to translate request: %v", err)))
+		return
+	}
+
+	if err := authorizeModel(r, request.Model); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	requestUsageOf(r).SetModel(request.Model)
+
+	backendModel, err := s.scheduler.Lock(r.Context(), request.Model)
+	if err != nil {
+		log.Printf("Failed to start model %s: %v\n", request.Model, err)
+		writeError(w, r, err)
+		return
+	}
+	defer s.scheduler.Unlock(backendModel)
+
+	builder := newAnthropicBuilder(request, s.StripThinkTags)
+
+	if request.Stream {
+		s.anthropicStreamMessage(w, r, backendModel.WithClient, builder, params)
+	} else {
+		s.anthropicCompleteMessage(w, r, backendModel.WithClient, builder, params)
+	}
+}
+
+// anthropicCompleteMessage gets the whole completion from the backend and replies with the message.
+func (s *Server) anthropicCompleteMessage(w http.ResponseWriter, r *http.Request, withClient func(func(openai.Client) error) error, builder *anthropicBuilder, params openai.ChatCompletionNewParams) {
+	if err := completeChat(r, withClient, builder, params); err != nil {
+		log.Println("Error during chat completion:", err)
+		writeError(w, r, errBackend(fmt.Sprintf("model backend failed: %v", err)))
+		return
+	}
+
+	usage := builder.response.Usage
+	requestUsageOf(r).AddTokens(usage.InputTokens, usage.OutputTokens)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(builder.response); err != nil {
+		log.Printf("Failed to reply: %v\n", err)
+	}
+}
+
+// anthropicStreamMessage streams the completion from the backend as Anthropic server-sent events.
+func (s *Server) anthropicStreamMessage(w http.ResponseWriter, r *http.Request, withClient func(func(openai.Client) error) error, builder *anthropicBuilder, params openai.ChatCompletionNewParams) {
+	started, err := streamChat(r, withClient, builder, params, func() {
+		send := sseWriter(w)
+		builder.emit = func(event anthropictypes.StreamEvent) error {
+			return send(event.Type, event)
+		}
+		builder.start()
+	})
+	if err != nil {
+		log.Println("Error during message stream:", err)
+		if !started {
+			writeError(w, r, errBackend(fmt.Sprintf("model backend failed: %v", err)))
+			return
+		}
+	}
+
+	if builder.err != nil {
+		log.Printf("Failed to send message events: %v\n", builder.err)
+	}
+
+	usage := builder.response.Usage
+	requestUsageOf(r).AddTokens(usage.InputTokens, usage.OutputTokens)
+}
+
+// anthropicBuilder builds a message from chat completion deltas,
+// emitting the corresponding stream events if emit is set.
+type anthropicBuilder struct {
+	response *anthropictypes.Response
+
+	// emit sends an event to the client, and is nil when not streaming
+	emit func(anthropictypes.StreamEvent) error
+	err  error // first error returned by emit, after which nothing more is emitted
+
+	stripThinkTags bool
+	splitter       thinkSplitter
+
+	open      *anthropictypes.ResponseBlock // the block being streamed, if any
+	calls     map[int64]*anthropictypes.ResponseBlock
+	arguments map[*anthropictypes.ResponseBlock]*strings.Builder
+}
+
+func newAnthropicBuilder(request anthropictypes.Request, stripThinkTags bool) *anthropicBuilder {
+	return &anthropicBuilder{
+		response: &anthropictypes.Response{
+			ID:      newResponseID("msg"),
+			Type:    "message",
+			Role:    "assistant",
+			Model:   request.Model,
+			Content: []*anthropictypes.ResponseBlock{},
+		},
+		stripThinkTags: stripThinkTags,
+		calls:          map[int64]*anthropictypes.ResponseBlock{},
+		arguments:      map[*anthropictypes.ResponseBlock]*strings.Builder{},
+	}
+}
+
+func (b *anthropicBuilder) send(event anthropictypes.StreamEvent) {
+	if b.emit == nil || b.err != nil {
+		return
+	}
+
+	b.err = b.emit(event)
+}
+
+// start sends the event that begins a message.
+func (b *anthropicBuilder) start() {
+	b.send(anthropictypes.StreamEvent{Type: "message_start", Message: b.response})
+}
+
+// openBlock closes the open block and starts block.
+func (b *anthropicBuilder) openBlock(block *anthropictypes.ResponseBlock) {
+	b.closeBlock()
+
+	b.response.Content = append(b.response.Content, block)
+	b.open = block
+
+	index := len(b.response.Content) - 1
+	b.send(anthropictypes.StreamEvent{Type: "content_block_start", Index: &index, ContentBlock: block})
+}
+
+// closeBlock stops the open block, if any.
+func (b *anthropicBuilder) closeBlock() {
+	if b.open == nil {
+		return
+	}
+
+	index := len(b.response.Content) - 1
+	b.send(anthropictypes.StreamEvent{Type: "content_block_stop", Index: &index})
+	b.open = nil
+}
+
+// sendDelta sends a delta for the open block.
+func (b *anthropicBuilder) sendDelta(delta anthropictypes.BlockDelta) {
+	index := len(b.response.Content) - 1
+	b.send(anthropictypes.StreamEvent{Type: "content_block_delta", Index: &index, Delta: delta})
+}
+
+// addThinking appends reasoning to the message.
+func (b *anthropicBuilder) addThinking(text string) {
+	if text == "" {
+		return
+	}
+
+	if b.open == nil || b.open.Type != "thinking" {
+		b.openBlock(&anthropictypes.ResponseBlock{Type: "thinking"})
+	}
+
+	b.open.Thinking += text
+	b.sendDelta(anthropictypes.BlockDelta{Type: "thinking_delta", Thinking: text})
+}
+
+// addText appends text to the message.
+func (b *anthropicBuilder) addText(text string) {
+	if b.stripThinkTags {
+		var thinking string
+		text, thinking = b.splitter.Next(text)
+		b.addThinking(thinking)
+	}
+
+	if text == "" {
+		return
+	}
+
+	if b.open == nil || b.open.Type != "text" {
+		b.openBlock(&anthropictypes.ResponseBlock{Type: "text"})
+	}
+
+	b.open.Text += text
+	b.sendDelta(anthropictypes.BlockDelta{Type: "text_delta", Text: text})
+}
+
+// addToolCall appends to the tool call with the given index.
+// id and name are only needed for the first part of each call.
+// Arguments for a call whose block has already been closed are not streamed,
+// since Anthropic's blocks are streamed one at a time.
+func (b *anthropicBuilder) addToolCall(index int64, id, name, arguments string) {
+	call, ok := b.calls[index]
+	if !ok {
+		if id == "" {
+			id = newResponseID("toolu")
+		}
+
+		call = &anthropictypes.ResponseBlock{Type: "tool_use", ID: id, Name: name}
+		b.calls[index] = call
+		b.arguments[call] = &strings.Builder{}
+		b.openBlock(call)
+	}
+
+	if arguments == "" {
+		return
+	}
+
+	b.arguments[call].WriteString(arguments)
+	if b.open == call {
+		b.sendDelta(anthropictypes.BlockDelta{Type: "input_json_delta", PartialJSON: arguments})
+	}
+}
+
+// stopped returns whether emitting an event failed.
+func (b *anthropicBuilder) stopped() bool {
+	return b.err != nil
+}
+
+// setUsage sets the message's token usage.
+func (b *anthropicBuilder) setUsage(usage openai.CompletionUsage) {
+	b.response.Usage = anthropictypes.Usage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+	}
+}
+
+// closeAll closes the open block, and fills in the input of tool calls.
+func (b *anthropicBuilder) closeAll() {
+	if content, thinking := b.splitter.Flush(); content != "" || thinking != "" {
+		b.stripThinkTags = false // the splitter is done
+		b.addThinking(thinking)
+		b.addText(content)
+	}
+
+	b.closeBlock()
+
+	for call, arguments := range b.arguments {
+		if json.Valid([]byte(arguments.String())) {
+			call.Input = json.RawMessage(arguments.String())
+		}
+	}
+}
+
+// finish completes the message, given the chat completion's finish reason.
+func (b *anthropicBuilder) finish(finishReason string) {
+	b.closeAll()
+
+	stopReason := anthropicStopReason(finishReason)
+	b.response.StopReason = &stopReason
+
+	b.send(anthropictypes.StreamEvent{
+		Type:  "message_delta",
+		Delta: anthropictypes.MessageDelta{StopReason: &stopReason},
+		Usage: &b.response.Usage,
+	})
+	b.send(anthropictypes.StreamEvent{Type: "message_stop"})
+}
+
+// fail ends the message stream with an error.
+func (b *anthropicBuilder) fail(err error) {
+	b.closeAll()
+
+	b.send(anthropictypes.StreamEvent{
+		Type: "error",
+		Error: &anthropictypes.Error{
+			Type:    "api_error",
+			Message: fmt.Sprintf("model backend failed: %v", err),
+		},
+	})
+}
+
+var _ chatBuilder = (*anthropicBuilder)(nil)
+
+// anthropicStopReason converts a chat completion finish reason into a stop reason.
+// llama-server doesn't report which stop sequence was hit, so stop_sequence is never returned.
+func anthropicStopReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls":
+		return "tool_use"
+	default:
+		return "end_turn"
+	}
+}
+
+// anthropicTranslateParams translates an Anthropic request into a chat completion request.
+func anthropicTranslateParams(request anthropictypes.Request) (completion openai.ChatCompletionNewParams, err error) {
+	completion.Model = request.Model
+
+	if len(request.System) > 0 {
+		system, err := anthropicContentText(request.System)
+		if err != nil {
+			return completion, fmt.Errorf("system: %v", err)
+		}
+		completion.Messages = append(completion.Messages, openai.SystemMessage(system))
+	}
+
+	for i, message := range request.Messages {
+		messages, err := anthropicTranslateMessage(message)
+		if err != nil {
+			return completion, fmt.Errorf("message %d: %v", i, err)
+		}
+		completion.Messages = append(completion.Messages, messages...)
+	}
+
+	for _, tool := range request.Tools {
+		if tool.Type != "" && tool.Type != "custom" {
+			return completion, fmt.Errorf("unsupported tool type %q, only custom tools are supported", tool.Type)
+		}
+
+		function := shared.FunctionDefinitionParam{
+			Name:       tool.Name,
+			Parameters: tool.InputSchema,
+		}
+		if tool.Description != "" {
+			function.Description = openai.String(tool.Description)
+		}
+
+		completion.Tools = append(completion.Tools, openai.ChatCompletionFunctionTool(function))
+	}
+
+	if choice := request.ToolChoice; choice != nil {
+		switch choice.Type {
+		case "auto", "none":
+			completion.ToolChoice.OfAuto = param.NewOpt(choice.Type)
+		case "any":
+			completion.ToolChoice.OfAuto = param.NewOpt("required")
+		case "tool":
+			completion.ToolChoice.OfFunctionToolChoice = &openai.ChatCompletionNamedToolChoiceParam{
+				Function: openai.ChatCompletionNamedToolChoiceFunctionParam{Name: choice.Name},
+			}
+		default:
+			return completion, fmt.Errorf("unsupported tool_choice %q", choice.Type)
+		}
+
+		if choice.DisableParallelToolUse {
+			completion.ParallelToolCalls = openai.Bool(false)
+		}
+	}
+
+	if len(request.StopSequences) > 0 {
+		completion.Stop.OfStringArray = request.StopSequences
+	}
+
+	if request.MaxTokens > 0 {
+		completion.MaxCompletionTokens = openai.Int(request.MaxTokens)
+	}
+
+	if request.Temperature != nil {
+		completion.Temperature = openai.Float(*request.Temperature)
+	}
+
+	if request.TopP != nil {
+		completion.TopP = openai.Float(*request.TopP)
+	}
+
+	extraFields := map[string]any{}
+
+	if request.TopK != nil {
+		// understood by llama-server
+		extraFields["top_k"] = *request.TopK
+	}
+
+	if request.Thinking != nil && request.Thinking.Type == "disabled" {
+		// understood by llama-server and the chat templates of most reasoning models
+		extraFields["chat_template_kwargs"] = map[string]any{"enable_thinking": false}
+	}
+
+	if len(extraFields) > 0 {
+		completion.SetExtraFields(extraFields)
+	}
+
+	return completion, nil
+}
+
+// anthropicTranslateMessage translates an Anthropic message into chat messages.
+// Tool results become tool messages, which come before the rest of the user's message.
+func anthropicTranslateMessage(message anthropictypes.Message) ([]openai.ChatCompletionMessageParamUnion, error) {
+	var text string
+	if err := json.Unmarshal(message.Content, &text); err == nil {
+		switch message.Role {
+		case "user":
+			return []openai.ChatCompletionMessageParamUnion{openai.UserMessage(text)}, nil
+		case "assistant":
+			return []openai.ChatCompletionMessageParamUnion{openai.AssistantMessage(text)}, nil
+		default:
+			return nil, fmt.Errorf("unsupported role %q", message.Role)
+		}
+	}
+
+	var blocks []anthropictypes.ContentBlock
+	if err := json.Unmarshal(message.Content, &blocks); err != nil {
+		return nil, fmt.Errorf("invalid content: %v", err)
+	}
+
+	switch message.Role {
+	case "user":
+		var messages []openai.ChatCompletionMessageParamUnion
+		var content []openai.ChatCompletionContentPartUnionParam
+
+		for _, block := range blocks {
+			switch block.Type {
+			case "text":
+				content = append(content, openai.TextContentPart(block.Text))
+
+			case "image":
+				uri, err := anthropicImageURL(block.Source)
+				if err != nil {
+					return nil, err
+				}
+				content = append(content, openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{URL: uri}))
+
+			case "tool_result":
+				var output string
+				if len(block.Content) > 0 {
+					var err error
+					if output, err = anthropicContentText(block.Content); err != nil {
+						return nil, fmt.Errorf("tool_result: %v", err)
+					}
+				}
+				messages = append(messages, openai.ToolMessage(output, block.ToolUseID))
+
+			default:
+				return nil, fmt.Errorf("unsupported content type %q", block.Type)
+			}
+		}
+
+		if len(content) > 0 {
+			messages = append(messages, openai.UserMessage(content))
+		}
+		return messages, nil
+
+	case "assistant":
+		var text strings.Builder
+		var calls []openai.ChatCompletionMessageToolCallUnionParam
+
+		for _, block := range blocks {
+			switch block.Type {
+			case "text":
+				text.WriteString(block.Text)
+
+			case "tool_use":
+				arguments := string(block.Input)
+				if arguments == "" {
+					arguments = "{}"
+				}
+				calls = append(calls, openai.ChatCompletionMessageToolCallUnionParam{
+					OfFunction: &openai.ChatCompletionMessageFunctionToolCallParam{
+						ID: block.ID,
+						Function: openai.ChatCompletionMessageFunctionToolCallFunctionParam{
+							Name:      block.Name,
+							Arguments: arguments,
+						},
+					},
+				})
+
+			case "thinking", "redacted_thinking":
+				// backends don't use the reasoning of previous turns
+
+			default:
+				return nil, fmt.Errorf("unsupported content type %q", block.Type)
+			}
+		}
+
+		message := openai.AssistantMessage(text.String())
+		message.OfAssistant.ToolCalls = calls
+		return []openai.ChatCompletionMessageParamUnion{message}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported role %q", message.Role)
+	}
+}
+
+// anthropicImageURL returns a URL for an image source, which may be a data URI.
+func anthropicImageURL(source *anthropictypes.ImageSource) (string, error) {
+	if source == nil {
+		return "", errors.New("image is missing its source")
+	}
+
+	switch source.Type {
+	case "base64":
+		return "data:" + source.MediaType + ";base64," + source.Data, nil
+	case "url":
+		return source.URL, nil
+	default:
+		return "", fmt.Errorf("unsupported image source type %q", source.Type)
+	}
+}
+
+// anthropicContentText returns the text of content, which is a string or a list of text blocks.
+func anthropicContentText(content json.RawMessage) (string, error) {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text, nil
+	}
+
+	var blocks []anthropictypes.ContentBlock
+	if err := json.Unmarshal(content, &blocks); err != nil {
+		return "", fmt.Errorf("invalid content: %v", err)
+	}
+
+	var texts strings.Builder
+	for _, block := range blocks {
+		if block.Type != "text" {
+			return "", fmt.Errorf("unsupported content type %q, only text is supported", block.Type)
+		}
+		texts.WriteString(block.Text)
+	}
+	return texts.String(), nil
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	anthropictypes "github.com/wk-y/rama-swap/server/anthropic-types"
+)
+
+func TestAnthropicTranslateParams(t *testing.T) {
+	var request anthropictypes.Request
+	err := json.Unmarshal([]byte(`{
+		"model": "m",
+		"max_tokens": 100,
+		"system": [{"type": "text", "text": "be brief"}],
+		"stop_sequences": ["END"],
+		"messages": [
+			{"role": "user", "content": [
+				{"type": "text", "text": "what is in this image?"},
+				{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "AAAA"}}
+			]},
+			{"role": "assistant", "content": [
+				{"type": "thinking", "thinking": "hmm"},
+				{"type": "tool_use", "id": "a", "name": "look", "input": {"x": 1}}
+			]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "a", "content": [{"type": "text", "text": "a cat"}]},
+				{"type": "text", "text": "thanks"}
+			]}
+		],
+		"tools": [{"name": "look", "input_schema": {"type": "object"}}],
+		"tool_choice": {"type": "any"}
+	}`), &request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := anthropicTranslateParams(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(params.Messages) != 5 {
+		t.Fatalf("Expected 5 messages, got %d", len(params.Messages))
+	}
+
+	if params.Messages[0].OfSystem == nil || params.Messages[1].OfUser == nil || params.Messages[3].OfTool == nil || params.Messages[4].OfUser == nil {
+		t.Error("Unexpected message roles, tool results should come before the rest of the user's message")
+	}
+
+	assistant := params.Messages[2].OfAssistant
+	if assistant == nil || len(assistant.ToolCalls) != 1 || assistant.ToolCalls[0].OfFunction.Function.Arguments != `{"x": 1}` {
+		t.Error("Expected the tool use to be translated into a tool call")
+	}
+
+	if len(params.Tools) != 1 || params.ToolChoice.OfAuto.Value != "required" {
+		t.Error("Expected the tool and tool choice to be translated")
+	}
+
+	if len(params.Stop.OfStringArray) != 1 || params.MaxCompletionTokens.Value != 100 {
+		t.Error("Expected stop sequences and max tokens to be translated")
+	}
+}
+
+func TestAnthropicBuilderToolUse(t *testing.T) {
+	var events []anthropictypes.StreamEvent
+	builder := newAnthropicBuilder(anthropictypes.Request{Model: "m"}, false)
+	builder.emit = func(event anthropictypes.StreamEvent) error {
+		events = append(events, event)
+		return nil
+	}
+
+	builder.start()
+	builder.addText("let me check")
+	builder.addToolCall(0, "call_1", "look", `{"x"`)
+	builder.addToolCall(0, "", "", `: 1}`)
+	builder.finish("tool_calls")
+
+	content := builder.response.Content
+	if len(content) != 2 || content[0].Text != "let me check" || string(content[1].Input) != `{"x": 1}` {
+		t.Errorf("Unexpected content %+v", content)
+	}
+
+	if *builder.response.StopReason != "tool_use" {
+		t.Errorf("Expected stop reason tool_use, got %s", *builder.response.StopReason)
+	}
+
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	expected := []string{
+		"message_start",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_delta", "content_block_stop",
+		"message_delta", "message_stop",
+	}
+	if !slices.Equal(types, expected) {
+		t.Errorf("Expected events %v, got %v", expected, types)
+	}
+}
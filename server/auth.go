@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/wk-y/rama-swap/ramalama"
+)
+
+// APIKey is a bearer token accepted by the server.
+type APIKey struct {
+	Name      string   `json:"name"`      // identity recorded in logs and metrics
+	Key       string   `json:"key"`       // bearer token
+	Models    []string `json:"models"`    // allowed models, or all models if empty
+	Endpoints []string `json:"endpoints"` // allowed endpoint paths and the paths below them, or all endpoints if empty
+
+	RateLimits *RateLimits `json:"limits"` // overrides the server's default rate limits
+	Admin      bool        `json:"admin"`  // allows access to /admin endpoints
+}
+
+// LoadAPIKeys reads a JSON array of APIKey from path.
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var keys []APIKey
+	if err := json.NewDecoder(f).Decode(&keys); err != nil {
+		return nil, fmt.Errorf("failed to parse api keys: %v", err)
+	}
+
+	for i, key := range keys {
+		if key.Key == "" {
+			return nil, fmt.Errorf("api key %d has an empty key", i)
+		}
+		if key.Name == "" {
+			keys[i].Name = fmt.Sprintf("key-%d", i)
+		}
+	}
+
+	return keys, nil
+}
+
+// ParseAPIKeys parses a comma separated list of keys with unrestricted access.
+func ParseAPIKeys(list string) []APIKey {
+	var keys []APIKey
+	for key := range strings.SplitSeq(list, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		keys = append(keys, APIKey{
+			Name: fmt.Sprintf("env-%d", len(keys)),
+			Key:  key,
+		})
+	}
+	return keys
+}
+
+func (k *APIKey) allowsModel(model string) bool {
+	return len(k.Models) == 0 || slices.Contains(k.Models, model)
+}
+
+func (k *APIKey) allowsEndpoint(path string) bool {
+	if len(k.Endpoints) == 0 {
+		return true
+	}
+
+	for _, endpoint := range k.Endpoints {
+		if pathHasPrefix(path, endpoint) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathHasPrefix returns whether path is prefix or lies below it, matching whole path segments.
+func pathHasPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// requestKey returns the API key used to authenticate r, or nil if authentication is disabled.
+func requestKey(r *http.Request) *APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*APIKey)
+	return key
+}
+
+// unauthenticatedClient is the client identity that rejected requests are counted under in metrics.
+const unauthenticatedClient = "unauthenticated"
+
+// publicPaths are served without an API key.
+// The dashboard page holds no data, and asks for a key to send with its own requests.
+var publicPaths = []string{"/dashboard/"}
+
+// authenticate wraps next with bearer token authentication.
+// If no API keys are configured, all requests are allowed.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.APIKeys) == 0 || (r.Method == http.MethodGet && slices.Contains(publicPaths, r.URL.Path)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			token = r.Header.Get("X-Api-Key")
+		}
+
+		var key *APIKey
+		for i := range s.APIKeys {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.APIKeys[i].Key)) == 1 {
+				key = &s.APIKeys[i]
+				break
+			}
+		}
+
+		if token == "" || key == nil {
+			log.Printf("Rejected unauthenticated request from %s: %s %s\n", r.RemoteAddr, r.Method, r.URL)
+			s.metrics.record(unauthenticatedClient, http.StatusUnauthorized, 0, 0)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, r, &apiError{
+				Status:  http.StatusUnauthorized,
+				Message: "missing or invalid api key",
+				Type:    "invalid_request_error",
+				Code:    "invalid_api_key",
+			})
+			return
+		}
+
+		if !key.allowsEndpoint(r.URL.Path) {
+			log.Printf("Key %q denied access to endpoint %s\n", key.Name, r.URL.Path)
+			writeError(w, r, errForbidden("api key is not allowed to access this endpoint"))
+			return
+		}
+
+		log.Printf("Key %q: %s %s\n", key.Name, r.Method, r.URL)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey, key)))
+	})
+}
+
+// authorizeModel checks that the request's API key may use model.
+func authorizeModel(r *http.Request, model string) error {
+	key := requestKey(r)
+	if key == nil || key.allowsModel(model) {
+		return nil
+	}
+
+	log.Printf("Key %q denied access to model %s\n", key.Name, model)
+	return errForbidden(fmt.Sprintf("api key is not allowed to use model %q", model))
+}
+
+// filterAllowedModels returns the models the request's API key may use.
+func filterAllowedModels(r *http.Request, models []ramalama.Model) []ramalama.Model {
+	key := requestKey(r)
+	if key == nil {
+		return models
+	}
+
+	return slices.DeleteFunc(slices.Clone(models), func(model ramalama.Model) bool {
+		return !key.allowsModel(model.Name)
+	})
+}
+
+// isAdmin returns whether r may use administration endpoints.
+// Every request is an admin request when authentication is disabled.
+func isAdmin(r *http.Request) bool {
+	key := requestKey(r)
+	return key == nil || key.Admin
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/wk-y/rama-swap/ramalama"
+)
+
+func TestAuthenticate(t *testing.T) {
+	s := NewServer(nil, nil)
+	s.APIKeys = []APIKey{
+		{Name: "full", Key: "secret-full"},
+		{Name: "embedder", Key: "secret-embed", Endpoints: []string{"/v1/embeddings", "/v1/models/"}},
+	}
+
+	var seen *APIKey
+	handler := s.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestKey(r)
+	}))
+
+	for _, tc := range []struct {
+		name   string
+		path   string
+		header string
+		value  string
+		status int
+		key    string
+	}{
+		{"missing", "/v1/models", "", "", http.StatusUnauthorized, ""},
+		{"invalid", "/v1/models", "Authorization", "Bearer wrong", http.StatusUnauthorized, ""},
+		{"not bearer", "/v1/models", "Authorization", "secret-full", http.StatusUnauthorized, ""},
+		{"bearer", "/v1/models", "Authorization", "Bearer secret-full", http.StatusOK, "full"},
+		{"x-api-key", "/v1/models", "X-Api-Key", "secret-full", http.StatusOK, "full"},
+		{"allowed endpoint", "/v1/embeddings", "Authorization", "Bearer secret-embed", http.StatusOK, "embedder"},
+		{"allowed subpath", "/v1/models/m", "Authorization", "Bearer secret-embed", http.StatusOK, "embedder"},
+		{"allowed directory", "/v1/models", "Authorization", "Bearer secret-embed", http.StatusOK, "embedder"},
+		{"denied endpoint", "/v1/chat/completions", "Authorization", "Bearer secret-embed", http.StatusForbidden, ""},
+		{"denied partial segment", "/v1/embeddings-old", "Authorization", "Bearer secret-embed", http.StatusForbidden, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			seen = nil
+
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.header != "" {
+				r.Header.Set(tc.header, tc.value)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tc.status {
+				t.Errorf("Expected status %d, got %d: %s", tc.status, w.Code, w.Body)
+			}
+
+			var name string
+			if seen != nil {
+				name = seen.Name
+			}
+			if name != tc.key {
+				t.Errorf("Expected the handler to see key %q, got %q", tc.key, name)
+			}
+
+			if tc.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Errorf("Expected a WWW-Authenticate header")
+			}
+		})
+	}
+
+	clients := s.metrics.snapshot()
+	if i := slices.IndexFunc(clients, func(c clientMetrics) bool { return c.Client == unauthenticatedClient }); i < 0 || clients[i].Requests != 3 {
+		t.Errorf("Expected 3 unauthenticated requests in the metrics, got %+v", clients)
+	}
+}
+
+func TestAuthenticateDisabled(t *testing.T) {
+	s := NewServer(nil, nil)
+
+	called := false
+	handler := s.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if requestKey(r) != nil || !isAdmin(r) {
+			t.Errorf("Expected an unauthenticated admin request")
+		}
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/admin/usage", nil))
+	if !called {
+		t.Errorf("Expected the request to be allowed")
+	}
+}
+
+// withKey returns a request authenticated with key.
+func withKey(key *APIKey) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if key == nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), apiKeyContextKey, key))
+}
+
+func TestAuthorizeModel(t *testing.T) {
+	restricted := &APIKey{Name: "restricted", Models: []string{"a"}}
+
+	if err := authorizeModel(withKey(nil), "b"); err != nil {
+		t.Errorf("Expected any model to be allowed without authentication, got %v", err)
+	}
+
+	if err := authorizeModel(withKey(&APIKey{Name: "full"}), "b"); err != nil {
+		t.Errorf("Expected a key without a model list to allow any model, got %v", err)
+	}
+
+	if err := authorizeModel(withKey(restricted), "a"); err != nil {
+		t.Errorf("Expected an allowed model to be authorized, got %v", err)
+	}
+
+	err := authorizeModel(withKey(restricted), "b")
+	if apiErr, ok := err.(*apiError); !ok || apiErr.Status != http.StatusForbidden {
+		t.Errorf("Expected a forbidden error, got %v", err)
+	}
+}
+
+func TestFilterAllowedModels(t *testing.T) {
+	models := []ramalama.Model{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	names := func(models []ramalama.Model) []string {
+		var names []string
+		for _, model := range models {
+			names = append(names, model.Name)
+		}
+		return names
+	}
+
+	if filtered := filterAllowedModels(withKey(nil), models); !slices.Equal(names(filtered), []string{"a", "b", "c"}) {
+		t.Errorf("Expected all models without authentication, got %v", names(filtered))
+	}
+
+	filtered := filterAllowedModels(withKey(&APIKey{Models: []string{"c", "a"}}), models)
+	if !slices.Equal(names(filtered), []string{"a", "c"}) {
+		t.Errorf("Expected only the allowed models, got %v", names(filtered))
+	}
+
+	if !slices.Equal(names(models), []string{"a", "b", "c"}) {
+		t.Errorf("Expected the original list to be unchanged, got %v", names(models))
+	}
+}
+
+func TestIsAdmin(t *testing.T) {
+	if !isAdmin(withKey(nil)) {
+		t.Errorf("Expected requests to be admin requests without authentication")
+	}
+
+	if isAdmin(withKey(&APIKey{Name: "user"})) {
+		t.Errorf("Expected a non-admin key not to be an admin")
+	}
+
+	if !isAdmin(withKey(&APIKey{Name: "admin", Admin: true})) {
+		t.Errorf("Expected an admin key to be an admin")
+	}
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/openai/openai-go/v2"
+	"github.com/openai/openai-go/v2/packages/ssestream"
+)
+
+// chatBuilder converts a chat completion into an endpoint's own response format as it arrives.
+type chatBuilder interface {
+	addThinking(text string)
+	addText(text string)
+
+	// addToolCall appends to the tool call with the given index.
+	// id and name are only needed for the first part of each call.
+	addToolCall(index int64, id, name, arguments string)
+
+	setUsage(usage openai.CompletionUsage)
+
+	// finish completes the response, given the chat completion's finish reason.
+	finish(finishReason string)
+
+	// fail ends the response with an error from the backend.
+	fail(err error)
+
+	// stopped returns whether the client can no longer be sent anything, which ends a stream early.
+	stopped() bool
+}
+
+// chunkObserver is implemented by chat builders that need more of each streamed chunk than its deltas.
+type chunkObserver interface {
+	observeChunk(chunk openai.ChatCompletionChunk)
+}
+
+// completionObserver is implemented by chat builders that need more of a whole completion than its message.
+type completionObserver interface {
+	observeCompletion(completion *openai.ChatCompletion)
+}
+
+// completeChat gets the whole completion from the backend and adds it to builder.
+// If the backend fails, nothing is added to builder and the error is left to the caller.
+func completeChat(r *http.Request, withClient func(func(openai.Client) error) error, builder chatBuilder, params openai.ChatCompletionNewParams) error {
+	var completion *openai.ChatCompletion
+	err := withClient(func(client openai.Client) (err error) {
+		completion, err = client.Chat.Completions.New(r.Context(), params, backendOptions(r)...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var finishReason string
+	if len(completion.Choices) > 0 {
+		choice := completion.Choices[0]
+		finishReason = choice.FinishReason
+
+		builder.addThinking(reasoningContent(choice.Message.JSON.ExtraFields))
+		builder.addText(choice.Message.Content)
+		for i, call := range choice.Message.ToolCalls {
+			builder.addToolCall(int64(i), call.ID, call.Function.Name, call.Function.Arguments)
+		}
+	}
+
+	builder.setUsage(completion.Usage)
+	if observer, ok := builder.(completionObserver); ok {
+		observer.observeCompletion(completion)
+	}
+	builder.finish(finishReason)
+	return nil
+}
+
+// streamChat streams the completion from the backend into builder.
+// begin is called when the first chunk arrives, before anything is added to builder,
+// so that a backend failing before then can still be reported as a normal error by the caller.
+// started is whether begin was called, after which errors are also passed to builder.fail.
+func streamChat(r *http.Request, withClient func(func(openai.Client) error) error, builder chatBuilder, params openai.ChatCompletionNewParams, begin func()) (started bool, err error) {
+	params.StreamOptions = openai.ChatCompletionStreamOptionsParam{
+		IncludeUsage: openai.Bool(true),
+	}
+
+	var stream *ssestream.Stream[openai.ChatCompletionChunk]
+	err = withClient(func(client openai.Client) error {
+		stream = client.Chat.Completions.NewStreaming(r.Context(), params, backendOptions(r)...)
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to model backend: %v", err)
+	}
+	defer stream.Close()
+
+	// wait for the first chunk, so that failures can still be reported as a normal error
+	hasChunk := stream.Next()
+	if !hasChunk && stream.Err() != nil {
+		return false, stream.Err()
+	}
+
+	begin()
+
+	observer, _ := builder.(chunkObserver)
+
+	var finishReason string
+	for ; hasChunk && !builder.stopped(); hasChunk = stream.Next() {
+		chunk := stream.Current()
+
+		if chunk.JSON.Usage.Valid() {
+			builder.setUsage(chunk.Usage)
+		}
+
+		if observer != nil {
+			observer.observeChunk(chunk)
+		}
+
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		choice := chunk.Choices[0]
+		if choice.FinishReason != "" {
+			finishReason = choice.FinishReason
+		}
+
+		builder.addThinking(reasoningContent(choice.Delta.JSON.ExtraFields))
+		builder.addText(choice.Delta.Content)
+		for _, call := range choice.Delta.ToolCalls {
+			builder.addToolCall(call.Index, call.ID, call.Function.Name, call.Function.Arguments)
+		}
+	}
+
+	if err := stream.Err(); err != nil {
+		builder.fail(err)
+		return true, err
+	}
+
+	builder.finish(finishReason)
+	return true, nil
+}
+
+// sseWriter sets up w for server-sent events, and returns a function that sends one.
+func sseWriter(w http.ResponseWriter) func(eventType string, event any) error {
+	responseController := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	return func(eventType string, event any) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, data); err != nil {
+			return err
+		}
+
+		// Flush to reduce stream latency. Whether it succeeds isn't important.
+		_ = responseController.Flush()
+		return nil
+	}
+}
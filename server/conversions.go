@@ -2,24 +2,86 @@ package server
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/wk-y/rama-swap/ramalama"
+	ollamatypes "github.com/wk-y/rama-swap/server/ollama-types"
 )
 
-func convertModelList(ramaModels []ramalama.Model) ([]Model, error) {
-	var models []Model
-	for _, ramaModel := range ramaModels {
-		t, err := time.Parse(time.RFC3339, ramaModel.Modified)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse model timestamp %#v: %v", ramaModel.Modified, err)
+func convertModel(ramaModel ramalama.Model, loaded []string) (Model, error) {
+	t, err := time.Parse(time.RFC3339, ramaModel.Modified)
+	if err != nil {
+		return Model{}, fmt.Errorf("failed to parse model timestamp %#v: %v", ramaModel.Modified, err)
+	}
+
+	status := "unloaded"
+	if slices.Contains(loaded, ramaModel.Name) {
+		status = "loaded"
+	}
+
+	return Model{
+		Id:      ramaModel.Name,
+		Object:  "model",
+		Created: int(t.Unix()),
+		OwnedBy: "rama-swap",
+		Status:  status,
+	}, nil
+}
+
+// addModelInfo fills in the fields of model that come from inspecting it.
+func addModelInfo(model *Model, info ramalama.InspectInfo) {
+	if info.Metadata.GeneralArchitecture != nil {
+		model.Architecture = *info.Metadata.GeneralArchitecture
+	}
+
+	if info.Metadata.GeneralSizeLabel != nil {
+		model.ParameterSize = *info.Metadata.GeneralSizeLabel
+	}
+
+	model.Quantization = info.Quantization()
+	model.ContextLength = info.Metadata.ContextLength()
+	model.MemoryEstimate = info.MemoryEstimate()
+}
+
+func ollamaModelDetails(info ramalama.InspectInfo) (details ollamatypes.ModelDetails) {
+	details.Format = strings.ToLower(info.Format)
+	if info.Metadata.GeneralArchitecture != nil {
+		details.Family = *info.Metadata.GeneralArchitecture
+		details.Families = []string{*info.Metadata.GeneralArchitecture}
+	}
+
+	if info.Metadata.GeneralSizeLabel != nil {
+		details.ParameterSize = *info.Metadata.GeneralSizeLabel
+	}
+
+	details.QuantizationLevel = info.Quantization()
+
+	// the model was pulled from a registry, so report where it came from
+	if info.Registry != "" {
+		details.ParentModel = info.Name
+		if !strings.Contains(info.Name, "://") {
+			details.ParentModel = info.Registry + "://" + info.Name
+		}
+	}
+
+	return
+}
+
+// ollamaCapabilities guesses what a model can be used for from its metadata.
+func ollamaCapabilities(info ramalama.InspectInfo) []string {
+	metadata := info.Metadata
+	if metadata.GeneralArchitecture != nil {
+		// embedding models declare how token embeddings are pooled
+		if _, ok := metadata.All[*metadata.GeneralArchitecture+".pooling_type"]; ok {
+			return []string{"embedding"}
 		}
-		models = append(models, Model{
-			Id:      ramaModel.Name,
-			Object:  "model",
-			Created: int(t.Unix()),
-			OwnedBy: "rama-swap",
-		})
-	}
-	return models, nil
+	}
+
+	capabilities := []string{"completion"}
+	if template, ok := metadata.All["tokenizer.chat_template"].(string); ok && strings.Contains(template, "tools") {
+		capabilities = append(capabilities, "tools")
+	}
+	return capabilities
 }
@@ -0,0 +1,204 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/wk-y/rama-swap/server/scheduler"
+)
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// dashboardModel is a model as listed by the dashboard.
+type dashboardModel struct {
+	Model
+	Upstream string `json:"upstream"` // path of the model's llama-server web UI
+}
+
+func (s *Server) serveDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardPage)
+}
+
+func (s *Server) dashboardModels(w http.ResponseWriter, r *http.Request) {
+	ramaModels, err := s.catalog.Models()
+	if err != nil {
+		log.Printf("Failed to get models: %v\n", err)
+		writeError(w, r, errInternal("failed to list models"))
+		return
+	}
+
+	loaded := s.scheduler.Loaded()
+
+	models := []dashboardModel{}
+	for _, ramaModel := range filterAllowedModels(r, ramaModels) {
+		model, err := s.openaiModel(ramaModel, loaded)
+		if err != nil {
+			log.Printf("Failed to convert model: %v\n", err)
+			writeError(w, r, errInternal("failed to convert model list"))
+			return
+		}
+
+		name := ramaModel.Name
+		if s.ModelNameMangler != nil {
+			name = s.ModelNameMangler(name)
+		}
+
+		models = append(models, dashboardModel{
+			Model:    model,
+			Upstream: "/upstream/" + name + "/",
+		})
+	}
+
+	w.Header().Add("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(models); err != nil {
+		log.Printf("Failed to reply: %v\n", err)
+	}
+}
+
+// dashboardEvents streams the scheduler status and backend logs as server-sent events.
+// Logs are only sent to admins, since they may reveal other clients' activity,
+// and the status only shows the models the client's API key may use.
+func (s *Server) dashboardEvents(w http.ResponseWriter, r *http.Request) {
+	responseController := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	sendLogs := isAdmin(r)
+	var lastLog uint64
+
+	send := func(event string, data any) error {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, encoded)
+		return err
+	}
+
+	// subscribe before reading the status and logs, so no change is missed
+	events, cancel := s.scheduler.Subscribe()
+	defer cancel()
+
+	var logLines <-chan scheduler.LogLine
+	if sendLogs {
+		lines, cancelLogs := s.scheduler.SubscribeLogs()
+		defer cancelLogs()
+		logLines = lines
+	}
+
+	// comments keep idle connections from being closed by proxies
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	updateStatus, updateLogs := true, sendLogs
+	for {
+		if updateStatus {
+			if err := send("status", visibleStatus(r, s.scheduler.Status())); err != nil {
+				return
+			}
+		}
+
+		if updateLogs {
+			for _, line := range s.scheduler.Logs(lastLog) {
+				if err := send("log", line); err != nil {
+					return
+				}
+				lastLog = line.Seq
+			}
+		}
+
+		if err := responseController.Flush(); err != nil {
+			log.Printf("Failed to flush dashboard events: %v\n", err)
+			return
+		}
+
+		updateStatus, updateLogs = false, false
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-events:
+			// the status is read again, so events that arrived meanwhile don't need their own update
+			for len(events) > 0 {
+				<-events
+			}
+			updateStatus = true
+		case <-logLines:
+			// likewise, every line since the last one sent is read from the buffer
+			for len(logLines) > 0 {
+				<-logLines
+			}
+			updateLogs = true
+		}
+	}
+}
+
+// visibleStatus hides the models r's API key may not use from status,
+// so clients can't see which models others are using.
+func visibleStatus(r *http.Request, status scheduler.Status) scheduler.Status {
+	key := requestKey(r)
+	if key == nil {
+		return status
+	}
+
+	visible := func(model string) bool {
+		return model == "" || key.allowsModel(model)
+	}
+
+	if !visible(status.Model) {
+		status.Model, status.State = "", ""
+	}
+	status.Swaps = slices.DeleteFunc(slices.Clone(status.Swaps), func(swap scheduler.Swap) bool {
+		return !visible(swap.From) || !visible(swap.To)
+	})
+	return status
+}
+
+// dashboardLoad loads the model named by the "model" field of the JSON body.
+func (s *Server) dashboardLoad(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Model string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Model == "" {
+		writeError(w, r, errBadRequest("missing or invalid 'model' key"))
+		return
+	}
+
+	if err := authorizeModel(r, request.Model); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	requestUsageOf(r).SetModel(request.Model)
+
+	backend, err := s.scheduler.Lock(r.Context(), request.Model)
+	if err != nil {
+		log.Printf("Failed to start model %s: %v\n", request.Model, err)
+		writeError(w, r, err)
+		return
+	}
+	s.scheduler.Unlock(backend)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// dashboardUnload stops the loaded model once it is no longer in use.
+func (s *Server) dashboardUnload(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		writeError(w, r, errForbidden("api key is not an admin key"))
+		return
+	}
+
+	s.scheduler.Unload("")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/wk-y/rama-swap/ramalama"
+	"github.com/wk-y/rama-swap/server/scheduler"
+)
+
+// apiError is an error that can be reported to API clients.
+type apiError struct {
+	Status  int    // HTTP status code
+	Message string // human-readable message
+	Type    string // OpenAI error type, e.g. "invalid_request_error"
+	Code    string // machine-readable error code
+}
+
+// Error implements error.
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+var _ error = (*apiError)(nil)
+
+func errBadRequest(message string) *apiError {
+	return &apiError{
+		Status:  http.StatusBadRequest,
+		Message: message,
+		Type:    "invalid_request_error",
+		Code:    "invalid_request",
+	}
+}
+
+func errForbidden(message string) *apiError {
+	return &apiError{
+		Status:  http.StatusForbidden,
+		Message: message,
+		Type:    "permission_error",
+		Code:    "forbidden",
+	}
+}
+
+func errInternal(message string) *apiError {
+	return &apiError{
+		Status:  http.StatusInternalServerError,
+		Message: message,
+		Type:    "server_error",
+		Code:    "internal_error",
+	}
+}
+
+func errUnknownEndpoint() *apiError {
+	return &apiError{
+		Status:  http.StatusNotFound,
+		Message: "unknown endpoint",
+		Type:    "invalid_request_error",
+		Code:    "unknown_endpoint",
+	}
+}
+
+func errBackend(message string) *apiError {
+	return &apiError{
+		Status:  http.StatusBadGateway,
+		Message: message,
+		Type:    "server_error",
+		Code:    "backend_error",
+	}
+}
+
+// toApiError converts err into an apiError, choosing a status code from the error's type.
+// Errors of unknown types are logged and reported as a generic internal error.
+func toApiError(err error) *apiError {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var notFound scheduler.ErrModelNotFound
+	var notInstalled ramalama.ErrModelNotFound
+	if errors.As(err, &notFound) || errors.As(err, &notInstalled) {
+		return &apiError{
+			Status:  http.StatusNotFound,
+			Message: err.Error(),
+			Type:    "invalid_request_error",
+			Code:    "model_not_found",
+		}
+	}
+
+	var backendFailed scheduler.ErrBackendFailed
+	if errors.As(err, &backendFailed) {
+		return errBackend(err.Error())
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return &apiError{
+			Status:  http.StatusServiceUnavailable,
+			Message: "timed out waiting for model to load",
+			Type:    "server_error",
+			Code:    "model_loading",
+		}
+	}
+
+	// other errors may describe internals that clients shouldn't see
+	log.Printf("Internal error: %v\n", err)
+	return errInternal("internal server error")
+}
+
+// writeError reports err to the client.
+// Requests under /api/ receive Ollama-style errors, requests to /v1/messages receive Anthropic-style errors,
+// and all others receive OpenAI-style errors.
+// It must be called before anything else is written to w.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := toApiError(err)
+
+	var body any
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		body = struct {
+			Error string `json:"error"`
+		}{apiErr.Message}
+	} else if r.URL.Path == "/v1/messages" {
+		type anthropicError struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		}
+		body = struct {
+			Type  string         `json:"type"`
+			Error anthropicError `json:"error"`
+		}{"error", anthropicError{
+			Type:    anthropicErrorType(apiErr),
+			Message: apiErr.Message,
+		}}
+	} else {
+		type openaiError struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+			Code    string `json:"code"`
+		}
+		body = struct {
+			Error openaiError `json:"error"`
+		}{openaiError{
+			Message: apiErr.Message,
+			Type:    apiErr.Type,
+			Code:    apiErr.Code,
+		}}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(apiErr.Status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to write error response: %v\n", err)
+	}
+}
+
+// anthropicErrorType returns the Anthropic error type closest to apiErr.
+func anthropicErrorType(apiErr *apiError) string {
+	switch apiErr.Status {
+	case http.StatusUnauthorized:
+		return "authentication_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusNotFound:
+		return "not_found_error"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case http.StatusServiceUnavailable:
+		return "overloaded_error"
+	}
+
+	if apiErr.Status >= 500 {
+		return "api_error"
+	}
+	return "invalid_request_error"
+}
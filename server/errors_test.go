@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/wk-y/rama-swap/ramalama"
+	"github.com/wk-y/rama-swap/server/scheduler"
+)
+
+func TestToApiError(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantCode    string
+		wantMessage string
+	}{
+		{
+			name:        "api error",
+			err:         fmt.Errorf("wrapped: %w", errBadRequest("bad field")),
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    "invalid_request",
+			wantMessage: "bad field",
+		},
+		{
+			name:        "unknown model",
+			err:         scheduler.ErrModelNotFound{Model: "m"},
+			wantStatus:  http.StatusNotFound,
+			wantCode:    "model_not_found",
+			wantMessage: scheduler.ErrModelNotFound{Model: "m"}.Error(),
+		},
+		{
+			name:        "model not installed",
+			err:         ramalama.ErrModelNotFound{Model: "m"},
+			wantStatus:  http.StatusNotFound,
+			wantCode:    "model_not_found",
+			wantMessage: ramalama.ErrModelNotFound{Model: "m"}.Error(),
+		},
+		{
+			name:        "backend failed",
+			err:         scheduler.ErrBackendFailed{Model: "m", Err: errors.New("exit status 1")},
+			wantStatus:  http.StatusBadGateway,
+			wantCode:    "backend_error",
+			wantMessage: scheduler.ErrBackendFailed{Model: "m", Err: errors.New("exit status 1")}.Error(),
+		},
+		{
+			name:        "canceled",
+			err:         fmt.Errorf("waiting: %w", context.Canceled),
+			wantStatus:  http.StatusServiceUnavailable,
+			wantCode:    "model_loading",
+			wantMessage: "timed out waiting for model to load",
+		},
+		{
+			name:        "deadline exceeded",
+			err:         context.DeadlineExceeded,
+			wantStatus:  http.StatusServiceUnavailable,
+			wantCode:    "model_loading",
+			wantMessage: "timed out waiting for model to load",
+		},
+		{
+			name:        "internal",
+			err:         errors.New("open /var/lib/secret: permission denied"),
+			wantStatus:  http.StatusInternalServerError,
+			wantCode:    "internal_error",
+			wantMessage: "internal server error",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			apiErr := toApiError(tc.err)
+			if apiErr.Status != tc.wantStatus || apiErr.Code != tc.wantCode || apiErr.Message != tc.wantMessage {
+				t.Errorf("Expected %d %s %q, got %d %s %q", tc.wantStatus, tc.wantCode, tc.wantMessage, apiErr.Status, apiErr.Code, apiErr.Message)
+			}
+		})
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		path       string
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "openai",
+			path:       "/v1/chat/completions",
+			err:        errBadRequest("bad field"),
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":{"message":"bad field","type":"invalid_request_error","code":"invalid_request"}}`,
+		},
+		{
+			name:       "ollama",
+			path:       "/api/chat",
+			err:        scheduler.ErrModelNotFound{Model: "m"},
+			wantStatus: http.StatusNotFound,
+			wantBody:   fmt.Sprintf(`{"error":%q}`, scheduler.ErrModelNotFound{Model: "m"}.Error()),
+		},
+		{
+			name:       "anthropic",
+			path:       "/v1/messages",
+			err:        context.Canceled,
+			wantStatus: http.StatusServiceUnavailable,
+			wantBody:   `{"type":"error","error":{"type":"overloaded_error","message":"timed out waiting for model to load"}}`,
+		},
+		{
+			name:       "anthropic permission",
+			path:       "/v1/messages",
+			err:        errForbidden("not allowed"),
+			wantStatus: http.StatusForbidden,
+			wantBody:   `{"type":"error","error":{"type":"permission_error","message":"not allowed"}}`,
+		},
+		{
+			name:       "openai internal",
+			path:       "/v1/responses",
+			err:        errors.New("secret detail"),
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"error":{"message":"internal server error","type":"server_error","code":"internal_error"}}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeError(w, httptest.NewRequest("POST", tc.path, nil), tc.err)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("Expected status %d, got %d", tc.wantStatus, w.Code)
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != "application/json; charset=utf-8" {
+				t.Errorf("Unexpected content type %q", contentType)
+			}
+
+			var got, want any
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tc.wantBody), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected body %s, got %s", tc.wantBody, w.Body.String())
+			}
+		})
+	}
+}
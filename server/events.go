@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/wk-y/rama-swap/server/scheduler"
+)
+
+// schedulerEvents streams scheduler lifecycle events as server-sent events.
+// Each "model" query parameter limits the stream to that model.
+// Events for models the client's API key can't use are never sent.
+// Backend log lines are only sent if the "logs" query parameter is given,
+// which only admins may do, like on the dashboard.
+func (s *Server) schedulerEvents(w http.ResponseWriter, r *http.Request) {
+	models := r.URL.Query()["model"]
+	key := requestKey(r)
+
+	if r.URL.Query().Has("logs") && !isAdmin(r) {
+		writeError(w, r, errForbidden("only admin keys may stream backend logs"))
+		return
+	}
+
+	events, cancel := s.scheduler.Subscribe()
+	defer cancel()
+
+	// log lines are left nil unless asked for, so they are never received
+	var logLines <-chan scheduler.LogLine
+	if r.URL.Query().Has("logs") {
+		lines, cancelLogs := s.scheduler.SubscribeLogs()
+		defer cancelLogs()
+		logLines = lines
+	}
+
+	visible := func(model string) bool {
+		return (len(models) == 0 || slices.Contains(models, model)) && (key == nil || key.allowsModel(model))
+	}
+
+	send := func(eventType string, data any) error {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			log.Printf("Failed to encode event: %v\n", err)
+			return nil
+		}
+
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, encoded)
+		return err
+	}
+
+	responseController := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := responseController.Flush(); err != nil {
+		log.Printf("Failed to flush events: %v\n", err)
+		return
+	}
+
+	// comments keep idle connections from being closed by proxies
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+
+		case event := <-events:
+			if !visible(event.Model) {
+				continue
+			}
+
+			if err := send(string(event.Type), event); err != nil {
+				return
+			}
+
+		case line := <-logLines:
+			if !visible(line.Model) {
+				continue
+			}
+
+			if err := send("log", line); err != nil {
+				return
+			}
+		}
+
+		if err := responseController.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,900 @@
+package server_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wk-y/rama-swap/internal/fakeramalama"
+	"github.com/wk-y/rama-swap/ramalama"
+	"github.com/wk-y/rama-swap/server"
+	"github.com/wk-y/rama-swap/server/scheduler"
+)
+
+func TestMain(m *testing.M) {
+	fakeramalama.Main()
+	os.Exit(m.Run())
+}
+
+// testServer is a rama-swap server using the fake ramalama.
+type testServer struct {
+	*httptest.Server
+	server    *server.Server
+	scheduler scheduler.ModelScheduler
+}
+
+func newTestServer(t *testing.T, idleTimeout time.Duration) *testServer {
+	t.Helper()
+	return startTestServer(t, scheduler.DefaultPortRange, idleTimeout, nil)
+}
+
+// startTestServer is newTestServer with backends started on ports, and per-model options.
+func startTestServer(t *testing.T, ports scheduler.PortRange, idleTimeout time.Duration, modelOptions map[string]scheduler.ModelOptions) *testServer {
+	t.Helper()
+
+	provider := ramalama.Ramalama{Command: fakeramalama.Command()}
+	catalog := ramalama.NewCatalog(provider)
+	sched := scheduler.NewFcfsScheduler(provider, catalog, ports, idleTimeout)
+	for model, options := range modelOptions {
+		sched.SetModelOptions(model, options)
+	}
+
+	srv := server.NewServer(catalog, sched)
+	mux := http.NewServeMux()
+	srv.HandleHttp(mux)
+	httpServer := httptest.NewServer(mux)
+
+	t.Cleanup(func() {
+		httpServer.Close()
+		sched.Unload("")
+	})
+
+	return &testServer{Server: httpServer, server: srv, scheduler: sched}
+}
+
+// post sends body as JSON to path, returning the response status and body.
+func (s *testServer) post(t *testing.T, path string, body any) (int, []byte) {
+	t.Helper()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Post(s.URL+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, respBody
+}
+
+// chat sends a chat completion request for model, returning the reply.
+func (s *testServer) chat(t *testing.T, model, message string) string {
+	t.Helper()
+
+	status, body := s.post(t, "/v1/chat/completions", map[string]any{
+		"model":    model,
+		"messages": []any{map[string]any{"role": "user", "content": message}},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("Chat with %s failed with status %d: %s", model, status, body)
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(body, &completion); err != nil || len(completion.Choices) == 0 {
+		t.Fatalf("Invalid chat completion %s: %v", body, err)
+	}
+	return completion.Choices[0].Message.Content
+}
+
+// waitForEvent reads events until one of type eventType for model arrives.
+func waitForEvent(t *testing.T, events <-chan scheduler.Event, eventType scheduler.EventType, model string) scheduler.Event {
+	t.Helper()
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.Type == eventType && event.Model == model {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %s event for %s", eventType, model)
+		}
+	}
+}
+
+// errorCode returns the code of an OpenAI-style error body.
+func errorCode(t *testing.T, body []byte) string {
+	t.Helper()
+
+	var response struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("Invalid error response %s: %v", body, err)
+	}
+	return response.Error.Code
+}
+
+func TestIntegrationModelSwap(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	events, cancel := s.scheduler.Subscribe()
+	defer cancel()
+
+	if reply := s.chat(t, fakeramalama.ModelChat, "hi"); reply != fakeramalama.Reply(fakeramalama.ModelChat, "hi") {
+		t.Errorf("Unexpected reply %q", reply)
+	}
+	waitForEvent(t, events, scheduler.EventReady, fakeramalama.ModelChat)
+
+	if loaded := s.scheduler.Loaded(); !slices.Equal(loaded, []string{fakeramalama.ModelChat}) {
+		t.Errorf("Expected only %s to be loaded, got %v", fakeramalama.ModelChat, loaded)
+	}
+
+	if reply := s.chat(t, fakeramalama.ModelOther, "hello"); reply != fakeramalama.Reply(fakeramalama.ModelOther, "hello") {
+		t.Errorf("Unexpected reply %q", reply)
+	}
+
+	if unload := waitForEvent(t, events, scheduler.EventUnload, fakeramalama.ModelChat); unload.Reason != "swap" {
+		t.Errorf("Expected %s to be unloaded for a swap, got %q", fakeramalama.ModelChat, unload.Reason)
+	}
+	waitForEvent(t, events, scheduler.EventReady, fakeramalama.ModelOther)
+
+	if loaded := s.scheduler.Loaded(); !slices.Equal(loaded, []string{fakeramalama.ModelOther}) {
+		t.Errorf("Expected only %s to be loaded, got %v", fakeramalama.ModelOther, loaded)
+	}
+
+	swaps := s.scheduler.Status().Swaps
+	if len(swaps) != 2 || swaps[1].From != fakeramalama.ModelChat || swaps[1].To != fakeramalama.ModelOther {
+		t.Errorf("Unexpected swaps %+v", swaps)
+	}
+}
+
+func TestIntegrationIdleTimeout(t *testing.T) {
+	s := newTestServer(t, 300*time.Millisecond)
+
+	events, cancel := s.scheduler.Subscribe()
+	defer cancel()
+
+	s.chat(t, fakeramalama.ModelChat, "hi")
+
+	if unload := waitForEvent(t, events, scheduler.EventUnload, fakeramalama.ModelChat); unload.Reason != "idle" {
+		t.Errorf("Expected the idle model to be unloaded for being idle, got %q", unload.Reason)
+	}
+
+	if loaded := s.scheduler.Loaded(); len(loaded) != 0 {
+		t.Errorf("Expected no models to be loaded, got %v", loaded)
+	}
+}
+
+// TestIntegrationModelIdleTimeout checks that a model's idle timeout overrides the global one.
+func TestIntegrationModelIdleTimeout(t *testing.T) {
+	short, forever := 300*time.Millisecond, time.Duration(-1)
+
+	s := startTestServer(t, scheduler.DefaultPortRange, 0, map[string]scheduler.ModelOptions{
+		fakeramalama.ModelChat: {IdleTimeout: &short},
+	})
+	events, cancel := s.scheduler.Subscribe()
+	defer cancel()
+
+	s.chat(t, fakeramalama.ModelChat, "hi")
+	if unload := waitForEvent(t, events, scheduler.EventUnload, fakeramalama.ModelChat); unload.Reason != "idle" {
+		t.Errorf("Expected the model to be unloaded for being idle, got %q", unload.Reason)
+	}
+
+	s = startTestServer(t, scheduler.DefaultPortRange, short, map[string]scheduler.ModelOptions{
+		fakeramalama.ModelChat: {IdleTimeout: &forever},
+	})
+	s.chat(t, fakeramalama.ModelChat, "hi")
+	time.Sleep(3 * short)
+	if loaded := s.scheduler.Loaded(); !slices.Equal(loaded, []string{fakeramalama.ModelChat}) {
+		t.Errorf("Expected %s to stay loaded, got %v", fakeramalama.ModelChat, loaded)
+	}
+}
+
+// TestIntegrationKeepAlive checks that keep_alive only applies until the model's next request.
+func TestIntegrationKeepAlive(t *testing.T) {
+	s := newTestServer(t, 300*time.Millisecond)
+
+	events, cancel := s.scheduler.Subscribe()
+	defer cancel()
+
+	status, body := s.post(t, "/api/chat", map[string]any{
+		"model":      fakeramalama.ModelChat,
+		"messages":   []any{map[string]any{"role": "user", "content": "hi"}},
+		"stream":     false,
+		"keep_alive": -1,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("Chat failed with status %d: %s", status, body)
+	}
+
+	time.Sleep(600 * time.Millisecond)
+	if loaded := s.scheduler.Loaded(); !slices.Equal(loaded, []string{fakeramalama.ModelChat}) {
+		t.Errorf("Expected %s to be kept loaded, got %v", fakeramalama.ModelChat, loaded)
+	}
+
+	// a request without keep_alive restores the idle timeout
+	s.chat(t, fakeramalama.ModelChat, "hi")
+
+	if unload := waitForEvent(t, events, scheduler.EventUnload, fakeramalama.ModelChat); unload.Reason != "idle" {
+		t.Errorf("Expected the model to be unloaded for being idle, got %q", unload.Reason)
+	}
+}
+
+// TestIntegrationConcurrentRequests checks that concurrent requests for different models
+// are each served by their own model, however the scheduler interleaves them.
+func TestIntegrationConcurrentRequests(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	var wg sync.WaitGroup
+	for i := range 12 {
+		model := fakeramalama.ModelChat
+		if i%2 == 1 {
+			model = fakeramalama.ModelOther
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if reply := s.chat(t, model, "hi"); reply != fakeramalama.Reply(model, "hi") {
+				t.Errorf("Request for %s got reply %q", model, reply)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestIntegrationConcurrentLocks races Lock and Unlock calls, checking that a locked model stays loaded.
+func TestIntegrationConcurrentLocks(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		model := fakeramalama.ModelChat
+		if i%3 == 0 {
+			model = fakeramalama.ModelOther
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			backend, err := s.scheduler.Lock(context.Background(), model)
+			if err != nil {
+				t.Errorf("Failed to lock %s: %v", model, err)
+				return
+			}
+			defer s.scheduler.Unlock(backend)
+
+			if loaded := s.scheduler.Loaded(); !slices.Contains(loaded, model) {
+				t.Errorf("Expected %s to be loaded while locked, got %v", model, loaded)
+			}
+
+			if status := s.scheduler.Status(); status.Model != model || status.Users == 0 {
+				t.Errorf("Unexpected status %+v while %s is locked", status, model)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if status := s.scheduler.Status(); status.Users != 0 || status.Queued != 0 {
+		t.Errorf("Expected no users or queued requests, got %+v", status)
+	}
+}
+
+func TestIntegrationLockTimeout(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), fakeramalama.SlowStart/4)
+	defer cancel()
+
+	if _, err := s.scheduler.Lock(ctx, fakeramalama.ModelSlow); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the lock to time out while the model loads, got %v", err)
+	}
+
+	// the model keeps loading for later requests
+	if reply := s.chat(t, fakeramalama.ModelSlow, "hi"); reply != fakeramalama.Reply(fakeramalama.ModelSlow, "hi") {
+		t.Errorf("Unexpected reply %q", reply)
+	}
+}
+
+// TestIntegrationStreamUsage checks that streams count tokens without the client asking for usage.
+func TestIntegrationStreamUsage(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	status, body := s.post(t, "/v1/chat/completions", map[string]any{
+		"model":    fakeramalama.ModelChat,
+		"messages": []any{map[string]any{"role": "user", "content": "hi"}},
+		"stream":   true,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("Chat failed with status %d: %s", status, body)
+	}
+
+	if strings.Contains(string(body), `"usage"`) || !strings.HasSuffix(string(body), "data: [DONE]\n\n") {
+		t.Errorf("Expected the stream without its usage chunk, got %s", body)
+	}
+
+	resp, err := http.Get(s.URL + "/admin/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var metrics struct {
+		Clients []struct {
+			PromptTokens     int64 `json:"prompt_tokens"`
+			CompletionTokens int64 `json:"completion_tokens"`
+		} `json:"clients"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics.Clients) != 1 || metrics.Clients[0].PromptTokens != 10 || metrics.Clients[0].CompletionTokens != 5 {
+		t.Errorf("Expected the stream's tokens to be counted, got %+v", metrics.Clients)
+	}
+}
+
+// TestIntegrationPortTaken checks that a server taking a backend's port while it starts isn't mistaken for the backend.
+func TestIntegrationPortTaken(t *testing.T) {
+	first := freePort(t)
+	s := startTestServer(t, scheduler.PortRange{First: first, Last: first + 10}, 0, nil)
+
+	events, cancel := s.scheduler.Subscribe()
+	defer cancel()
+
+	replies := make(chan string)
+	go func() {
+		replies <- s.chat(t, fakeramalama.ModelSlow, "hi")
+	}()
+
+	// take the port while the slow model starts
+	start := waitForEvent(t, events, scheduler.EventLoadStart, fakeramalama.ModelSlow)
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(start.Port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign := httptest.NewUnstartedServer(http.NotFoundHandler())
+	foreign.Listener.Close()
+	foreign.Listener = listener
+	foreign.Start()
+	defer foreign.Close()
+
+	if crash := waitForEvent(t, events, scheduler.EventCrash, fakeramalama.ModelSlow); !strings.Contains(crash.Error, "used by another server") {
+		t.Errorf("Expected the backend to fail for its port being taken, got %q", crash.Error)
+	}
+
+	if retry := waitForEvent(t, events, scheduler.EventLoadStart, fakeramalama.ModelSlow); retry.Port == start.Port {
+		t.Errorf("Expected the model to be retried on another port")
+	}
+
+	if reply := <-replies; reply != fakeramalama.Reply(fakeramalama.ModelSlow, "hi") {
+		t.Errorf("Unexpected reply %q", reply)
+	}
+}
+
+func TestIntegrationAliasedBackend(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	events, cancel := s.scheduler.Subscribe()
+	defer cancel()
+
+	// the backend listing itself under another id is still the one that was started
+	if reply := s.chat(t, fakeramalama.ModelAliased, "hi"); reply != fakeramalama.Reply(fakeramalama.ModelAliased, "hi") {
+		t.Errorf("Unexpected reply %q", reply)
+	}
+
+	for {
+		select {
+		case event := <-events:
+			if event.Type == scheduler.EventCrash || event.Type == scheduler.EventUnload {
+				t.Errorf("Unexpected %s event for a backend listing another id", event.Type)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// freePort returns the first of 10 consecutive free ports.
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	for range 100 {
+		l, err := net.Listen("tcp", ":0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := l.Addr().(*net.TCPAddr).Port
+		l.Close()
+
+		free := first+10 <= 65535
+		for port := first; free && port < first+10; port++ {
+			if l, err := net.Listen("tcp", ":"+strconv.Itoa(port)); err == nil {
+				l.Close()
+			} else {
+				free = false
+			}
+		}
+		if free {
+			return first
+		}
+	}
+
+	t.Fatalf("Failed to find free ports")
+	return 0
+}
+
+func TestIntegrationOllamaStream(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	status, body := s.post(t, "/api/chat", map[string]any{
+		"model":    fakeramalama.ModelChat,
+		"messages": []any{map[string]any{"role": "user", "content": "hi"}},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("Chat failed with status %d: %s", status, body)
+	}
+
+	var content, thinking strings.Builder
+	var final map[string]any
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var response struct {
+			Message struct {
+				Content  string `json:"content"`
+				Thinking string `json:"thinking"`
+			} `json:"message"`
+			Done bool `json:"done"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &response); err != nil {
+			t.Fatalf("Invalid response line %s: %v", scanner.Bytes(), err)
+		}
+
+		content.WriteString(response.Message.Content)
+		thinking.WriteString(response.Message.Thinking)
+		if response.Done {
+			json.Unmarshal(scanner.Bytes(), &final)
+		}
+	}
+
+	if content.String() != fakeramalama.Reply(fakeramalama.ModelChat, "hi") || thinking.String() != fakeramalama.Reasoning {
+		t.Errorf("Unexpected content %q and thinking %q", content.String(), thinking.String())
+	}
+
+	if final == nil || final["done_reason"] != "stop" || final["eval_count"] != float64(5) || final["prompt_eval_count"] != float64(10) {
+		t.Errorf("Unexpected final response %v", final)
+	}
+}
+
+// TestIntegrationOllamaContentType checks that streamed and complete Ollama chats have their own content types.
+func TestIntegrationOllamaContentType(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	for stream, want := range map[bool]string{true: "application/x-ndjson", false: "application/json; charset=utf-8"} {
+		body := `{"model": "` + fakeramalama.ModelChat + `", "messages": [{"role": "user", "content": "hi"}], "stream": ` + strconv.FormatBool(stream) + `}`
+		resp, err := http.Post(s.URL+"/api/chat", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		if got := resp.Header.Get("Content-Type"); got != want {
+			t.Errorf("Expected content type %q with stream %v, got %q", want, stream, got)
+		}
+	}
+}
+
+func TestIntegrationResponsesStream(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	status, body := s.post(t, "/v1/responses", map[string]any{
+		"model":  fakeramalama.ModelChat,
+		"input":  "hi",
+		"stream": true,
+	})
+	if status != http.StatusOK {
+		t.Fatalf("Response failed with status %d: %s", status, body)
+	}
+
+	var types []string
+	var text strings.Builder
+	var completed struct {
+		Response struct {
+			Status string `json:"status"`
+			Usage  struct {
+				TotalTokens int64 `json:"total_tokens"`
+			} `json:"usage"`
+		} `json:"response"`
+	}
+	for _, line := range strings.Split(string(body), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+
+		var event struct {
+			Type  string `json:"type"`
+			Delta string `json:"delta"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("Invalid event %s: %v", data, err)
+		}
+
+		types = append(types, event.Type)
+		if event.Type == "response.output_text.delta" {
+			text.WriteString(event.Delta)
+		}
+		if event.Type == "response.completed" {
+			json.Unmarshal([]byte(data), &completed)
+		}
+	}
+
+	if len(types) < 2 || types[0] != "response.created" || types[len(types)-1] != "response.completed" {
+		t.Errorf("Unexpected events %v", types)
+	}
+
+	if !slices.Contains(types, "response.reasoning_text.delta") {
+		t.Errorf("Expected reasoning events, got %v", types)
+	}
+
+	if text.String() != fakeramalama.Reply(fakeramalama.ModelChat, "hi") {
+		t.Errorf("Unexpected text %q", text.String())
+	}
+
+	if completed.Response.Status != "completed" || completed.Response.Usage.TotalTokens != 15 {
+		t.Errorf("Unexpected completed response %+v", completed.Response)
+	}
+}
+
+func TestIntegrationAnthropicToolUse(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	status, body := s.post(t, "/v1/messages", map[string]any{
+		"model":      fakeramalama.ModelChat,
+		"max_tokens": 100,
+		"messages":   []any{map[string]any{"role": "user", "content": "search for something"}},
+		"tools":      []any{map[string]any{"name": "search", "input_schema": map[string]any{"type": "object"}}},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("Message failed with status %d: %s", status, body)
+	}
+
+	type block struct {
+		Type  string         `json:"type"`
+		Name  string         `json:"name"`
+		Input map[string]any `json:"input"`
+	}
+	var message struct {
+		Content    []block `json:"content"`
+		StopReason string  `json:"stop_reason"`
+	}
+	if err := json.Unmarshal(body, &message); err != nil {
+		t.Fatal(err)
+	}
+
+	if message.StopReason != "tool_use" {
+		t.Errorf("Expected stop reason tool_use, got %q", message.StopReason)
+	}
+
+	var arguments map[string]any
+	json.Unmarshal([]byte(fakeramalama.ToolArguments), &arguments)
+
+	i := slices.IndexFunc(message.Content, func(b block) bool { return b.Type == "tool_use" })
+	if i < 0 || message.Content[i].Name != "search" || !maps.Equal(message.Content[i].Input, arguments) {
+		t.Errorf("Unexpected content %s", body)
+	}
+}
+
+func TestIntegrationUnknownModel(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	status, body := s.post(t, "/v1/chat/completions", map[string]any{
+		"model":    "fake://missing",
+		"messages": []any{map[string]any{"role": "user", "content": "hi"}},
+	})
+	if status != http.StatusNotFound || errorCode(t, body) != "model_not_found" {
+		t.Errorf("Expected model_not_found, got status %d: %s", status, body)
+	}
+}
+
+func TestIntegrationBackendCrash(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	events, cancel := s.scheduler.Subscribe()
+	defer cancel()
+
+	status, body := s.post(t, "/v1/chat/completions", map[string]any{
+		"model":    fakeramalama.ModelCrash,
+		"messages": []any{map[string]any{"role": "user", "content": "hi"}},
+	})
+	if status != http.StatusBadGateway || errorCode(t, body) != "backend_error" {
+		t.Errorf("Expected backend_error, got status %d: %s", status, body)
+	}
+
+	waitForEvent(t, events, scheduler.EventCrash, fakeramalama.ModelCrash)
+
+	// a crashed model doesn't prevent others from loading
+	s.chat(t, fakeramalama.ModelChat, "hi")
+}
+
+func TestIntegrationBackendErrors(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	messages := []any{map[string]any{"role": "user", "content": "hi"}}
+
+	// proxied errors are passed through
+	status, _ := s.post(t, "/v1/chat/completions", map[string]any{"model": fakeramalama.ModelBroken, "messages": messages})
+	if status != http.StatusInternalServerError {
+		t.Errorf("Expected the backend's status to be proxied, got %d", status)
+	}
+
+	// translated endpoints report backend errors in their own format
+	status, body := s.post(t, "/api/chat", map[string]any{"model": fakeramalama.ModelBroken, "messages": messages, "stream": false})
+	var ollamaError struct {
+		Error string `json:"error"`
+	}
+	if status != http.StatusBadGateway || json.Unmarshal(body, &ollamaError) != nil || ollamaError.Error == "" {
+		t.Errorf("Expected an Ollama error, got status %d: %s", status, body)
+	}
+
+	status, body = s.post(t, "/v1/messages", map[string]any{"model": fakeramalama.ModelBroken, "max_tokens": 10, "messages": messages, "stream": true})
+	var anthropicError struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if status != http.StatusBadGateway || json.Unmarshal(body, &anthropicError) != nil || anthropicError.Type != "error" || anthropicError.Error.Type != "api_error" {
+		t.Errorf("Expected an Anthropic error, got status %d: %s", status, body)
+	}
+
+	status, body = s.post(t, "/v1/responses", map[string]any{"model": fakeramalama.ModelBroken, "input": "hi"})
+	if status != http.StatusBadGateway || errorCode(t, body) != "backend_error" {
+		t.Errorf("Expected backend_error, got status %d: %s", status, body)
+	}
+}
+
+// TestIntegrationDashboardAPIKeys checks that the dashboard works with API keys,
+// only shows clients the models they may use, and doesn't hold a concurrent request slot for its events.
+func TestIntegrationDashboardAPIKeys(t *testing.T) {
+	s := newTestServer(t, 0)
+	s.server.APIKeys = []server.APIKey{
+		{Name: "admin", Key: "admin-key", Admin: true},
+		{Name: "user", Key: "user-key", Models: []string{fakeramalama.ModelOther}},
+	}
+	s.server.RateLimits = server.RateLimits{Concurrent: 1}
+
+	request := func(method, path, key string, body string) *http.Response {
+		t.Helper()
+		r, err := http.NewRequest(method, s.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != "" {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	// firstStatus reads the status sent when the dashboard's events are opened.
+	firstStatus := func(resp *http.Response) scheduler.Status {
+		t.Helper()
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+				var status scheduler.Status
+				if err := json.Unmarshal([]byte(data), &status); err != nil {
+					t.Fatal(err)
+				}
+				return status
+			}
+		}
+		t.Fatalf("No status event: %v", scanner.Err())
+		return scheduler.Status{}
+	}
+
+	if resp := request(http.MethodGet, "/dashboard/", "", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the dashboard page to be served without a key, got status %d", resp.StatusCode)
+	}
+	if resp := request(http.MethodGet, "/dashboard/models", "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected the dashboard's models to require a key, got status %d", resp.StatusCode)
+	}
+
+	resp := request(http.MethodPost, "/dashboard/load", "admin-key", `{"model":"`+fakeramalama.ModelChat+`"}`)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Loading %s failed with status %d", fakeramalama.ModelChat, resp.StatusCode)
+	}
+
+	if status := firstStatus(request(http.MethodGet, "/dashboard/events", "admin-key", "")); status.Model != fakeramalama.ModelChat || len(status.Swaps) != 1 {
+		t.Errorf("Expected admins to see %s loaded, got %+v", fakeramalama.ModelChat, status)
+	}
+
+	// the events stay open while the user lists the models
+	if status := firstStatus(request(http.MethodGet, "/dashboard/events", "user-key", "")); status.Model != "" || len(status.Swaps) != 0 {
+		t.Errorf("Expected %s to be hidden from the user, got %+v", fakeramalama.ModelChat, status)
+	}
+
+	resp = request(http.MethodGet, "/dashboard/models", "user-key", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Listing models failed with status %d", resp.StatusCode)
+	}
+	var models []struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&models); err != nil {
+		t.Fatal(err)
+	}
+	if len(models) != 1 || models[0].ID != fakeramalama.ModelOther {
+		t.Errorf("Expected only %s to be listed, got %+v", fakeramalama.ModelOther, models)
+	}
+}
+
+// TestIntegrationEventLogs checks that backend logs are only streamed from /events when asked for by an admin.
+func TestIntegrationEventLogs(t *testing.T) {
+	s := newTestServer(t, 0)
+	s.server.APIKeys = []server.APIKey{
+		{Name: "admin", Key: "admin-key", Admin: true},
+		{Name: "user", Key: "user-key"},
+	}
+
+	events := func(key string) *http.Response {
+		t.Helper()
+		r, err := http.NewRequest(http.MethodGet, s.URL+"/events?logs", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Authorization", "Bearer "+key)
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	if resp := events("user-key"); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected logs to be refused to non-admins, got status %d", resp.StatusCode)
+	}
+
+	resp := events("admin-key")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Streaming events failed with status %d", resp.StatusCode)
+	}
+
+	logs := make(chan scheduler.LogLine)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		event := ""
+		for scanner.Scan() {
+			if name, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+				event = name
+			} else if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok && event == "log" {
+				var line scheduler.LogLine
+				if json.Unmarshal([]byte(data), &line) != nil {
+					continue
+				}
+				select {
+				case logs <- line:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	// the crashing model writes its error before exiting
+	r, err := http.NewRequest(http.MethodPost, s.URL+"/v1/chat/completions", strings.NewReader(`{"model":"`+fakeramalama.ModelCrash+`","messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Authorization", "Bearer admin-key")
+	if chat, err := http.DefaultClient.Do(r); err == nil {
+		chat.Body.Close()
+	}
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case line := <-logs:
+			if line.Model == fakeramalama.ModelCrash && strings.Contains(line.Text, "scripted crash") {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Timed out waiting for the backend's log line")
+		}
+	}
+}
+
+// TestIntegrationDashboardEvents checks that the dashboard follows the scheduler's events.
+func TestIntegrationDashboardEvents(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	resp, err := http.Get(s.URL + "/dashboard/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	statuses := make(chan scheduler.Status)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(statuses)
+		scanner := bufio.NewScanner(resp.Body)
+		event := ""
+		for scanner.Scan() {
+			line := scanner.Text()
+			if name, ok := strings.CutPrefix(line, "event: "); ok {
+				event = name
+			} else if data, ok := strings.CutPrefix(line, "data: "); ok && event == "status" {
+				var status scheduler.Status
+				if err := json.Unmarshal([]byte(data), &status); err != nil {
+					continue
+				}
+				select {
+				case statuses <- status:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	if status := <-statuses; status.Model != "" {
+		t.Fatalf("Expected no model to be loaded, got %+v", status)
+	}
+
+	s.chat(t, fakeramalama.ModelChat, "hi")
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case status := <-statuses:
+			if status.Model == fakeramalama.ModelChat && status.State == "ready" && status.Users == 0 && len(status.Swaps) == 1 {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Timed out waiting for the dashboard to show the loaded model")
+		}
+	}
+}
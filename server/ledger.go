@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UsageRecord describes a single completed request that used a model.
+// Durations are in nanoseconds.
+type UsageRecord struct {
+	Time             time.Time     `json:"time"`
+	Client           string        `json:"client"`
+	Model            string        `json:"model"`
+	Endpoint         string        `json:"endpoint"`
+	Status           int           `json:"status"`
+	PromptTokens     int64         `json:"prompt_tokens"`
+	CompletionTokens int64         `json:"completion_tokens"`
+	QueueWait        time.Duration `json:"queue_wait"`
+	LoadDuration     time.Duration `json:"load_duration"`
+	TotalDuration    time.Duration `json:"total_duration"`
+}
+
+// UsageLedger is an append-only JSONL file of UsageRecords.
+type UsageLedger struct {
+	lock sync.Mutex
+	path string
+	file *os.File
+}
+
+// OpenUsageLedger opens the ledger at path, creating it if it doesn't exist.
+func OpenUsageLedger(path string) (*UsageLedger, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UsageLedger{
+		path: path,
+		file: file,
+	}, nil
+}
+
+// Record appends record to the ledger.
+func (l *UsageLedger) Record(record UsageRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	_, err = l.file.Write(line)
+	return err
+}
+
+// Each calls callback for every record in the ledger, in the order they were recorded.
+func (l *UsageLedger) Each(callback func(UsageRecord)) error {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record UsageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// a partially written line shouldn't make the whole ledger unreadable
+			log.Printf("Skipping invalid usage record: %v\n", err)
+			continue
+		}
+		callback(record)
+	}
+
+	return scanner.Err()
+}
+
+// usageAggregate is the total usage of a group of records.
+// Durations are in nanoseconds.
+type usageAggregate struct {
+	Client           string        `json:"client,omitempty"`
+	Model            string        `json:"model,omitempty"`
+	Requests         int64         `json:"requests"`
+	PromptTokens     int64         `json:"prompt_tokens"`
+	CompletionTokens int64         `json:"completion_tokens"`
+	QueueWait        time.Duration `json:"queue_wait"`
+	LoadDuration     time.Duration `json:"load_duration"`
+	TotalDuration    time.Duration `json:"total_duration"`
+}
+
+func (a *usageAggregate) add(record UsageRecord) {
+	a.Requests++
+	a.PromptTokens += record.PromptTokens
+	a.CompletionTokens += record.CompletionTokens
+	a.QueueWait += record.QueueWait
+	a.LoadDuration += record.LoadDuration
+	a.TotalDuration += record.TotalDuration
+}
+
+// adminUsage reports aggregated usage from the ledger.
+//
+// Query parameters:
+//   - from, to: RFC 3339 timestamps bounding the records included
+//   - client, model: only include matching records
+//   - group_by: comma separated list of "client" and "model"
+func (s *Server) adminUsage(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		writeError(w, r, errForbidden("api key is not an admin key"))
+		return
+	}
+
+	if s.UsageLedger == nil {
+		writeError(w, r, &apiError{
+			Status:  http.StatusNotFound,
+			Message: "usage ledger is not enabled",
+			Type:    "invalid_request_error",
+			Code:    "ledger_disabled",
+		})
+		return
+	}
+
+	query := r.URL.Query()
+
+	var from, to time.Time
+	for _, bound := range []struct {
+		name string
+		dest *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		if value := query.Get(bound.name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				writeError(w, r, errBadRequest(fmt.Sprintf("invalid %s timestamp: %v", bound.name, err)))
+				return
+			}
+			*bound.dest = t
+		}
+	}
+
+	var byClient, byModel bool
+	if groupBy := query.Get("group_by"); groupBy != "" {
+		for group := range strings.SplitSeq(groupBy, ",") {
+			switch group {
+			case "client":
+				byClient = true
+			case "model":
+				byModel = true
+			default:
+				writeError(w, r, errBadRequest(fmt.Sprintf("invalid group_by value %q", group)))
+				return
+			}
+		}
+	}
+
+	client, model := query.Get("client"), query.Get("model")
+
+	groups := map[[2]string]*usageAggregate{}
+	err := s.UsageLedger.Each(func(record UsageRecord) {
+		if (!from.IsZero() && record.Time.Before(from)) || (!to.IsZero() && !record.Time.Before(to)) {
+			return
+		}
+		if (client != "" && record.Client != client) || (model != "" && record.Model != model) {
+			return
+		}
+
+		var group [2]string
+		if byClient {
+			group[0] = record.Client
+		}
+		if byModel {
+			group[1] = record.Model
+		}
+
+		aggregate, ok := groups[group]
+		if !ok {
+			aggregate = &usageAggregate{Client: group[0], Model: group[1]}
+			groups[group] = aggregate
+		}
+		aggregate.add(record)
+	})
+	if err != nil {
+		log.Printf("Failed to read usage ledger: %v\n", err)
+		writeError(w, r, errInternal("failed to read usage ledger"))
+		return
+	}
+
+	var response struct {
+		Usage []usageAggregate `json:"usage"`
+	}
+	response.Usage = []usageAggregate{}
+	for _, aggregate := range groups {
+		response.Usage = append(response.Usage, *aggregate)
+	}
+	slices.SortFunc(response.Usage, func(a, b usageAggregate) int {
+		return strings.Compare(a.Client+"\x00"+a.Model, b.Client+"\x00"+b.Model)
+	})
+
+	w.Header().Add("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to reply: %v\n", err)
+	}
+}
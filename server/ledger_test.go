@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLedger(t *testing.T, records ...UsageRecord) *UsageLedger {
+	t.Helper()
+
+	ledger, err := OpenUsageLedger(filepath.Join(t.TempDir(), "usage.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ledger.file.Close() })
+
+	for _, record := range records {
+		if err := ledger.Record(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ledger
+}
+
+func TestAdminUsage(t *testing.T) {
+	day := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewServer(nil, nil)
+	s.UsageLedger = newTestLedger(t,
+		UsageRecord{Time: day, Client: "key:a", Model: "m1", PromptTokens: 1, CompletionTokens: 10, TotalDuration: time.Second},
+		UsageRecord{Time: day.Add(time.Hour), Client: "key:a", Model: "m2", PromptTokens: 2, CompletionTokens: 20},
+		UsageRecord{Time: day.Add(2 * time.Hour), Client: "key:b", Model: "m1", PromptTokens: 4, CompletionTokens: 40, QueueWait: time.Second},
+	)
+
+	for _, tc := range []struct {
+		name  string
+		query string
+		want  []usageAggregate
+	}{
+		{"total", "", []usageAggregate{
+			{Requests: 3, PromptTokens: 7, CompletionTokens: 70, QueueWait: time.Second, TotalDuration: time.Second},
+		}},
+		{"by client", "group_by=client", []usageAggregate{
+			{Client: "key:a", Requests: 2, PromptTokens: 3, CompletionTokens: 30, TotalDuration: time.Second},
+			{Client: "key:b", Requests: 1, PromptTokens: 4, CompletionTokens: 40, QueueWait: time.Second},
+		}},
+		{"by client and model", "group_by=model,client", []usageAggregate{
+			{Client: "key:a", Model: "m1", Requests: 1, PromptTokens: 1, CompletionTokens: 10, TotalDuration: time.Second},
+			{Client: "key:a", Model: "m2", Requests: 1, PromptTokens: 2, CompletionTokens: 20},
+			{Client: "key:b", Model: "m1", Requests: 1, PromptTokens: 4, CompletionTokens: 40, QueueWait: time.Second},
+		}},
+		{"model filter", "model=m1&group_by=client", []usageAggregate{
+			{Client: "key:a", Requests: 1, PromptTokens: 1, CompletionTokens: 10, TotalDuration: time.Second},
+			{Client: "key:b", Requests: 1, PromptTokens: 4, CompletionTokens: 40, QueueWait: time.Second},
+		}},
+		{"client filter", "client=key:b", []usageAggregate{
+			{Requests: 1, PromptTokens: 4, CompletionTokens: 40, QueueWait: time.Second},
+		}},
+		{"time range", "from=2025-01-01T01:00:00Z&to=2025-01-01T02:00:00Z", []usageAggregate{
+			{Requests: 1, PromptTokens: 2, CompletionTokens: 20},
+		}},
+		{"no matches", "client=key:c", []usageAggregate{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.adminUsage(w, httptest.NewRequest(http.MethodGet, "/admin/usage?"+tc.query, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body)
+			}
+
+			var response struct {
+				Usage []usageAggregate `json:"usage"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(response.Usage, tc.want) {
+				t.Errorf("Expected %+v, got %+v", tc.want, response.Usage)
+			}
+		})
+	}
+
+	for _, query := range []string{"group_by=endpoint", "from=yesterday"} {
+		w := httptest.NewRecorder()
+		s.adminUsage(w, httptest.NewRequest(http.MethodGet, "/admin/usage?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be rejected, got status %d", query, w.Code)
+		}
+	}
+}
+
+func TestAdminUsageRequiresAdmin(t *testing.T) {
+	s := NewServer(nil, nil)
+	s.UsageLedger = newTestLedger(t)
+
+	w := httptest.NewRecorder()
+	s.adminUsage(w, withKey(&APIKey{Name: "user"}))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected a non-admin key to be forbidden, got status %d", w.Code)
+	}
+}
+
+// TestLedgerSkipsDeniedRequests checks that requests denied access to their model aren't recorded.
+func TestLedgerSkipsDeniedRequests(t *testing.T) {
+	s := NewServer(nil, nil)
+	s.APIKeys = []APIKey{{Name: "restricted", Key: "secret", Models: []string{"allowed"}}}
+	s.UsageLedger = newTestLedger(t)
+
+	handler := s.authenticate(s.trackUsage(http.HandlerFunc(s.handleModelRouted)))
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model": "denied"}`))
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403, got %d: %s", w.Code, w.Body)
+	}
+
+	var records []UsageRecord
+	if err := s.UsageLedger.Each(func(record UsageRecord) { records = append(records, record) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("Expected no usage records, got %+v", records)
+	}
+}
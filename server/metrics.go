@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// clientMetrics counts the requests made by a single client identity since the server started.
+type clientMetrics struct {
+	Client           string `json:"client"`
+	Requests         int64  `json:"requests"`
+	Errors           int64  `json:"errors"` // requests answered with a 4xx or 5xx status
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+}
+
+// requestMetrics holds the in-memory counters reported by /admin/metrics.
+type requestMetrics struct {
+	lock    sync.Mutex
+	clients map[string]*clientMetrics
+}
+
+// record counts a finished request by client.
+func (m *requestMetrics) record(client string, status int, prompt, completion int64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.clients == nil {
+		m.clients = map[string]*clientMetrics{}
+	}
+
+	metrics, ok := m.clients[client]
+	if !ok {
+		metrics = &clientMetrics{Client: client}
+		m.clients[client] = metrics
+	}
+
+	metrics.Requests++
+	if status >= 400 {
+		metrics.Errors++
+	}
+	metrics.PromptTokens += prompt
+	metrics.CompletionTokens += completion
+}
+
+// snapshot returns a copy of the counters, sorted by client.
+func (m *requestMetrics) snapshot() []clientMetrics {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	clients := []clientMetrics{}
+	for _, metrics := range m.clients {
+		clients = append(clients, *metrics)
+	}
+	slices.SortFunc(clients, func(a, b clientMetrics) int {
+		return strings.Compare(a.Client, b.Client)
+	})
+	return clients
+}
+
+// adminMetrics reports request counters for each client identity.
+func (s *Server) adminMetrics(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		writeError(w, r, errForbidden("api key is not an admin key"))
+		return
+	}
+
+	var response struct {
+		Clients []clientMetrics `json:"clients"`
+	}
+	response.Clients = s.metrics.snapshot()
+
+	w.Header().Add("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to reply: %v\n", err)
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// llamaServerEndpoints are endpoints outside of /v1 that are routed to a model's backend.
+var llamaServerEndpoints = []string{
+	"/completion",
+	"/tokenize",
+	"/detokenize",
+	"/apply-template",
+	"/embedding",
+	"/embeddings",
+	"/infill",
+	"/rerank",
+	"/reranking",
+}
+
+// modelRoutedEndpoints are the /v1 endpoints known to be served by llama-server.
+// Other /v1 endpoints are also routed by model, but are reported as unknown if the request names no model.
+var modelRoutedEndpoints = []string{
+	"/v1/chat/completions",
+	"/v1/completions",
+	"/v1/embeddings",
+	"/v1/rerank",
+	"/v1/reranking",
+	"/v1/audio/transcriptions",
+}
+
+// handleModelRouted proxies the request to the backend of the model named by the request.
+func (s *Server) handleModelRouted(w http.ResponseWriter, r *http.Request) {
+	s.proxyEndpoint(w, r, func(body io.Reader) (string, error) {
+		model, err := findRequestModel(r, body)
+		if err != nil && !slices.Contains(modelRoutedEndpoints, r.URL.Path) && !slices.Contains(llamaServerEndpoints, r.URL.Path) {
+			log.Printf("Unhandled endpoint %s without a model: %v\n", r.URL, err)
+			return "", errUnknownEndpoint()
+		}
+		return model, err
+	})
+}
+
+// findRequestModel determines the model requested by r.
+// The model is read from the "model" query parameter, a "model" multipart form field,
+// or the "model" key of a JSON body, in that order.
+// body must be used in place of r.Body.
+func findRequestModel(r *http.Request, body io.Reader) (string, error) {
+	if model := r.URL.Query().Get("model"); model != "" {
+		return model, nil
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "multipart/") {
+		return findMultipartModel(multipart.NewReader(body, params["boundary"]))
+	}
+
+	var modelGet struct {
+		Model *string
+	}
+
+	if err := json.NewDecoder(body).Decode(&modelGet); err != nil {
+		return "", err
+	}
+
+	if modelGet.Model == nil {
+		return "", errors.New("missing model key")
+	}
+
+	return *modelGet.Model, nil
+}
+
+// findMultipartModel reads form parts until the "model" field is found.
+func findMultipartModel(reader *multipart.Reader) (string, error) {
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return "", errors.New("missing model field")
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if part.FormName() != "model" {
+			continue
+		}
+
+		model, err := io.ReadAll(io.LimitReader(part, 4096))
+		if err != nil {
+			return "", err
+		}
+		return string(model), nil
+	}
+}
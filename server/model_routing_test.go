@@ -0,0 +1,58 @@
+package server
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFindRequestModel(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{"model":"json-model"}`))
+	r.Header.Set("Content-Type", "application/json")
+	if model, err := findRequestModel(r, r.Body); err != nil || model != "json-model" {
+		t.Errorf("Expected model from JSON body, got %q, %v", model, err)
+	}
+
+	r = httptest.NewRequest("GET", "/v1/something?model=query-model", nil)
+	if model, err := findRequestModel(r, r.Body); err != nil || model != "query-model" {
+		t.Errorf("Expected model from query parameter, got %q, %v", model, err)
+	}
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	file, _ := writer.CreateFormFile("file", "audio.wav")
+	file.Write([]byte("RIFF...."))
+	writer.WriteField("model", "form-model")
+	writer.Close()
+
+	r = httptest.NewRequest("POST", "/v1/audio/transcriptions", &form)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	if model, err := findRequestModel(r, r.Body); err != nil || model != "form-model" {
+		t.Errorf("Expected model from multipart form, got %q, %v", model, err)
+	}
+
+	r = httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{}`))
+	if _, err := findRequestModel(r, r.Body); err == nil {
+		t.Errorf("Expected error for missing model")
+	}
+}
+
+func TestHandleModelRoutedWithoutModel(t *testing.T) {
+	s := NewServer(nil, nil)
+
+	for path, status := range map[string]int{
+		"/v1/embeddings":   http.StatusBadRequest,
+		"/tokenize":        http.StatusBadRequest,
+		"/v1/unknown":      http.StatusNotFound,
+		"/v1/chat/unknown": http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		s.handleModelRouted(w, httptest.NewRequest("POST", path, strings.NewReader(`{}`)))
+		if w.Code != status {
+			t.Errorf("Expected status %d for %s without a model, got %d: %s", status, path, w.Code, w.Body)
+		}
+	}
+}
@@ -5,4 +5,17 @@ type Model struct {
 	Object  string `json:"object"` // must equal "model"
 	Created int    `json:"created"`
 	OwnedBy string `json:"owned_by"`
+
+	// extensions to the OpenAI model object
+	Architecture   string `json:"architecture,omitempty"`
+	ParameterSize  string `json:"parameter_size,omitempty"`
+	Quantization   string `json:"quantization,omitempty"`
+	ContextLength  int64  `json:"context_length,omitempty"`
+	MemoryEstimate int64  `json:"memory_estimate,omitempty"` // rough bytes for the weights and a full-context KV cache
+	Status         string `json:"status"`                    // "loaded" or "unloaded"
+}
+
+type ModelList struct {
+	Object string  `json:"object"` // must equal "list"
+	Data   []Model `json:"data"`
 }
@@ -0,0 +1,47 @@
+package ollamatypes
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Duration is a duration given as a number of seconds or a string like "5m".
+// Negative durations mean forever.
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch value := value.(type) {
+	case float64:
+		d.Duration = time.Duration(value * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		d.Duration = parsed
+	default:
+		return fmt.Errorf("invalid duration %s", data)
+	}
+
+	if d.Duration < 0 {
+		d.Duration = -1
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	if d.Duration < 0 {
+		return []byte("-1"), nil
+	}
+	return json.Marshal(d.String())
+}
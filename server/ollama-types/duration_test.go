@@ -0,0 +1,34 @@
+package ollamatypes
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDurationUnmarshal(t *testing.T) {
+	for input, expected := range map[string]time.Duration{
+		`300`:   5 * time.Minute,
+		`1.5`:   1500 * time.Millisecond,
+		`"10m"`: 10 * time.Minute,
+		`0`:     0,
+		`"0s"`:  0,
+		`-1`:    -1,
+		`"-1m"`: -1,
+	} {
+		var d Duration
+		if err := json.Unmarshal([]byte(input), &d); err != nil {
+			t.Errorf("Failed to unmarshal %s: %v", input, err)
+			continue
+		}
+
+		if d.Duration != expected {
+			t.Errorf("Expected %s to be %v, got %v", input, expected, d.Duration)
+		}
+	}
+
+	var d Duration
+	if err := json.Unmarshal([]byte(`true`), &d); err == nil {
+		t.Error("Expected an error for a boolean duration")
+	}
+}
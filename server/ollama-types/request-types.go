@@ -5,6 +5,12 @@ type ChatRequest struct {
 	Messages []Message `json:"messages"`
 	Stream   bool      `json:"stream"`
 	Options  *Options  `json:"options"`
+
+	// KeepAlive is how long the model stays loaded after the request.
+	KeepAlive *Duration `json:"keep_alive"`
+
+	// Think enables or disables thinking for reasoning models.
+	Think *Think `json:"think"`
 }
 
 type Options struct {
@@ -19,3 +25,8 @@ type Options struct {
 	TopP          *float64 `json:"top_p"`
 	MinP          *float64 `json:"min_p"`
 }
+
+type ShowRequest struct {
+	Model string `json:"model"`
+	Name  string `json:"name"` // deprecated alias of Model
+}
@@ -5,6 +5,8 @@ type ChatResponse struct {
 	CreatedAt string  `json:"created_at"`
 	Message   Message `json:"message"`
 	Done      bool    `json:"done"`
+
+	DoneReason string `json:"done_reason,omitempty"`
 }
 
 type ChatFinalResponse struct {
@@ -16,3 +18,14 @@ type ChatFinalResponse struct {
 	EvalCount          int64 `json:"eval_count"`
 	EvalDuration       int64 `json:"eval_duration"`
 }
+
+type ShowResponse struct {
+	License      string         `json:"license"`
+	Modelfile    string         `json:"modelfile"`
+	Parameters   string         `json:"parameters"`
+	Template     string         `json:"template"`
+	Details      ModelDetails   `json:"details"`
+	ModelInfo    map[string]any `json:"model_info"`
+	Capabilities []string       `json:"capabilities"`
+	ModifiedAt   string         `json:"modified_at"`
+}
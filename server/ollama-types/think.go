@@ -0,0 +1,44 @@
+package ollamatypes
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Think is the think option of a chat request, which is either a boolean
+// or a reasoning effort of "low", "medium" or "high".
+type Think struct {
+	Enabled bool
+	Level   string // reasoning effort, "" if a boolean was given
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *Think) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch value := value.(type) {
+	case bool:
+		*t = Think{Enabled: value}
+	case string:
+		switch value {
+		case "low", "medium", "high":
+			*t = Think{Enabled: true, Level: value}
+		default:
+			return fmt.Errorf("invalid think level %q", value)
+		}
+	default:
+		return fmt.Errorf("invalid think value %s", data)
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t Think) MarshalJSON() ([]byte, error) {
+	if t.Level != "" {
+		return json.Marshal(t.Level)
+	}
+	return json.Marshal(t.Enabled)
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -14,24 +15,25 @@ import (
 	"time"
 
 	"github.com/openai/openai-go/v2"
-	"github.com/openai/openai-go/v2/packages/ssestream"
+	"github.com/openai/openai-go/v2/packages/respjson"
 	ollamatypes "github.com/wk-y/rama-swap/server/ollama-types"
+	"github.com/wk-y/rama-swap/server/scheduler"
 )
 
 func (s *Server) ollamaTags(w http.ResponseWriter, r *http.Request) {
 	log.Println(r.URL)
 
-	ramaModels, err := s.ramalama.GetModels()
+	ramaModels, err := s.catalog.Models()
 	if err != nil {
-		log.Printf("Failed to get models: %v\n", ramaModels)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("E_MODEL_GET\n"))
+		log.Printf("Failed to get models: %v\n", err)
+		writeError(w, r, errInternal("failed to list models"))
+		return
 	}
 
 	var models struct {
 		Models []ollamatypes.Model `json:"models"`
 	}
-	for _, ramaModel := range ramaModels {
+	for _, ramaModel := range filterAllowedModels(r, ramaModels) {
 		model := ollamatypes.Model{
 			Name:       ramaModel.Name,
 			Model:      ramaModel.Name,
@@ -39,19 +41,14 @@ func (s *Server) ollamaTags(w http.ResponseWriter, r *http.Request) {
 			Size:       ramaModel.Size,
 		}
 
-		info, err := s.ramalama.Inspect(ramaModel.Name)
+		info, err := s.catalog.Inspect(ramaModel.Name)
 		if err != nil {
 			log.Printf("Failed to inspect full details of model %s: %v\n", ramaModel.Name, err)
 		} else {
 			model.Name = info.Name
-			model.Details.Format = strings.ToLower(info.Format)
-			if info.Metadata.GeneralArchitecture != nil {
-				model.Details.Family = *info.Metadata.GeneralArchitecture
-				model.Details.Families = []string{*info.Metadata.GeneralArchitecture}
-			}
-
-			if info.Metadata.GeneralSizeLabel != nil {
-				model.Details.ParameterSize = *info.Metadata.GeneralSizeLabel
+			model.Details = ollamaModelDetails(info)
+			if info.Path != "" {
+				model.Digest = s.catalog.Digest(info.Path)
 			}
 		}
 
@@ -66,6 +63,64 @@ func (s *Server) ollamaTags(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *Server) ollamaShow(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.URL)
+
+	var request ollamatypes.ShowRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		log.Println("Bad show request:", err)
+		writeError(w, r, errBadRequest("invalid request JSON"))
+		return
+	}
+
+	name := request.Model
+	if name == "" {
+		name = request.Name
+	}
+
+	if err := authorizeModel(r, name); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	ramaModel, ok, err := s.catalog.Find(name)
+	if err != nil {
+		log.Printf("Failed to get models: %v\n", err)
+		writeError(w, r, errInternal("failed to list models"))
+		return
+	}
+
+	if !ok {
+		writeError(w, r, scheduler.ErrModelNotFound{Model: name})
+		return
+	}
+
+	info, err := s.catalog.Inspect(ramaModel.Name)
+	if err != nil {
+		log.Printf("Failed to inspect model %s: %v\n", name, err)
+		writeError(w, r, errInternal("failed to inspect model"))
+		return
+	}
+
+	response := ollamatypes.ShowResponse{
+		Details:      ollamaModelDetails(info),
+		ModelInfo:    info.Metadata.All,
+		Capabilities: ollamaCapabilities(info),
+		ModifiedAt:   ramaModel.Modified,
+	}
+
+	if template, ok := info.Metadata.All["tokenizer.chat_template"].(string); ok {
+		response.Template = template
+	}
+
+	w.Header().Add("Content-Type", "application/json; charset=utf-8")
+
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Printf("Failed to reply: %v\n", err)
+	}
+}
+
 func (s *Server) ollamaVersion(w http.ResponseWriter, r *http.Request) {
 	log.Println(r.URL)
 
@@ -86,6 +141,8 @@ func (s *Server) ollamaVersion(w http.ResponseWriter, r *http.Request) {
 func (s *Server) ollamaChat(w http.ResponseWriter, r *http.Request) {
 	log.Println(r.URL)
 
+	requestStart := time.Now()
+
 	var requestJson ollamatypes.ChatRequest
 	requestJson.Stream = true // default value
 
@@ -93,117 +150,415 @@ func (s *Server) ollamaChat(w http.ResponseWriter, r *http.Request) {
 	err := rDecoder.Decode(&requestJson)
 	if err != nil || requestJson.Model == nil {
 		log.Println("Bad chat request:", err)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("Invalid request JSON\n"))
+		writeError(w, r, errBadRequest("invalid request JSON"))
 		return
 	}
 
 	model := *requestJson.Model
 
-	backendModel, err := s.scheduler.Lock(r.Context(), model)
+	params, err := ollamaTranslateParams(requestJson)
+	if err != nil {
+		log.Printf("Failed to translate request: %v\n", err)
+		writeError(w, r, errBadRequest(fmt.Sprintf("failed to translate request: %v", err)))
+		return
+	}
+
+	if err := authorizeModel(r, model); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	requestUsageOf(r).SetModel(model)
+
+	ctx := r.Context()
+	if requestJson.KeepAlive != nil {
+		ctx = scheduler.WithKeepAlive(ctx, requestJson.KeepAlive.Duration)
+	}
+
+	// like Ollama, requests without messages only load or unload the model
+	if len(requestJson.Messages) == 0 {
+		s.ollamaLoad(w, r, ctx, model, requestJson.KeepAlive)
+		return
+	}
+
+	backendModel, err := s.scheduler.Lock(ctx, model)
 	if err != nil {
 		log.Printf("Failed to start model %s: %v\n", model, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("E_MODEL_START"))
+		writeError(w, r, err)
+		return
 	}
 	defer s.scheduler.Unlock(backendModel)
 
-	params, err := ollamaTranslateParams(requestJson)
+	var result ollamaChatResult
+	if requestJson.Stream {
+		result, err = s.ollamaStreamChat(w, r, backendModel.WithClient, model, requestJson.Think, params)
+	} else {
+		result, err = s.ollamaCompleteChat(r, backendModel.WithClient, requestJson.Think, params)
+	}
+
 	if err != nil {
-		log.Printf("Failed to translate request: %v\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("E_COMPLETION_TRANSLATE"))
+		log.Println("Error during chat completion:", err)
+		if !result.started {
+			writeError(w, r, errBackend(fmt.Sprintf("model backend failed: %v", err)))
+			return
+		}
+		// keep going to send final response
+	}
+
+	requestUsageOf(r).AddTokens(result.promptEvalCount, result.evalCount)
+
+	// streams already set their content type before their first write
+	if !requestJson.Stream {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	}
 
-	var stream *ssestream.Stream[openai.ChatCompletionChunk]
-	err = backendModel.WithClient(func(client openai.Client) error {
-		stream = client.Chat.Completions.NewStreaming(r.Context(), params)
-		return nil
+	err = json.NewEncoder(w).Encode(ollamatypes.ChatFinalResponse{
+		ChatResponse: ollamatypes.ChatResponse{
+			Model:     model,
+			CreatedAt: time.Now().UTC().Format(time.RFC3339Nano),
+			Message: ollamatypes.Message{
+				Role:     "assistant",
+				Content:  result.content,
+				Thinking: result.thinking,
+			},
+			Done:       true,
+			DoneReason: result.doneReason,
+		},
+		TotalDuration:      time.Since(requestStart).Nanoseconds(),
+		LoadDuration:       requestUsageOf(r).LockStats.LoadDuration.Nanoseconds(),
+		PromptEvalCount:    result.promptEvalCount,
+		PromptEvalDuration: result.promptEvalDuration.Nanoseconds(),
+		EvalCount:          result.evalCount,
+		EvalDuration:       result.evalDuration.Nanoseconds(),
 	})
 	if err != nil {
-		log.Println("Error connecting to backend:", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("E_BACKEND_CONNECT\n"))
-		return
+		log.Printf("Failed to reply: %v\n", err)
 	}
+}
 
-	completionStartTime := time.Now().UTC()
+// ollamaChatResult is the outcome of a chat completion, for Ollama's final response.
+type ollamaChatResult struct {
+	started bool // whether any part of the response has been written
 
-	defer stream.Close()
+	content    string // the whole message, if it wasn't streamed
+	thinking   string // the whole reasoning, if it wasn't streamed
+	doneReason string
 
-	responseEncoder := json.NewEncoder(w)
-	responseController := http.NewResponseController(w)
+	promptEvalCount    int64
+	promptEvalDuration time.Duration
+	evalCount          int64
+	evalDuration       time.Duration
+}
 
-	// only written to in non-streaming mode to send all tokens in the final response
-	var accumulator strings.Builder
+// llamaTimings are the timings llama-server adds to chat completion responses.
+type llamaTimings struct {
+	PromptN     int64   `json:"prompt_n"`
+	PromptMS    float64 `json:"prompt_ms"`
+	PredictedN  int64   `json:"predicted_n"`
+	PredictedMS float64 `json:"predicted_ms"`
+}
 
-	// time the first token was generated
-	var firstCreatedAt *time.Time
+// addUsage fills in result from usage reported by the backend.
+func (result *ollamaChatResult) addUsage(usage openai.CompletionUsage) {
+	result.promptEvalCount = usage.PromptTokens
+	result.evalCount = usage.CompletionTokens
+}
 
-	// number of tokens generated
-	var evalCount int64
+// addTimings fills in result from llama-server's timings, if the response has them.
+// It returns whether the timings were found.
+func (result *ollamaChatResult) addTimings(extraFields map[string]respjson.Field) bool {
+	// extra fields are never Valid, since they have no type to be checked against
+	field, ok := extraFields["timings"]
+	if !ok || field.Raw() == "" {
+		return false
+	}
 
-	for stream.Next() {
-		event := stream.Current()
-		if len(event.Choices) > 0 {
-			evalCount++
+	var timings llamaTimings
+	if err := json.Unmarshal([]byte(field.Raw()), &timings); err != nil {
+		return false
+	}
 
-			if firstCreatedAt == nil {
-				time := time.Unix(event.Created, 0)
-				firstCreatedAt = &time
-			}
+	result.promptEvalDuration = time.Duration(timings.PromptMS * float64(time.Millisecond))
+	result.evalDuration = time.Duration(timings.PredictedMS * float64(time.Millisecond))
+	if result.evalCount == 0 {
+		result.promptEvalCount = timings.PromptN
+		result.evalCount = timings.PredictedN
+	}
+	return true
+}
 
-			if requestJson.Stream == false {
-				accumulator.WriteString(event.Choices[0].Delta.Content)
-				continue
-			}
+func ollamaDoneReason(finishReason string) string {
+	if finishReason == "length" {
+		return "length"
+	}
+	return "stop"
+}
 
-			ollamaEvent := ollamatypes.ChatResponse{
-				Model:     model,
-				CreatedAt: time.Unix(event.Created, 0).Format(time.RFC3339),
-				Message: ollamatypes.Message{
-					Role:    "assistant",
-					Content: event.Choices[0].Delta.Content,
-				},
-				Done: false,
-			}
+// reasoningContent returns the reasoning_content field that llama-server adds to messages and deltas.
+func reasoningContent(extraFields map[string]respjson.Field) string {
+	field, ok := extraFields["reasoning_content"]
+	if !ok || field.Raw() == "" {
+		return ""
+	}
 
-			err = responseEncoder.Encode(ollamaEvent)
-			if err != nil {
-				log.Printf("Failed to send delta: %v\n", err)
-				return
-			}
+	var reasoning string
+	if err := json.Unmarshal([]byte(field.Raw()), &reasoning); err != nil {
+		return ""
+	}
+	return reasoning
+}
 
-			// Flush to reduce stream latency. Whether it succeeds isn't important.
-			_ = responseController.Flush()
-		}
+// wantsThinking returns whether thinking should be sent to a client that passed think.
+// Thinking is sent unless it was explicitly disabled.
+func wantsThinking(think *ollamatypes.Think) bool {
+	return think == nil || think.Enabled
+}
+
+// ollamaCompleteChat gets the whole completion from the backend at once.
+func (s *Server) ollamaCompleteChat(r *http.Request, withClient func(func(openai.Client) error) error, think *ollamatypes.Think, params openai.ChatCompletionNewParams) (ollamaChatResult, error) {
+	builder := &ollamaCompleteBuilder{
+		think:          think,
+		stripThinkTags: s.StripThinkTags,
+		start:          time.Now(),
 	}
 
-	if err := stream.Err(); err != nil {
-		log.Println("Error during response stream:", err)
-		// keep going to send final response
+	err := completeChat(r, withClient, builder, params)
+	return builder.result, err
+}
+
+// ollamaCompleteBuilder collects a whole chat completion for Ollama's final response.
+type ollamaCompleteBuilder struct {
+	think          *ollamatypes.Think
+	stripThinkTags bool
+
+	result ollamaChatResult
+
+	start      time.Time
+	hasTimings bool
+}
+
+func (b *ollamaCompleteBuilder) addThinking(text string) {
+	b.result.thinking += text
+}
+
+func (b *ollamaCompleteBuilder) addText(text string) {
+	var thinking string
+	if b.stripThinkTags {
+		text, thinking = splitThinking(text)
 	}
+	b.result.content += text
+	b.result.thinking += thinking
+}
+
+// addToolCall ignores tool calls, which the Ollama endpoints don't support yet.
+func (b *ollamaCompleteBuilder) addToolCall(index int64, id, name, arguments string) {}
 
-	completionFinishTime := time.Now().UTC()
+func (b *ollamaCompleteBuilder) setUsage(usage openai.CompletionUsage) {
+	b.result.addUsage(usage)
+}
+
+// observeCompletion collects llama-server's timings.
+func (b *ollamaCompleteBuilder) observeCompletion(completion *openai.ChatCompletion) {
+	b.hasTimings = b.result.addTimings(completion.JSON.ExtraFields)
+}
 
-	if firstCreatedAt == nil {
-		firstCreatedAt = &completionFinishTime
+func (b *ollamaCompleteBuilder) finish(finishReason string) {
+	b.result.doneReason = ollamaDoneReason(finishReason)
+
+	if !wantsThinking(b.think) {
+		b.result.thinking = ""
 	}
 
-	responseEncoder.Encode(ollamatypes.ChatFinalResponse{
-		ChatResponse: ollamatypes.ChatResponse{
-			Model:     model,
-			CreatedAt: time.Now().UTC().Format(time.RFC3339),
-			Message: ollamatypes.Message{
-				Role:    "assistant",
-				Content: accumulator.String(),
-			},
-			Done: true,
+	if !b.hasTimings {
+		// without timings, prompt processing can't be told apart from generation
+		b.result.evalDuration = time.Since(b.start)
+	}
+}
+
+// fail does nothing, since completeChat leaves errors to the caller.
+func (b *ollamaCompleteBuilder) fail(err error) {}
+
+func (b *ollamaCompleteBuilder) stopped() bool {
+	return false
+}
+
+var _ chatBuilder = (*ollamaCompleteBuilder)(nil)
+
+// ollamaStreamChat streams the completion from the backend to w as Ollama chat responses.
+// The final response is left to the caller.
+func (s *Server) ollamaStreamChat(w http.ResponseWriter, r *http.Request, withClient func(func(openai.Client) error) error, model string, think *ollamatypes.Think, params openai.ChatCompletionNewParams) (ollamaChatResult, error) {
+	builder := &ollamaStreamBuilder{
+		w:              w,
+		encoder:        json.NewEncoder(w),
+		model:          model,
+		think:          think,
+		stripThinkTags: s.StripThinkTags,
+		start:          time.Now(),
+	}
+	builder.result.doneReason = "stop"
+
+	started, err := streamChat(r, withClient, builder, params, func() {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	})
+	builder.result.started = started
+	if err == nil {
+		err = builder.err
+	}
+	return builder.result, err
+}
+
+// ollamaStreamBuilder writes a chat completion as Ollama chat responses, one per delta,
+// and collects the statistics for the final response.
+type ollamaStreamBuilder struct {
+	w       http.ResponseWriter
+	encoder *json.Encoder
+	model   string
+	think   *ollamatypes.Think
+
+	stripThinkTags bool
+	splitter       thinkSplitter
+
+	result ollamaChatResult
+	err    error // first error writing to the client, after which nothing more is written
+
+	start      time.Time
+	firstToken time.Time
+	chunks     int64
+	hasTimings bool
+}
+
+func (b *ollamaStreamBuilder) send(content, thinking string) {
+	if !wantsThinking(b.think) {
+		thinking = ""
+	}
+
+	if b.err != nil || (content == "" && thinking == "") {
+		return
+	}
+
+	err := b.encoder.Encode(ollamatypes.ChatResponse{
+		Model:     b.model,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339Nano),
+		Message: ollamatypes.Message{
+			Role:     "assistant",
+			Content:  content,
+			Thinking: thinking,
 		},
-		TotalDuration: completionFinishTime.Sub(completionStartTime).Nanoseconds(),
-		EvalDuration:  completionFinishTime.Sub(*firstCreatedAt).Nanoseconds(),
-		EvalCount:     evalCount,
+		Done: false,
+	})
+	if err != nil {
+		b.err = fmt.Errorf("failed to send delta: %v", err)
+		return
+	}
+
+	// Flush to reduce stream latency. Whether it succeeds isn't important.
+	_ = http.NewResponseController(b.w).Flush()
+}
+
+func (b *ollamaStreamBuilder) addThinking(text string) {
+	b.send("", text)
+}
+
+func (b *ollamaStreamBuilder) addText(text string) {
+	var thinking string
+	if b.stripThinkTags {
+		text, thinking = b.splitter.Next(text)
+	}
+	b.send(text, thinking)
+}
+
+// addToolCall ignores tool calls, which the Ollama endpoints don't support yet.
+func (b *ollamaStreamBuilder) addToolCall(index int64, id, name, arguments string) {}
+
+func (b *ollamaStreamBuilder) setUsage(usage openai.CompletionUsage) {
+	b.result.addUsage(usage)
+}
+
+// observeChunk collects llama-server's timings, or the times needed to estimate them.
+func (b *ollamaStreamBuilder) observeChunk(chunk openai.ChatCompletionChunk) {
+	if b.result.addTimings(chunk.JSON.ExtraFields) {
+		b.hasTimings = true
+	}
+
+	if len(chunk.Choices) > 0 {
+		b.chunks++
+		if b.firstToken.IsZero() {
+			b.firstToken = time.Now()
+		}
+	}
+}
+
+func (b *ollamaStreamBuilder) finish(finishReason string) {
+	b.result.doneReason = ollamaDoneReason(finishReason)
+	b.done()
+}
+
+// fail finishes the statistics, leaving the error to the caller's final response.
+func (b *ollamaStreamBuilder) fail(err error) {
+	b.done()
+}
+
+func (b *ollamaStreamBuilder) stopped() bool {
+	return b.err != nil
+}
+
+// done sends what is left in the splitter, and fills in the statistics the backend didn't report.
+func (b *ollamaStreamBuilder) done() {
+	b.send(b.splitter.Flush())
+
+	if b.result.evalCount == 0 {
+		// the backend didn't report usage, so assume each chunk is a token
+		b.result.evalCount = b.chunks
+	}
+
+	if !b.hasTimings {
+		if b.firstToken.IsZero() {
+			b.firstToken = time.Now()
+		}
+		b.result.promptEvalDuration = b.firstToken.Sub(b.start)
+		b.result.evalDuration = time.Since(b.firstToken)
+	}
+}
+
+var _ chatBuilder = (*ollamaStreamBuilder)(nil)
+
+// ollamaLoad loads model, or unloads it if keepAlive is 0, and replies like Ollama does to a request without messages.
+func (s *Server) ollamaLoad(w http.ResponseWriter, r *http.Request, ctx context.Context, model string, keepAlive *ollamatypes.Duration) {
+	doneReason := "load"
+
+	if keepAlive != nil && keepAlive.Duration == 0 {
+		if _, ok, err := s.catalog.Find(model); err != nil || !ok {
+			if err == nil {
+				err = scheduler.ErrModelNotFound{Model: model}
+			}
+			writeError(w, r, err)
+			return
+		}
+
+		s.scheduler.Unload(model)
+		doneReason = "unload"
+	} else {
+		backend, err := s.scheduler.Lock(ctx, model)
+		if err != nil {
+			log.Printf("Failed to start model %s: %v\n", model, err)
+			writeError(w, r, err)
+			return
+		}
+		s.scheduler.Unlock(backend)
+	}
+
+	w.Header().Add("Content-Type", "application/json; charset=utf-8")
+
+	err := json.NewEncoder(w).Encode(ollamatypes.ChatResponse{
+		Model:      model,
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+		Message:    ollamatypes.Message{Role: "assistant"},
+		Done:       true,
+		DoneReason: doneReason,
 	})
+	if err != nil {
+		log.Printf("Failed to reply: %v\n", err)
+	}
 }
 
 // ollamaTranslateParams translates an ollama request into an openai chat completion request.
@@ -249,6 +604,17 @@ func ollamaTranslateParams(request ollamatypes.ChatRequest) (completion openai.C
 		ollamaAddOptions(&completion, *request.Options)
 	}
 
+	if request.Think != nil {
+		if !request.Think.Enabled {
+			// understood by llama-server and the chat templates of most reasoning models
+			completion.SetExtraFields(map[string]any{
+				"chat_template_kwargs": map[string]any{"enable_thinking": false},
+			})
+		} else if request.Think.Level != "" {
+			completion.ReasoningEffort = openai.ReasoningEffort(request.Think.Level)
+		}
+	}
+
 	return
 }
 
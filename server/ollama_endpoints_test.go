@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+	ollamatypes "github.com/wk-y/rama-swap/server/ollama-types"
+)
+
+func TestOllamaChatResultTimings(t *testing.T) {
+	var completion openai.ChatCompletion
+	err := json.Unmarshal([]byte(`{
+		"id": "x",
+		"choices": [],
+		"usage": {"prompt_tokens": 12, "completion_tokens": 34, "total_tokens": 46},
+		"timings": {"prompt_n": 12, "prompt_ms": 1.5, "predicted_n": 34, "predicted_ms": 250}
+	}`), &completion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result ollamaChatResult
+	result.addUsage(completion.Usage)
+	if !result.addTimings(completion.JSON.ExtraFields) {
+		t.Fatal("Expected timings to be found")
+	}
+
+	if result.promptEvalCount != 12 || result.evalCount != 34 {
+		t.Errorf("Unexpected token counts %d and %d", result.promptEvalCount, result.evalCount)
+	}
+
+	if result.promptEvalDuration != 1500*time.Microsecond || result.evalDuration != 250*time.Millisecond {
+		t.Errorf("Unexpected durations %v and %v", result.promptEvalDuration, result.evalDuration)
+	}
+}
+
+func TestOllamaChatResultWithoutTimings(t *testing.T) {
+	var completion openai.ChatCompletion
+	if err := json.Unmarshal([]byte(`{"id": "x", "choices": []}`), &completion); err != nil {
+		t.Fatal(err)
+	}
+
+	var result ollamaChatResult
+	if result.addTimings(completion.JSON.ExtraFields) {
+		t.Error("Expected no timings to be found")
+	}
+}
+
+func TestOllamaCompleteBuilder(t *testing.T) {
+	var completion openai.ChatCompletion
+	err := json.Unmarshal([]byte(`{
+		"id": "x",
+		"choices": [],
+		"timings": {"prompt_n": 12, "prompt_ms": 1.5, "predicted_n": 34, "predicted_ms": 250}
+	}`), &completion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name         string
+		think        *ollamatypes.Think
+		wantThinking string
+	}{
+		{name: "default", wantThinking: "hmm"},
+		{name: "think disabled", think: &ollamatypes.Think{Enabled: false}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &ollamaCompleteBuilder{think: tc.think, stripThinkTags: true, start: time.Now()}
+
+			// in the order completeChat calls them
+			b.addThinking("")
+			b.addText("<think>hmm</think>answer")
+			b.setUsage(completion.Usage)
+			b.observeCompletion(&completion)
+			b.finish("length")
+
+			if b.result.content != "answer" || b.result.thinking != tc.wantThinking {
+				t.Errorf("Expected content %q and thinking %q, got %q and %q", "answer", tc.wantThinking, b.result.content, b.result.thinking)
+			}
+			if b.result.doneReason != "length" {
+				t.Errorf("Expected done reason length, got %q", b.result.doneReason)
+			}
+
+			// without usage, the token counts come from the timings
+			if b.result.promptEvalCount != 12 || b.result.evalCount != 34 || b.result.evalDuration != 250*time.Millisecond {
+				t.Errorf("Unexpected statistics %+v", b.result)
+			}
+		})
+	}
+}
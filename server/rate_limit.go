@@ -0,0 +1,195 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimits restricts how much a single client may use the server.
+// Zero values mean unlimited.
+type RateLimits struct {
+	RequestsPerMinute int   `json:"requests_per_minute"`
+	Concurrent        int   `json:"concurrent"`
+	TokensPerDay      int64 `json:"tokens_per_day"`
+}
+
+func (l RateLimits) unlimited() bool {
+	return l == RateLimits{}
+}
+
+// clientUsage is the recent usage of a single client identity.
+type clientUsage struct {
+	requests []time.Time // start times of requests in the last minute
+	active   int
+	day      time.Time // start of the day tokens are counted for
+	tokens   int64
+}
+
+type rateLimiter struct {
+	lock      sync.Mutex
+	clients   map[string]*clientUsage
+	lastPrune time.Time
+}
+
+// pruneInterval is how often acquire forgets clients that no longer affect any limit.
+const pruneInterval = time.Minute
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		clients: map[string]*clientUsage{},
+	}
+}
+
+// acquire starts a request for client.
+// If the request is over the limits, the time to wait before retrying is returned.
+func (l *rateLimiter) acquire(client string, limits RateLimits, now time.Time) (retryAfter time.Duration, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if now.Sub(l.lastPrune) >= pruneInterval {
+		l.prune(now)
+		l.lastPrune = now
+	}
+
+	usage, ok := l.clients[client]
+	if !ok {
+		usage = &clientUsage{}
+		l.clients[client] = usage
+	}
+
+	// forget requests older than a minute
+	cutoff := now.Add(-time.Minute)
+	for len(usage.requests) > 0 && !usage.requests[0].After(cutoff) {
+		usage.requests = usage.requests[1:]
+	}
+
+	if day := now.UTC().Truncate(24 * time.Hour); !usage.day.Equal(day) {
+		usage.day = day
+		usage.tokens = 0
+	}
+
+	if limits.TokensPerDay > 0 && usage.tokens >= limits.TokensPerDay {
+		return usage.day.Add(24 * time.Hour).Sub(now), fmt.Errorf("daily token quota of %d exceeded", limits.TokensPerDay)
+	}
+
+	if limits.RequestsPerMinute > 0 && len(usage.requests) >= limits.RequestsPerMinute {
+		return usage.requests[0].Add(time.Minute).Sub(now), fmt.Errorf("limit of %d requests per minute exceeded", limits.RequestsPerMinute)
+	}
+
+	if limits.Concurrent > 0 && usage.active >= limits.Concurrent {
+		return time.Second, fmt.Errorf("limit of %d concurrent requests exceeded", limits.Concurrent)
+	}
+
+	usage.requests = append(usage.requests, now)
+	usage.active++
+	return 0, nil
+}
+
+// prune forgets clients without active requests, requests in the last minute, or tokens used today.
+// l.lock must be held.
+func (l *rateLimiter) prune(now time.Time) {
+	cutoff := now.Add(-time.Minute)
+	day := now.UTC().Truncate(24 * time.Hour)
+
+	for client, usage := range l.clients {
+		recent := len(usage.requests) > 0 && usage.requests[len(usage.requests)-1].After(cutoff)
+		if usage.active == 0 && !recent && (usage.tokens == 0 || !usage.day.Equal(day)) {
+			delete(l.clients, client)
+		}
+	}
+}
+
+// release finishes a request for client, charging it tokens.
+func (l *rateLimiter) release(client string, tokens int64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	usage := l.clients[client]
+	usage.active--
+	usage.tokens += tokens
+
+	if usage.active == 0 && usage.tokens == 0 && len(usage.requests) == 0 {
+		delete(l.clients, client)
+	}
+}
+
+// clientIdentity returns the name used to identify the client making r.
+// Without an API key, clients are identified by their address,
+// so every client connecting through a unix socket shares the same identity.
+func clientIdentity(r *http.Request) string {
+	if key := requestKey(r); key != nil {
+		return "key:" + key.Name
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// limitsFor returns the rate limits that apply to r.
+func (s *Server) limitsFor(r *http.Request) RateLimits {
+	if key := requestKey(r); key != nil && key.RateLimits != nil {
+		return *key.RateLimits
+	}
+	return s.RateLimits
+}
+
+// longLivedStreams are endpoints that stay open until the client leaves.
+// They count towards the per-minute request limit, but don't hold a concurrent request slot.
+var longLivedStreams = []string{"/events", "/dashboard/events"}
+
+// rateLimit wraps next with per-client rate limiting.
+// Token usage is read from the request's usage tracker after next returns.
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limits := s.limitsFor(r)
+		if limits.unlimited() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		stream := slices.Contains(longLivedStreams, r.URL.Path)
+		if stream {
+			limits.Concurrent = 0
+		}
+
+		client := clientIdentity(r)
+		retryAfter, err := s.rateLimiter.acquire(client, limits, time.Now())
+		if err != nil {
+			log.Printf("Rate limited %s: %v\n", client, err)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			writeError(w, r, &apiError{
+				Status:  http.StatusTooManyRequests,
+				Message: err.Error(),
+				Type:    "rate_limit_error",
+				Code:    "rate_limit_exceeded",
+			})
+			return
+		}
+
+		if stream {
+			s.rateLimiter.release(client, 0)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var tokens int64
+		defer func() {
+			s.rateLimiter.release(client, tokens)
+		}()
+
+		next.ServeHTTP(w, r)
+
+		prompt, completion := requestUsageOf(r).Tokens()
+		tokens = prompt + completion
+	})
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter()
+	limits := RateLimits{RequestsPerMinute: 2, Concurrent: 1, TokensPerDay: 100}
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, err := rl.acquire("a", limits, now); err != nil {
+		t.Fatalf("Expected first request to be allowed, got %v", err)
+	}
+
+	if _, err := rl.acquire("a", limits, now); err == nil {
+		t.Errorf("Expected concurrent request to be limited")
+	}
+
+	if _, err := rl.acquire("b", limits, now); err != nil {
+		t.Errorf("Expected other clients to be unaffected, got %v", err)
+	}
+
+	rl.release("a", 10)
+	if _, err := rl.acquire("a", limits, now.Add(time.Second)); err != nil {
+		t.Fatalf("Expected second request to be allowed, got %v", err)
+	}
+	rl.release("a", 90)
+
+	retryAfter, err := rl.acquire("a", limits, now.Add(2*time.Second))
+	if err == nil {
+		t.Fatalf("Expected token quota to be exceeded")
+	}
+	if retryAfter != 12*time.Hour-2*time.Second {
+		t.Errorf("Expected retry at the start of the next day, got %v", retryAfter)
+	}
+
+	if _, err := rl.acquire("a", limits, now.Add(24*time.Hour)); err != nil {
+		t.Errorf("Expected quota to reset the next day, got %v", err)
+	}
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+	rl := newRateLimiter()
+	limits := RateLimits{TokensPerDay: 100}
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, client := range []string{"idle", "busy"} {
+		if _, err := rl.acquire(client, limits, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rl.release("idle", 10)
+
+	// the token quota is still remembered later in the day
+	if _, err := rl.acquire("other", limits, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	rl.release("other", 0)
+	if _, ok := rl.clients["idle"]; !ok {
+		t.Errorf("Expected a client with tokens used today to be kept")
+	}
+
+	// but forgotten the next day, unless the client is still active
+	if _, err := rl.acquire("other", limits, now.Add(24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rl.clients["idle"]; ok {
+		t.Errorf("Expected a client without recent usage to be forgotten")
+	}
+	if _, ok := rl.clients["busy"]; !ok {
+		t.Errorf("Expected a client with an active request to be kept")
+	}
+}
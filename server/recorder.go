@@ -0,0 +1,484 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go/v2/option"
+)
+
+// maxRecordedBody is the number of bytes of each body kept in a recording.
+const maxRecordedBody = 1 << 20
+
+// Recording is a client request and the requests sent to the model backend while handling it.
+// Durations are in nanoseconds.
+type Recording struct {
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	Client   string    `json:"client"`
+	Model    string    `json:"model"`
+	Method   string    `json:"method"`
+	Endpoint string    `json:"endpoint"` // the path the client requested
+
+	// the client's request body, kept like exchange bodies
+	ContentType      string          `json:"content_type,omitempty"`
+	Request          json.RawMessage `json:"request,omitempty"`
+	RequestTruncated bool            `json:"request_truncated,omitempty"`
+
+	Status        int           `json:"status"`
+	Redacted      bool          `json:"redacted"`
+	QueueWait     time.Duration `json:"queue_wait"`
+	LoadDuration  time.Duration `json:"load_duration"`
+	TotalDuration time.Duration `json:"total_duration"`
+	Exchanges     []*Exchange   `json:"exchanges"`
+
+	lock  sync.Mutex
+	start time.Time
+}
+
+// Exchange is a request to a model backend and its response.
+// Bodies are kept as JSON if they are valid JSON, or as a JSON string otherwise.
+// Times are measured from the start of the client's request.
+type Exchange struct {
+	Method      string          `json:"method"`
+	Path        string          `json:"path"`
+	ContentType string          `json:"content_type,omitempty"`
+	Request     json.RawMessage `json:"request,omitempty"`
+	Status      int             `json:"status,omitempty"`
+	Response    json.RawMessage `json:"response,omitempty"`
+	Error       string          `json:"error,omitempty"`
+
+	// whether the bodies were longer than was kept
+	RequestTruncated  bool `json:"request_truncated,omitempty"`
+	ResponseTruncated bool `json:"response_truncated,omitempty"`
+
+	Start     time.Duration `json:"start"`
+	FirstByte time.Duration `json:"first_byte,omitempty"` // when the response headers arrived
+	End       time.Duration `json:"end,omitempty"`        // when the response body was read or closed
+}
+
+// RecordedBody returns a body kept in a recording as it was sent.
+func RecordedBody(recorded json.RawMessage) []byte {
+	var text string
+	if json.Unmarshal(recorded, &text) == nil {
+		return []byte(text)
+	}
+	return recorded
+}
+
+// LoadRecording reads a recording written by a Recorder.
+func LoadRecording(path string) (*Recording, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var recording Recording
+	if err := json.Unmarshal(data, &recording); err != nil {
+		return nil, fmt.Errorf("invalid recording %s: %v", path, err)
+	}
+	return &recording, nil
+}
+
+// recordingTimeFormat is the format of the time at the start of recording file names.
+const recordingTimeFormat = "20060102T150405.000000"
+
+// recordingNamePattern matches the names of the files written by a Recorder,
+// which are the recording's time and ID.
+var recordingNamePattern = regexp.MustCompile(`^\d{8}T\d{6}\.\d{6}-[0-9a-f]+\.json$`)
+
+// Recorder writes a Recording of each request that used a model backend to a directory,
+// deleting the oldest recordings beyond a limit.
+type Recorder struct {
+	lock   sync.Mutex
+	dir    string
+	keep   int
+	files  []string // recordings in the directory, oldest first
+	redact bool
+}
+
+// OpenRecorder records to dir, creating it if needed.
+// At most keep recordings are kept. If redact is true, the text of bodies is not recorded.
+func OpenRecorder(dir string, keep int, redact bool) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// only recordings are tracked, so rotating never deletes other files in dir
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && recordingNamePattern.MatchString(entry.Name()) {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	// names start with the time, so they sort by age
+	slices.Sort(files)
+
+	recorder := &Recorder{
+		dir:    dir,
+		keep:   keep,
+		files:  files,
+		redact: redact,
+	}
+
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	recorder.rotate()
+
+	return recorder, nil
+}
+
+// Save writes recording to the directory.
+func (rec *Recorder) Save(recording *Recording) error {
+	recording.lock.Lock()
+	if rec.redact {
+		recording.Redacted = true
+		recording.Request = redactBody(recording.Request)
+		for _, exchange := range recording.Exchanges {
+			exchange.Request = redactBody(exchange.Request)
+			exchange.Response = redactBody(exchange.Response)
+		}
+	}
+	data, err := json.MarshalIndent(recording, "", "  ")
+	recording.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Join(rec.dir, recording.Time.UTC().Format(recordingTimeFormat)+"-"+recording.ID+".json")
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		return err
+	}
+
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	rec.files = append(rec.files, name)
+	rec.rotate()
+
+	return nil
+}
+
+// rotate deletes the oldest recordings beyond the limit.
+// rec.lock must be held.
+func (rec *Recorder) rotate() {
+	for len(rec.files) > rec.keep {
+		if err := os.Remove(rec.files[0]); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete old recording: %v\n", err)
+		}
+		rec.files = rec.files[1:]
+	}
+}
+
+// recordingOf returns the recording attached to r, or nil if r isn't being recorded.
+func recordingOf(r *http.Request) *Recording {
+	recording, _ := r.Context().Value(recordingContextKey).(*Recording)
+	return recording
+}
+
+// recordRequests records requests that used a model backend, if there is a recorder.
+// The request ID is sent to clients in the X-Request-Id header.
+func (s *Server) recordRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Recorder == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var id [8]byte
+		rand.Read(id[:])
+
+		recording := &Recording{
+			ID:    hex.EncodeToString(id[:]),
+			Time:  time.Now().UTC(),
+			start: time.Now(),
+		}
+		w.Header().Set("X-Request-Id", recording.ID)
+
+		r = r.WithContext(context.WithValue(r.Context(), recordingContextKey, recording))
+
+		// keep the client's body as the handler reads it, so it can be replayed
+		body := &recordingBody{
+			ReadCloser: r.Body,
+			done: func(body []byte, truncated bool) {
+				recording.lock.Lock()
+				defer recording.lock.Unlock()
+
+				recording.Request, _ = recordedBody(body)
+				recording.RequestTruncated = truncated
+			},
+		}
+		r.Body = body
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		recording.lock.Lock()
+		exchanges := len(recording.Exchanges)
+		recording.lock.Unlock()
+		if exchanges == 0 {
+			return
+		}
+
+		// the handler may not have read all of the body
+		io.Copy(io.Discard, body)
+		body.finish()
+
+		usage := requestUsageOf(r)
+		recording.Client = clientIdentity(r)
+		recording.Model = usage.Model()
+		recording.Method = r.Method
+		recording.Endpoint = r.URL.Path
+		recording.ContentType = r.Header.Get("Content-Type")
+		recording.Status = recorder.status
+		recording.QueueWait = usage.LockStats.QueueWait
+		recording.LoadDuration = usage.LockStats.LoadDuration
+		recording.TotalDuration = time.Since(recording.start)
+
+		if err := s.Recorder.Save(recording); err != nil {
+			log.Printf("Failed to save recording: %v\n", err)
+		}
+	})
+}
+
+// backendOptions returns the options for requests to the backend made while handling r.
+func backendOptions(r *http.Request) []option.RequestOption {
+	recording := recordingOf(r)
+	if recording == nil {
+		return nil
+	}
+
+	return []option.RequestOption{
+		option.WithMiddleware(func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+			return recording.roundTrip(req, next)
+		}),
+	}
+}
+
+// recordingTransport returns the transport for proxying r to the backend.
+func recordingTransport(r *http.Request) http.RoundTripper {
+	recording := recordingOf(r)
+	if recording == nil {
+		return nil // the default
+	}
+
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return recording.roundTrip(req, http.DefaultTransport.RoundTrip)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper.
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+var _ http.RoundTripper = roundTripperFunc(nil)
+
+// roundTrip sends req with next, recording it and its response.
+func (recording *Recording) roundTrip(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	exchange := &Exchange{
+		Method:      req.Method,
+		Path:        req.URL.Path,
+		ContentType: req.Header.Get("Content-Type"),
+		Start:       time.Since(recording.start),
+	}
+
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		exchange.Request, exchange.RequestTruncated = recordedBody(body)
+	}
+
+	recording.lock.Lock()
+	recording.Exchanges = append(recording.Exchanges, exchange)
+	recording.lock.Unlock()
+
+	resp, err := next(req)
+
+	recording.lock.Lock()
+	defer recording.lock.Unlock()
+
+	exchange.FirstByte = time.Since(recording.start)
+	if err != nil {
+		exchange.Error = err.Error()
+		exchange.End = exchange.FirstByte
+		return resp, err
+	}
+
+	exchange.Status = resp.StatusCode
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		done: func(body []byte, truncated bool) {
+			recording.lock.Lock()
+			defer recording.lock.Unlock()
+
+			exchange.End = time.Since(recording.start)
+			exchange.Response, _ = recordedBody(body)
+			exchange.ResponseTruncated = truncated
+		},
+	}
+
+	return resp, nil
+}
+
+// recordedBody converts a body to JSON for a recording, truncating it if it is too long.
+func recordedBody(body []byte) (recorded json.RawMessage, truncated bool) {
+	if len(body) > maxRecordedBody {
+		body = body[:maxRecordedBody]
+		truncated = true
+	}
+
+	if json.Valid(body) {
+		return slices.Clone(body), truncated
+	}
+
+	recorded, _ = json.Marshal(string(body))
+	return recorded, truncated
+}
+
+// recordingBody keeps the start of a response body as it is read,
+// calling done once it has been fully read or closed.
+type recordingBody struct {
+	io.ReadCloser
+	buffer    bytes.Buffer
+	truncated bool
+	done      func(body []byte, truncated bool)
+	once      sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	keep := min(n, maxRecordedBody-b.buffer.Len())
+	b.buffer.Write(p[:keep])
+	b.truncated = b.truncated || keep < n
+
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+func (b *recordingBody) finish() {
+	b.once.Do(func() {
+		b.done(b.buffer.Bytes(), b.truncated)
+	})
+}
+
+// structuralKeys are the JSON keys whose string values are kept in redacted recordings,
+// since they describe the shape of a request rather than its content.
+var structuralKeys = []string{
+	"model", "role", "type", "object", "id", "name", "tool_call_id", "finish_reason", "reasoning_effort",
+}
+
+// redactBody replaces the text in a recorded body, keeping its structure.
+// Server-sent events are redacted one event at a time.
+func redactBody(body json.RawMessage) json.RawMessage {
+	if len(body) == 0 {
+		return body
+	}
+
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return body
+	}
+
+	text, isText := value.(string)
+	if !isText {
+		redacted, _ := json.Marshal(redactValue(value))
+		return redacted
+	}
+
+	if !strings.HasPrefix(text, "data:") && !strings.HasPrefix(text, "event:") {
+		redacted, _ := json.Marshal(redactedText(text))
+		return redacted
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		data, isData := strings.CutPrefix(line, "data:")
+		if !isData {
+			continue
+		}
+
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			continue
+		}
+
+		var event any
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			lines[i] = "data: " + redactedText(data)
+			continue
+		}
+
+		redacted, _ := json.Marshal(redactValue(event))
+		lines[i] = "data: " + string(redacted)
+	}
+
+	redacted, _ := json.Marshal(strings.Join(lines, "\n"))
+	return redacted
+}
+
+// redactValue replaces the strings in a decoded JSON value, except for those of structural keys.
+func redactValue(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, field := range value {
+			if _, isText := field.(string); isText && slices.Contains(structuralKeys, key) {
+				continue
+			}
+			value[key] = redactValue(field)
+		}
+		return value
+
+	case []any:
+		for i := range value {
+			value[i] = redactValue(value[i])
+		}
+		return value
+
+	case string:
+		return redactedText(value)
+
+	default:
+		return value
+	}
+}
+
+func redactedText(text string) string {
+	if text == "" {
+		return ""
+	}
+	return fmt.Sprintf("[redacted %d bytes]", len(text))
+}
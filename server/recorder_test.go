@@ -0,0 +1,181 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactBody(t *testing.T) {
+	redacted := string(redactBody(json.RawMessage(`{"model":"m","messages":[{"role":"user","content":"secret"}],"max_tokens":5}`)))
+	if strings.Contains(redacted, "secret") {
+		t.Errorf("Expected content to be redacted, got %s", redacted)
+	}
+	for _, kept := range []string{`"model":"m"`, `"role":"user"`, `"max_tokens":5`} {
+		if !strings.Contains(redacted, kept) {
+			t.Errorf("Expected %s to be kept, got %s", kept, redacted)
+		}
+	}
+}
+
+func TestRedactBodyEvents(t *testing.T) {
+	events, _ := json.Marshal("data: {\"choices\":[{\"delta\":{\"content\":\"secret\"}}]}\n\ndata: [DONE]\n\n")
+
+	var redacted string
+	if err := json.Unmarshal(redactBody(events), &redacted); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(redacted, "secret") || !strings.Contains(redacted, "data: [DONE]") {
+		t.Errorf("Unexpected redacted events %q", redacted)
+	}
+}
+
+func TestRedactBodyNonJSONEvents(t *testing.T) {
+	events, _ := json.Marshal("event: text\ndata: secret words\n\ndata: {\"broken\n\ndata: [DONE]\n\n")
+
+	var redacted string
+	if err := json.Unmarshal(redactBody(events), &redacted); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "event: text\ndata: [redacted 12 bytes]\n\ndata: [redacted 8 bytes]\n\ndata: [DONE]\n\n"
+	if redacted != want {
+		t.Errorf("Expected %q, got %q", want, redacted)
+	}
+}
+
+func TestRecorderRotates(t *testing.T) {
+	dir := t.TempDir()
+
+	recorder, err := OpenRecorder(dir, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"a", "b", "c"} {
+		recording := &Recording{ID: id, Time: start.Add(time.Duration(i) * time.Second)}
+		if err := recorder.Save(recording); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 || !strings.HasSuffix(entries[0].Name(), "-b.json") || !strings.HasSuffix(entries[1].Name(), "-c.json") {
+		t.Errorf("Expected only the newest two recordings to be kept, got %v", entries)
+	}
+}
+
+func TestRecorderKeepsOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	others := []string{"config.json", "00000000-notes.json", "20250101T000000.000000-xyz.json"}
+	for _, name := range others {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recorder, err := OpenRecorder(dir, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"a", "b"} {
+		if err := recorder.Save(&Recording{ID: id, Time: start.Add(time.Duration(i) * time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range others {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s to be kept: %v", name, err)
+		}
+	}
+
+	if recordings, _ := filepath.Glob(filepath.Join(dir, "*-b.json")); len(recordings) != 1 {
+		t.Errorf("Expected the newest recording to be kept, got %v", recordings)
+	}
+	if recordings, _ := filepath.Glob(filepath.Join(dir, "*-a.json")); len(recordings) != 0 {
+		t.Errorf("Expected the oldest recording to be deleted, got %v", recordings)
+	}
+}
+
+func TestRecordingTruncation(t *testing.T) {
+	recording := &Recording{start: time.Now()}
+	large := strings.Repeat("x", maxRecordedBody+1)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/completions", strings.NewReader(large))
+	resp, err := recording.roundTrip(req, func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("short"))}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	exchange := recording.Exchanges[0]
+	if !exchange.RequestTruncated || exchange.ResponseTruncated {
+		t.Errorf("Expected only the request to be truncated, got request %v and response %v", exchange.RequestTruncated, exchange.ResponseTruncated)
+	}
+}
+
+func TestRecordRequestsKeepsClientRequest(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := OpenRecorder(dir, 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Recorder: recorder}
+
+	handler := s.recordRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// read only the start of the body, as a JSON decoder might
+		var request struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(io.LimitReader(r.Body, 20)).Decode(&request)
+
+		// the backend is sent a translated request to a different path
+		backendRequest := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"m","messages":[]}`))
+		recordingOf(r).roundTrip(backendRequest, func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		})
+	}))
+
+	clientBody := `{"model":"m","messages":[{"role":"user","content":"hi"}],"stream":false}`
+	r := httptest.NewRequest(http.MethodPost, "/api/chat", strings.NewReader(clientBody))
+	r.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one recording, got %v", files)
+	}
+	recording, err := LoadRecording(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if recording.Method != http.MethodPost || recording.Endpoint != "/api/chat" || recording.ContentType != "application/json" {
+		t.Errorf("Unexpected client request %s %s (%s)", recording.Method, recording.Endpoint, recording.ContentType)
+	}
+	// recordings are indented, so compare the bodies compacted
+	var body bytes.Buffer
+	if err := json.Compact(&body, RecordedBody(recording.Request)); err != nil || body.String() != clientBody {
+		t.Errorf("Expected the whole client body to be kept, got %s", recording.Request)
+	}
+}
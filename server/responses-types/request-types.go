@@ -0,0 +1,78 @@
+package responsestypes
+
+import "encoding/json"
+
+// Request is a request to create a response.
+type Request struct {
+	Model        string          `json:"model"`
+	Input        json.RawMessage `json:"input"` // a string, or a list of InputItem
+	Instructions string          `json:"instructions"`
+	Stream       bool            `json:"stream"`
+
+	Tools             []Tool          `json:"tools"`
+	ToolChoice        json.RawMessage `json:"tool_choice"` // "none", "auto", "required" or a ToolChoice
+	ParallelToolCalls *bool           `json:"parallel_tool_calls"`
+
+	MaxOutputTokens *int64     `json:"max_output_tokens"`
+	Temperature     *float64   `json:"temperature"`
+	TopP            *float64   `json:"top_p"`
+	Reasoning       *Reasoning `json:"reasoning"`
+	Text            *Text      `json:"text"`
+
+	PreviousResponseID string            `json:"previous_response_id"`
+	Metadata           map[string]string `json:"metadata"`
+}
+
+// InputItem is an item of a request's input.
+type InputItem struct {
+	Type string `json:"type"` // "message" if empty, "function_call" or "function_call_output"
+
+	// message
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"` // a string, or a list of ContentPart
+
+	// function_call and function_call_output
+	CallID    string          `json:"call_id"`
+	Name      string          `json:"name"`
+	Arguments string          `json:"arguments"`
+	Output    json.RawMessage `json:"output"` // a string, or a list of ContentPart
+}
+
+// ContentPart is a part of a message's content.
+type ContentPart struct {
+	Type     string `json:"type"` // "input_text", "input_image", "output_text" or "refusal"
+	Text     string `json:"text"`
+	ImageURL string `json:"image_url"`
+	Detail   string `json:"detail"`
+	Refusal  string `json:"refusal"`
+}
+
+type Tool struct {
+	Type        string         `json:"type"` // only "function" is supported
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+	Strict      *bool          `json:"strict,omitempty"`
+}
+
+// ToolChoice forces the use of a tool.
+type ToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type Reasoning struct {
+	Effort string `json:"effort"`
+}
+
+type Text struct {
+	Format *TextFormat `json:"format"`
+}
+
+type TextFormat struct {
+	Type        string         `json:"type"` // "text", "json_object" or "json_schema"
+	Name        string         `json:"name,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Schema      map[string]any `json:"schema,omitempty"`
+	Strict      *bool          `json:"strict,omitempty"`
+}
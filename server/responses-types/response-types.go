@@ -0,0 +1,144 @@
+package responsestypes
+
+import "encoding/json"
+
+type Response struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"` // must equal "response"
+	CreatedAt int64  `json:"created_at"`
+	Status    string `json:"status"` // "in_progress", "completed", "incomplete" or "failed"
+	Model     string `json:"model"`
+
+	Instructions      string             `json:"instructions,omitempty"`
+	Output            []*OutputItem      `json:"output"`
+	Tools             []Tool             `json:"tools"`
+	ToolChoice        json.RawMessage    `json:"tool_choice"`
+	ParallelToolCalls bool               `json:"parallel_tool_calls"`
+	Temperature       *float64           `json:"temperature,omitempty"`
+	TopP              *float64           `json:"top_p,omitempty"`
+	MaxOutputTokens   *int64             `json:"max_output_tokens,omitempty"`
+	Metadata          map[string]string  `json:"metadata"`
+	Usage             *Usage             `json:"usage,omitempty"`
+	IncompleteDetails *IncompleteDetails `json:"incomplete_details"`
+	Error             *Error             `json:"error"`
+}
+
+// OutputItem is an item of a response's output.
+type OutputItem struct {
+	Type   string `json:"type"` // "message", "reasoning" or "function_call"
+	ID     string `json:"id"`
+	Status string `json:"status"` // "in_progress" or "completed"
+
+	// message and reasoning
+	Role    string           `json:"role,omitempty"`
+	Content []*OutputContent `json:"content"`
+
+	// function_call
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+// MarshalJSON implements json.Marshaler, leaving out fields that don't apply to the item's type.
+func (i OutputItem) MarshalJSON() ([]byte, error) {
+	switch i.Type {
+	case "function_call":
+		return json.Marshal(struct {
+			Type      string `json:"type"`
+			ID        string `json:"id"`
+			Status    string `json:"status"`
+			CallID    string `json:"call_id"`
+			Name      string `json:"name"`
+			Arguments string `json:"arguments"`
+		}{i.Type, i.ID, i.Status, i.CallID, i.Name, i.Arguments})
+
+	case "reasoning":
+		return json.Marshal(struct {
+			Type    string           `json:"type"`
+			ID      string           `json:"id"`
+			Status  string           `json:"status"`
+			Summary []*OutputContent `json:"summary"`
+			Content []*OutputContent `json:"content"`
+		}{i.Type, i.ID, i.Status, []*OutputContent{}, nonNil(i.Content)})
+
+	default:
+		return json.Marshal(struct {
+			Type    string           `json:"type"`
+			ID      string           `json:"id"`
+			Status  string           `json:"status"`
+			Role    string           `json:"role"`
+			Content []*OutputContent `json:"content"`
+		}{i.Type, i.ID, i.Status, i.Role, nonNil(i.Content)})
+	}
+}
+
+func nonNil(content []*OutputContent) []*OutputContent {
+	if content == nil {
+		return []*OutputContent{}
+	}
+	return content
+}
+
+// OutputContent is a part of an output item's content.
+type OutputContent struct {
+	Type string `json:"type"` // "output_text" or "reasoning_text"
+	Text string `json:"text"`
+}
+
+// MarshalJSON implements json.Marshaler, adding the annotations of output text.
+func (c OutputContent) MarshalJSON() ([]byte, error) {
+	if c.Type != "output_text" {
+		type plain OutputContent
+		return json.Marshal(plain(c))
+	}
+
+	return json.Marshal(struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		Annotations []any  `json:"annotations"`
+	}{c.Type, c.Text, []any{}})
+}
+
+type Usage struct {
+	InputTokens         int64               `json:"input_tokens"`
+	InputTokensDetails  InputTokensDetails  `json:"input_tokens_details"`
+	OutputTokens        int64               `json:"output_tokens"`
+	OutputTokensDetails OutputTokensDetails `json:"output_tokens_details"`
+	TotalTokens         int64               `json:"total_tokens"`
+}
+
+type InputTokensDetails struct {
+	CachedTokens int64 `json:"cached_tokens"`
+}
+
+type OutputTokensDetails struct {
+	ReasoningTokens int64 `json:"reasoning_tokens"`
+}
+
+type IncompleteDetails struct {
+	Reason string `json:"reason"` // "max_output_tokens"
+}
+
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// StreamEvent is a server-sent event of a streamed response.
+// Fields that don't apply to the event's type are left empty.
+type StreamEvent struct {
+	Type           string `json:"type"`
+	SequenceNumber int64  `json:"sequence_number"`
+
+	Response *Response `json:"response,omitempty"`
+
+	OutputIndex  *int           `json:"output_index,omitempty"`
+	ContentIndex *int           `json:"content_index,omitempty"`
+	ItemID       string         `json:"item_id,omitempty"`
+	Item         *OutputItem    `json:"item,omitempty"`
+	Part         *OutputContent `json:"part,omitempty"`
+
+	Delta     string  `json:"delta,omitempty"`
+	Text      *string `json:"text,omitempty"`
+	Arguments *string `json:"arguments,omitempty"`
+}
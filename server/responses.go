@@ -0,0 +1,666 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+	"github.com/openai/openai-go/v2/packages/param"
+	"github.com/openai/openai-go/v2/shared"
+	responsestypes "github.com/wk-y/rama-swap/server/responses-types"
+)
+
+// createResponse implements the OpenAI Responses API by translating it to a chat completion.
+// Responses aren't stored, so previous_response_id is not supported.
+func (s *Server) createResponse(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.URL)
+
+	var request responsestypes.Request
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Model == "" {
+		log.Println("Bad responses request:", err)
+		writeError(w, r, errBadRequest("invalid request JSON"))
+		return
+	}
+
+	params, err := responsesTranslateParams(request)
+	if err != nil {
+		log.Printf("Failed to translate request: %v\n", err)
+		writeError(w, r, errBadRequest(fmt.Sprintf("failed to translate request: %v", err)))
+		return
+	}
+
+	if err := authorizeModel(r, request.Model); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	requestUsageOf(r).SetModel(request.Model)
+
+	backend, err := s.scheduler.Lock(r.Context(), request.Model)
+	if err != nil {
+		log.Printf("Failed to start model %s: %v\n", request.Model, err)
+		writeError(w, r, err)
+		return
+	}
+	defer s.scheduler.Unlock(backend)
+
+	builder := newResponseBuilder(request, s.StripThinkTags)
+
+	if request.Stream {
+		s.streamResponse(w, r, backend.WithClient, builder, params)
+	} else {
+		s.completeResponse(w, r, backend.WithClient, builder, params)
+	}
+}
+
+// completeResponse gets the whole completion from the backend and replies with the response object.
+func (s *Server) completeResponse(w http.ResponseWriter, r *http.Request, withClient func(func(openai.Client) error) error, builder *responseBuilder, params openai.ChatCompletionNewParams) {
+	if err := completeChat(r, withClient, builder, params); err != nil {
+		log.Println("Error during chat completion:", err)
+		writeError(w, r, errBackend(fmt.Sprintf("model backend failed: %v", err)))
+		return
+	}
+
+	prompt, completionTokens := builder.tokens()
+	requestUsageOf(r).AddTokens(prompt, completionTokens)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(builder.response); err != nil {
+		log.Printf("Failed to reply: %v\n", err)
+	}
+}
+
+// streamResponse streams the completion from the backend as Responses API server-sent events.
+func (s *Server) streamResponse(w http.ResponseWriter, r *http.Request, withClient func(func(openai.Client) error) error, builder *responseBuilder, params openai.ChatCompletionNewParams) {
+	started, err := streamChat(r, withClient, builder, params, func() {
+		send := sseWriter(w)
+		builder.emit = func(event responsestypes.StreamEvent) error {
+			return send(event.Type, event)
+		}
+		builder.start()
+	})
+	if err != nil {
+		log.Println("Error during response stream:", err)
+		if !started {
+			writeError(w, r, errBackend(fmt.Sprintf("model backend failed: %v", err)))
+			return
+		}
+	}
+
+	if builder.err != nil {
+		log.Printf("Failed to send response events: %v\n", builder.err)
+	}
+
+	prompt, completionTokens := builder.tokens()
+	requestUsageOf(r).AddTokens(prompt, completionTokens)
+}
+
+// responseBuilder builds a response from chat completion deltas,
+// emitting the corresponding stream events if emit is set.
+type responseBuilder struct {
+	response *responsestypes.Response
+
+	// emit sends an event to the client, and is nil when not streaming
+	emit     func(responsestypes.StreamEvent) error
+	sequence int64
+	err      error // first error returned by emit, after which nothing more is emitted
+
+	stripThinkTags bool
+	splitter       thinkSplitter
+
+	// open output items
+	reasoning *responsestypes.OutputItem
+	message   *responsestypes.OutputItem
+	calls     map[int64]*responsestypes.OutputItem
+}
+
+func newResponseBuilder(request responsestypes.Request, stripThinkTags bool) *responseBuilder {
+	response := &responsestypes.Response{
+		ID:                newResponseID("resp"),
+		Object:            "response",
+		CreatedAt:         time.Now().Unix(),
+		Status:            "in_progress",
+		Model:             request.Model,
+		Instructions:      request.Instructions,
+		Output:            []*responsestypes.OutputItem{},
+		Tools:             request.Tools,
+		ToolChoice:        request.ToolChoice,
+		ParallelToolCalls: request.ParallelToolCalls == nil || *request.ParallelToolCalls,
+		Temperature:       request.Temperature,
+		TopP:              request.TopP,
+		MaxOutputTokens:   request.MaxOutputTokens,
+		Metadata:          request.Metadata,
+	}
+
+	if response.Tools == nil {
+		response.Tools = []responsestypes.Tool{}
+	}
+
+	if len(response.ToolChoice) == 0 {
+		response.ToolChoice = json.RawMessage(`"auto"`)
+	}
+
+	if response.Metadata == nil {
+		response.Metadata = map[string]string{}
+	}
+
+	return &responseBuilder{
+		response:       response,
+		stripThinkTags: stripThinkTags,
+		calls:          map[int64]*responsestypes.OutputItem{},
+	}
+}
+
+// newResponseID returns a random ID like the ones OpenAI uses, such as resp_0123...
+func newResponseID(prefix string) string {
+	var id [16]byte
+	rand.Read(id[:])
+	return prefix + "_" + hex.EncodeToString(id[:])
+}
+
+func (b *responseBuilder) send(event responsestypes.StreamEvent) {
+	if b.emit == nil || b.err != nil {
+		return
+	}
+
+	event.SequenceNumber = b.sequence
+	b.sequence++
+	b.err = b.emit(event)
+}
+
+// itemEvent returns an event about item.
+func (b *responseBuilder) itemEvent(eventType string, item *responsestypes.OutputItem) responsestypes.StreamEvent {
+	outputIndex := slices.Index(b.response.Output, item)
+	return responsestypes.StreamEvent{
+		Type:        eventType,
+		OutputIndex: &outputIndex,
+		ItemID:      item.ID,
+	}
+}
+
+// contentEvent returns an event about the first content part of item.
+func (b *responseBuilder) contentEvent(eventType string, item *responsestypes.OutputItem) responsestypes.StreamEvent {
+	event := b.itemEvent(eventType, item)
+	contentIndex := 0
+	event.ContentIndex = &contentIndex
+	return event
+}
+
+// start sends the events that begin a response.
+func (b *responseBuilder) start() {
+	b.send(responsestypes.StreamEvent{Type: "response.created", Response: b.response})
+	b.send(responsestypes.StreamEvent{Type: "response.in_progress", Response: b.response})
+}
+
+// openItem adds item to the output, along with an empty content part of type contentType if it isn't "".
+func (b *responseBuilder) openItem(item *responsestypes.OutputItem, contentType string) {
+	item.Status = "in_progress"
+	b.response.Output = append(b.response.Output, item)
+
+	added := b.itemEvent("response.output_item.added", item)
+	added.ItemID = ""
+	added.Item = item
+	b.send(added)
+
+	if contentType != "" {
+		part := &responsestypes.OutputContent{Type: contentType}
+		item.Content = []*responsestypes.OutputContent{part}
+
+		partAdded := b.contentEvent("response.content_part.added", item)
+		partAdded.Part = part
+		b.send(partAdded)
+	}
+}
+
+// closeItem marks item as completed, sending doneType with the item's text before the usual done events.
+func (b *responseBuilder) closeItem(item *responsestypes.OutputItem, doneType string) {
+	if len(item.Content) > 0 {
+		part := item.Content[0]
+
+		textDone := b.contentEvent(doneType, item)
+		textDone.Text = &part.Text
+		b.send(textDone)
+
+		partDone := b.contentEvent("response.content_part.done", item)
+		partDone.Part = part
+		b.send(partDone)
+	}
+
+	item.Status = "completed"
+
+	done := b.itemEvent("response.output_item.done", item)
+	done.ItemID = ""
+	done.Item = item
+	b.send(done)
+}
+
+func (b *responseBuilder) closeReasoning() {
+	if b.reasoning != nil {
+		b.closeItem(b.reasoning, "response.reasoning_text.done")
+		b.reasoning = nil
+	}
+}
+
+func (b *responseBuilder) closeMessage() {
+	if b.message != nil {
+		b.closeItem(b.message, "response.output_text.done")
+		b.message = nil
+	}
+}
+
+func (b *responseBuilder) closeCalls() {
+	indexes := make([]int64, 0, len(b.calls))
+	for index := range b.calls {
+		indexes = append(indexes, index)
+	}
+	slices.Sort(indexes)
+
+	for _, index := range indexes {
+		call := b.calls[index]
+
+		done := b.itemEvent("response.function_call_arguments.done", call)
+		done.Arguments = &call.Arguments
+		b.send(done)
+
+		b.closeItem(call, "")
+	}
+	clear(b.calls)
+}
+
+// addThinking appends reasoning text to the output.
+func (b *responseBuilder) addThinking(text string) {
+	if text == "" {
+		return
+	}
+
+	if b.reasoning == nil {
+		b.closeMessage()
+		b.closeCalls()
+
+		b.reasoning = &responsestypes.OutputItem{
+			Type: "reasoning",
+			ID:   newResponseID("rs"),
+		}
+		b.openItem(b.reasoning, "reasoning_text")
+	}
+
+	b.reasoning.Content[0].Text += text
+
+	delta := b.contentEvent("response.reasoning_text.delta", b.reasoning)
+	delta.Delta = text
+	b.send(delta)
+}
+
+// addText appends message text to the output.
+func (b *responseBuilder) addText(text string) {
+	if b.stripThinkTags {
+		var thinking string
+		text, thinking = b.splitter.Next(text)
+		b.addThinking(thinking)
+	}
+
+	if text == "" {
+		return
+	}
+
+	if b.message == nil {
+		b.closeReasoning()
+		b.closeCalls()
+
+		b.message = &responsestypes.OutputItem{
+			Type: "message",
+			ID:   newResponseID("msg"),
+			Role: "assistant",
+		}
+		b.openItem(b.message, "output_text")
+	}
+
+	b.message.Content[0].Text += text
+
+	delta := b.contentEvent("response.output_text.delta", b.message)
+	delta.Delta = text
+	b.send(delta)
+}
+
+// addToolCall appends to the function call with the given index.
+// id and name are only needed for the first part of each call.
+func (b *responseBuilder) addToolCall(index int64, id, name, arguments string) {
+	call, ok := b.calls[index]
+	if !ok {
+		b.closeReasoning()
+		b.closeMessage()
+
+		if id == "" {
+			id = newResponseID("call")
+		}
+
+		call = &responsestypes.OutputItem{
+			Type:   "function_call",
+			ID:     newResponseID("fc"),
+			CallID: id,
+			Name:   name,
+		}
+		b.calls[index] = call
+		b.openItem(call, "")
+	}
+
+	if arguments == "" {
+		return
+	}
+
+	call.Arguments += arguments
+
+	delta := b.itemEvent("response.function_call_arguments.delta", call)
+	delta.Delta = arguments
+	b.send(delta)
+}
+
+// stopped returns whether emitting an event failed.
+func (b *responseBuilder) stopped() bool {
+	return b.err != nil
+}
+
+// setUsage sets the response's token usage.
+func (b *responseBuilder) setUsage(usage openai.CompletionUsage) {
+	b.response.Usage = &responsestypes.Usage{
+		InputTokens: usage.PromptTokens,
+		InputTokensDetails: responsestypes.InputTokensDetails{
+			CachedTokens: usage.PromptTokensDetails.CachedTokens,
+		},
+		OutputTokens: usage.CompletionTokens,
+		OutputTokensDetails: responsestypes.OutputTokensDetails{
+			ReasoningTokens: usage.CompletionTokensDetails.ReasoningTokens,
+		},
+		TotalTokens: usage.TotalTokens,
+	}
+}
+
+// tokens returns the prompt and completion tokens used, if the backend reported them.
+func (b *responseBuilder) tokens() (prompt, completion int64) {
+	if b.response.Usage == nil {
+		return 0, 0
+	}
+	return b.response.Usage.InputTokens, b.response.Usage.OutputTokens
+}
+
+// closeAll closes the open output items.
+func (b *responseBuilder) closeAll() {
+	if content, thinking := b.splitter.Flush(); content != "" || thinking != "" {
+		b.stripThinkTags = false // the splitter is done
+		b.addThinking(thinking)
+		b.addText(content)
+	}
+
+	b.closeReasoning()
+	b.closeMessage()
+	b.closeCalls()
+}
+
+// finish completes the response, given the chat completion's finish reason.
+func (b *responseBuilder) finish(finishReason string) {
+	b.closeAll()
+
+	if finishReason == "length" {
+		b.response.Status = "incomplete"
+		b.response.IncompleteDetails = &responsestypes.IncompleteDetails{Reason: "max_output_tokens"}
+		b.send(responsestypes.StreamEvent{Type: "response.incomplete", Response: b.response})
+		return
+	}
+
+	b.response.Status = "completed"
+	b.send(responsestypes.StreamEvent{Type: "response.completed", Response: b.response})
+}
+
+// fail ends the response with an error.
+func (b *responseBuilder) fail(err error) {
+	b.closeAll()
+
+	b.response.Status = "failed"
+	b.response.Error = &responsestypes.Error{
+		Code:    "server_error",
+		Message: fmt.Sprintf("model backend failed: %v", err),
+	}
+	b.send(responsestypes.StreamEvent{Type: "response.failed", Response: b.response})
+}
+
+var _ chatBuilder = (*responseBuilder)(nil)
+
+// responsesTranslateParams translates a Responses API request into a chat completion request.
+func responsesTranslateParams(request responsestypes.Request) (completion openai.ChatCompletionNewParams, err error) {
+	if request.PreviousResponseID != "" {
+		return completion, errors.New("previous_response_id is not supported, since responses aren't stored")
+	}
+
+	completion.Model = request.Model
+
+	if request.Instructions != "" {
+		completion.Messages = append(completion.Messages, openai.SystemMessage(request.Instructions))
+	}
+
+	var inputText string
+	var items []responsestypes.InputItem
+	if err := json.Unmarshal(request.Input, &inputText); err == nil {
+		items = []responsestypes.InputItem{{Role: "user", Content: request.Input}}
+	} else if err := json.Unmarshal(request.Input, &items); err != nil {
+		return completion, fmt.Errorf("invalid input: %v", err)
+	}
+
+	if len(items) == 0 {
+		return completion, errors.New("input is required")
+	}
+
+	for i, item := range items {
+		switch item.Type {
+		case "", "message":
+			message, err := responsesTranslateMessage(item)
+			if err != nil {
+				return completion, fmt.Errorf("input item %d: %v", i, err)
+			}
+			completion.Messages = append(completion.Messages, message)
+
+		case "function_call":
+			call := openai.ChatCompletionMessageToolCallUnionParam{
+				OfFunction: &openai.ChatCompletionMessageFunctionToolCallParam{
+					ID: item.CallID,
+					Function: openai.ChatCompletionMessageFunctionToolCallFunctionParam{
+						Name:      item.Name,
+						Arguments: item.Arguments,
+					},
+				},
+			}
+
+			// consecutive calls were made by a single assistant message
+			if n := len(completion.Messages); n > 0 && completion.Messages[n-1].OfAssistant != nil {
+				assistant := completion.Messages[n-1].OfAssistant
+				assistant.ToolCalls = append(assistant.ToolCalls, call)
+			} else {
+				completion.Messages = append(completion.Messages, openai.ChatCompletionMessageParamUnion{
+					OfAssistant: &openai.ChatCompletionAssistantMessageParam{
+						ToolCalls: []openai.ChatCompletionMessageToolCallUnionParam{call},
+					},
+				})
+			}
+
+		case "function_call_output":
+			output, _, err := responsesContentText(item.Output)
+			if err != nil {
+				return completion, fmt.Errorf("input item %d: %v", i, err)
+			}
+			completion.Messages = append(completion.Messages, openai.ToolMessage(output, item.CallID))
+
+		case "reasoning":
+			// backends don't use the reasoning of previous turns
+
+		default:
+			return completion, fmt.Errorf("input item %d: unsupported type %q", i, item.Type)
+		}
+	}
+
+	for _, tool := range request.Tools {
+		if tool.Type != "function" {
+			return completion, fmt.Errorf("unsupported tool type %q, only function tools are supported", tool.Type)
+		}
+
+		function := shared.FunctionDefinitionParam{
+			Name:       tool.Name,
+			Parameters: tool.Parameters,
+		}
+		if tool.Description != "" {
+			function.Description = openai.String(tool.Description)
+		}
+		if tool.Strict != nil {
+			function.Strict = openai.Bool(*tool.Strict)
+		}
+
+		completion.Tools = append(completion.Tools, openai.ChatCompletionFunctionTool(function))
+	}
+
+	if len(request.ToolChoice) > 0 {
+		var mode string
+		var choice responsestypes.ToolChoice
+		if err := json.Unmarshal(request.ToolChoice, &mode); err == nil {
+			completion.ToolChoice.OfAuto = param.NewOpt(mode)
+		} else if err := json.Unmarshal(request.ToolChoice, &choice); err == nil && choice.Type == "function" {
+			completion.ToolChoice.OfFunctionToolChoice = &openai.ChatCompletionNamedToolChoiceParam{
+				Function: openai.ChatCompletionNamedToolChoiceFunctionParam{Name: choice.Name},
+			}
+		} else {
+			return completion, errors.New("unsupported tool_choice")
+		}
+	}
+
+	if request.ParallelToolCalls != nil {
+		completion.ParallelToolCalls = openai.Bool(*request.ParallelToolCalls)
+	}
+
+	if request.MaxOutputTokens != nil {
+		completion.MaxCompletionTokens = openai.Int(*request.MaxOutputTokens)
+	}
+
+	if request.Temperature != nil {
+		completion.Temperature = openai.Float(*request.Temperature)
+	}
+
+	if request.TopP != nil {
+		completion.TopP = openai.Float(*request.TopP)
+	}
+
+	if request.Reasoning != nil && request.Reasoning.Effort != "" {
+		completion.ReasoningEffort = openai.ReasoningEffort(request.Reasoning.Effort)
+	}
+
+	if request.Text != nil && request.Text.Format != nil {
+		format := request.Text.Format
+		switch format.Type {
+		case "text":
+		case "json_object":
+			completion.ResponseFormat.OfJSONObject = &shared.ResponseFormatJSONObjectParam{}
+		case "json_schema":
+			schema := shared.ResponseFormatJSONSchemaJSONSchemaParam{
+				Name:   format.Name,
+				Schema: format.Schema,
+			}
+			if format.Description != "" {
+				schema.Description = openai.String(format.Description)
+			}
+			if format.Strict != nil {
+				schema.Strict = openai.Bool(*format.Strict)
+			}
+			completion.ResponseFormat.OfJSONSchema = &shared.ResponseFormatJSONSchemaParam{JSONSchema: schema}
+		default:
+			return completion, fmt.Errorf("unsupported text format %q", format.Type)
+		}
+	}
+
+	return completion, nil
+}
+
+// responsesTranslateMessage translates a message input item into a chat message.
+func responsesTranslateMessage(item responsestypes.InputItem) (openai.ChatCompletionMessageParamUnion, error) {
+	switch item.Role {
+	case "user":
+		var text string
+		if err := json.Unmarshal(item.Content, &text); err == nil {
+			return openai.UserMessage(text), nil
+		}
+
+		var parts []responsestypes.ContentPart
+		if err := json.Unmarshal(item.Content, &parts); err != nil {
+			return openai.ChatCompletionMessageParamUnion{}, fmt.Errorf("invalid content: %v", err)
+		}
+
+		var content []openai.ChatCompletionContentPartUnionParam
+		for _, part := range parts {
+			switch part.Type {
+			case "input_text":
+				content = append(content, openai.TextContentPart(part.Text))
+			case "input_image":
+				if part.ImageURL == "" {
+					return openai.ChatCompletionMessageParamUnion{}, errors.New("images must be given by image_url")
+				}
+				content = append(content, openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{
+					URL:    part.ImageURL,
+					Detail: part.Detail,
+				}))
+			default:
+				return openai.ChatCompletionMessageParamUnion{}, fmt.Errorf("unsupported content type %q", part.Type)
+			}
+		}
+		return openai.UserMessage(content), nil
+
+	case "system", "developer":
+		text, _, err := responsesContentText(item.Content)
+		if err != nil {
+			return openai.ChatCompletionMessageParamUnion{}, err
+		}
+		return openai.SystemMessage(text), nil
+
+	case "assistant":
+		text, refusal, err := responsesContentText(item.Content)
+		if err != nil {
+			return openai.ChatCompletionMessageParamUnion{}, err
+		}
+
+		message := openai.AssistantMessage(text)
+		if refusal != "" {
+			message.OfAssistant.Refusal = openai.String(refusal)
+		}
+		return message, nil
+
+	default:
+		return openai.ChatCompletionMessageParamUnion{}, fmt.Errorf("unsupported role %q", item.Role)
+	}
+}
+
+// responsesContentText returns the text and refusals of content, which is a string or a list of text parts.
+func responsesContentText(content json.RawMessage) (text, refusal string, err error) {
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text, "", nil
+	}
+
+	var parts []responsestypes.ContentPart
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return "", "", fmt.Errorf("invalid content: %v", err)
+	}
+
+	var texts, refusals strings.Builder
+	for _, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text":
+			texts.WriteString(part.Text)
+		case "refusal":
+			refusals.WriteString(part.Refusal)
+		default:
+			return "", "", fmt.Errorf("unsupported content type %q", part.Type)
+		}
+	}
+	return texts.String(), refusals.String(), nil
+}
@@ -0,0 +1,303 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go/v2"
+	responsestypes "github.com/wk-y/rama-swap/server/responses-types"
+)
+
+func TestResponsesTranslateParams(t *testing.T) {
+	var request responsestypes.Request
+	err := json.Unmarshal([]byte(`{
+		"model": "m",
+		"instructions": "be brief",
+		"input": [
+			{"role": "user", "content": "what is 6*7?"},
+			{"type": "function_call", "call_id": "a", "name": "multiply", "arguments": "{}"},
+			{"type": "function_call", "call_id": "b", "name": "multiply", "arguments": "{}"},
+			{"type": "function_call_output", "call_id": "a", "output": "42"}
+		],
+		"tools": [{"type": "function", "name": "multiply", "parameters": {"type": "object"}}],
+		"tool_choice": {"type": "function", "name": "multiply"},
+		"max_output_tokens": 100
+	}`), &request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := responsesTranslateParams(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(params.Messages) != 4 {
+		t.Fatalf("Expected 4 messages, got %d", len(params.Messages))
+	}
+
+	if params.Messages[0].OfSystem == nil || params.Messages[1].OfUser == nil || params.Messages[3].OfTool == nil {
+		t.Error("Unexpected message roles")
+	}
+
+	if assistant := params.Messages[2].OfAssistant; assistant == nil || len(assistant.ToolCalls) != 2 {
+		t.Error("Expected consecutive function calls to be merged into one assistant message")
+	}
+
+	if len(params.Tools) != 1 || params.ToolChoice.OfFunctionToolChoice == nil {
+		t.Error("Expected the tool and tool choice to be translated")
+	}
+
+	if params.MaxCompletionTokens.Value != 100 {
+		t.Errorf("Expected max_completion_tokens 100, got %d", params.MaxCompletionTokens.Value)
+	}
+}
+
+func TestResponsesTranslateParamsStringInput(t *testing.T) {
+	params, err := responsesTranslateParams(responsestypes.Request{Model: "m", Input: json.RawMessage(`"hi"`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(params.Messages) != 1 || params.Messages[0].OfUser == nil {
+		t.Error("Expected a single user message")
+	}
+}
+
+func TestResponsesTranslateParamsUnsupported(t *testing.T) {
+	for _, request := range []string{
+		`{"model": "m", "input": "hi", "previous_response_id": "resp_1"}`,
+		`{"model": "m", "input": "hi", "tools": [{"type": "web_search"}]}`,
+		`{"model": "m", "input": [{"type": "file_search_call"}]}`,
+	} {
+		var r responsestypes.Request
+		if err := json.Unmarshal([]byte(request), &r); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := responsesTranslateParams(r); err == nil {
+			t.Errorf("Expected an error for %s", request)
+		}
+	}
+}
+
+// recordEvents makes b emit to the returned slice.
+func recordEvents(b *responseBuilder) *[]responsestypes.StreamEvent {
+	var events []responsestypes.StreamEvent
+	b.emit = func(event responsestypes.StreamEvent) error {
+		events = append(events, event)
+		return nil
+	}
+	return &events
+}
+
+// summarizeEvents describes each event by its type, output index and delta,
+// checking that sequence numbers count up from 0.
+func summarizeEvents(t *testing.T, events []responsestypes.StreamEvent) []string {
+	t.Helper()
+
+	var summary []string
+	for i, event := range events {
+		if event.SequenceNumber != int64(i) {
+			t.Errorf("Expected event %d to have sequence number %d, got %d", i, i, event.SequenceNumber)
+		}
+
+		line := event.Type
+		if event.OutputIndex != nil {
+			line += fmt.Sprintf(" %d", *event.OutputIndex)
+		}
+		if event.Delta != "" {
+			line += " " + event.Delta
+		}
+		summary = append(summary, line)
+	}
+	return summary
+}
+
+// checkLastEvents checks the summaries of the last len(want) events.
+func checkLastEvents(t *testing.T, events []responsestypes.StreamEvent, want ...string) {
+	t.Helper()
+	got := summarizeEvents(t, events)
+	if len(got) > len(want) {
+		got = got[len(got)-len(want):]
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Unexpected events:\n%s\nexpected:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestResponseBuilderItemOrder(t *testing.T) {
+	b := newResponseBuilder(responsestypes.Request{Model: "m"}, false)
+	events := recordEvents(b)
+
+	b.start()
+	b.addThinking("a")
+	b.addThinking("b")
+	b.addText("c")
+	b.addThinking("d")
+	b.finish("stop")
+
+	checkLastEvents(t, *events,
+		"response.created",
+		"response.in_progress",
+		"response.output_item.added 0",
+		"response.content_part.added 0",
+		"response.reasoning_text.delta 0 a",
+		"response.reasoning_text.delta 0 b",
+		"response.reasoning_text.done 0",
+		"response.content_part.done 0",
+		"response.output_item.done 0",
+		"response.output_item.added 1",
+		"response.content_part.added 1",
+		"response.output_text.delta 1 c",
+		"response.output_text.done 1",
+		"response.content_part.done 1",
+		"response.output_item.done 1",
+		"response.output_item.added 2",
+		"response.content_part.added 2",
+		"response.reasoning_text.delta 2 d",
+		"response.reasoning_text.done 2",
+		"response.content_part.done 2",
+		"response.output_item.done 2",
+		"response.completed",
+	)
+
+	output := b.response.Output
+	if len(output) != 3 || output[0].Content[0].Text != "ab" || output[1].Content[0].Text != "c" || output[2].Content[0].Text != "d" {
+		t.Errorf("Unexpected output %+v", output)
+	}
+	for _, item := range output {
+		if item.Status != "completed" {
+			t.Errorf("Expected item %s to be completed, got %q", item.ID, item.Status)
+		}
+	}
+	if b.response.Status != "completed" {
+		t.Errorf("Expected the response to be completed, got %q", b.response.Status)
+	}
+}
+
+func TestResponseBuilderInterleavedToolCalls(t *testing.T) {
+	b := newResponseBuilder(responsestypes.Request{Model: "m"}, false)
+	events := recordEvents(b)
+
+	b.start()
+	b.addText("calling")
+	b.addToolCall(0, "call_a", "first", `{"x"`)
+	b.addToolCall(1, "call_b", "second", `{`)
+	b.addToolCall(0, "", "", `:1}`)
+	b.addToolCall(1, "", "", `}`)
+	b.finish("tool_calls")
+
+	checkLastEvents(t, *events,
+		"response.output_item.added 0",
+		"response.content_part.added 0",
+		"response.output_text.delta 0 calling",
+		"response.output_text.done 0",
+		"response.content_part.done 0",
+		"response.output_item.done 0",
+		"response.output_item.added 1",
+		`response.function_call_arguments.delta 1 {"x"`,
+		"response.output_item.added 2",
+		"response.function_call_arguments.delta 2 {",
+		"response.function_call_arguments.delta 1 :1}",
+		"response.function_call_arguments.delta 2 }",
+		"response.function_call_arguments.done 1",
+		"response.output_item.done 1",
+		"response.function_call_arguments.done 2",
+		"response.output_item.done 2",
+		"response.completed",
+	)
+
+	output := b.response.Output
+	if len(output) != 3 {
+		t.Fatalf("Expected 3 output items, got %d", len(output))
+	}
+	if call := output[1]; call.CallID != "call_a" || call.Name != "first" || call.Arguments != `{"x":1}` {
+		t.Errorf("Unexpected first call %+v", call)
+	}
+	if call := output[2]; call.CallID != "call_b" || call.Name != "second" || call.Arguments != `{}` {
+		t.Errorf("Unexpected second call %+v", call)
+	}
+}
+
+func TestResponseBuilderIncomplete(t *testing.T) {
+	b := newResponseBuilder(responsestypes.Request{Model: "m"}, false)
+	events := recordEvents(b)
+
+	b.start()
+	b.addText("cut")
+	b.finish("length")
+
+	checkLastEvents(t, *events,
+		"response.output_item.done 0",
+		"response.incomplete",
+	)
+
+	if b.response.Status != "incomplete" || b.response.IncompleteDetails == nil || b.response.IncompleteDetails.Reason != "max_output_tokens" {
+		t.Errorf("Expected the response to be incomplete for max_output_tokens, got %+v", b.response)
+	}
+}
+
+func TestResponseBuilderFail(t *testing.T) {
+	b := newResponseBuilder(responsestypes.Request{Model: "m"}, false)
+	events := recordEvents(b)
+
+	b.start()
+	b.addText("partial")
+	b.addToolCall(0, "call_a", "f", "{")
+	b.fail(errors.New("backend crashed"))
+
+	checkLastEvents(t, *events,
+		"response.function_call_arguments.done 1",
+		"response.output_item.done 1",
+		"response.failed",
+	)
+
+	if b.response.Status != "failed" || b.response.Error == nil || !strings.Contains(b.response.Error.Message, "backend crashed") {
+		t.Errorf("Expected the response to fail with the backend's error, got %+v", b.response)
+	}
+}
+
+func TestResponseBuilderEmitError(t *testing.T) {
+	b := newResponseBuilder(responsestypes.Request{Model: "m"}, false)
+
+	emitted := 0
+	b.emit = func(event responsestypes.StreamEvent) error {
+		emitted++
+		if emitted == 3 {
+			return errors.New("client went away")
+		}
+		return nil
+	}
+
+	b.start()
+	b.addText("hello")
+	b.finish("stop")
+
+	if emitted != 3 || b.err == nil {
+		t.Errorf("Expected events to stop after the failed emit, got %d events and error %v", emitted, b.err)
+	}
+	if b.response.Status != "completed" {
+		t.Errorf("Expected the response to still be completed, got %q", b.response.Status)
+	}
+}
+
+func TestResponseBuilderComplete(t *testing.T) {
+	b := newResponseBuilder(responsestypes.Request{Model: "m"}, true)
+
+	b.addText("<think>hmm</think>answer")
+	b.setUsage(openai.CompletionUsage{PromptTokens: 3, CompletionTokens: 4})
+	b.finish("stop")
+
+	output := b.response.Output
+	if len(output) != 2 || output[0].Type != "reasoning" || output[0].Content[0].Text != "hmm" || output[1].Content[0].Text != "answer" {
+		t.Errorf("Expected think tags to become reasoning, got %+v", output)
+	}
+	if prompt, completion := b.tokens(); prompt != 3 || completion != 4 {
+		t.Errorf("Expected 3 and 4 tokens, got %d and %d", prompt, completion)
+	}
+}
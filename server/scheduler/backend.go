@@ -1,10 +1,17 @@
 package scheduler
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/openai/openai-go/v2"
@@ -15,20 +22,26 @@ type backend struct {
 	sync.RWMutex
 	Ready    chan struct{}
 	Exited   chan struct{}
-	port     int
+	port     int // 0 once the backend has exited
 	portLock sync.RWMutex
 	err      error
 	cancel   func()
+
+	startPort  int    // port the backend was started on, kept after it exits
+	stopReason string // why the scheduler stopped the backend, if it did
+	portTaken  bool   // whether the backend exited while another server was listening on its port
+
+	// set for externally managed upstreams, which don't use port
+	upstream *Upstream
 }
 
-func (b *backend) healthCheck() bool {
-	// /health is more accurate but might be llama-server specific
-	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%v/health", b.port))
-	if err != nil {
-		return false
+// baseURL returns the root URL of the backend's server.
+// b.portLock must be held.
+func (b *backend) baseURL() string {
+	if b.upstream != nil {
+		return b.upstream.BaseURL
 	}
-	resp.Body.Close()
-	return resp.StatusCode == http.StatusOK
+	return fmt.Sprintf("http://127.0.0.1:%v", b.port)
 }
 
 // WithClient runs callback with a client configured to use the backend.
@@ -38,17 +51,28 @@ func (b *backend) WithClient(callback func(openai.Client) error) error {
 	b.portLock.RLock()
 	defer b.portLock.RUnlock()
 
-	if b.port == 0 { // port was freed
+	if b.upstream == nil && b.port == 0 { // port was freed
 		return errors.New("backend is dead")
 	}
 
-	client := openai.NewClient(
+	options := []option.RequestOption{
 		option.WithAPIKey(""),
 		option.WithOrganization(""),
 		option.WithProject(""),
 		option.WithWebhookSecret(""),
-		option.WithBaseURL(fmt.Sprintf("http://127.0.0.1:%v", b.port)),
-	)
+		option.WithBaseURL(b.baseURL() + "/v1/"),
+	}
+
+	if b.upstream != nil {
+		if b.upstream.APIKey != "" {
+			options = append(options, option.WithAPIKey(b.upstream.APIKey))
+		}
+		if b.upstream.Model != "" {
+			options = append(options, option.WithJSONSet("model", b.upstream.Model))
+		}
+	}
+
+	client := openai.NewClient(options...)
 
 	return callback(client)
 }
@@ -56,9 +80,61 @@ func (b *backend) WithClient(callback func(openai.Client) error) error {
 func (b *backend) Proxy() *httputil.ReverseProxy {
 	return &httputil.ReverseProxy{
 		Rewrite: func(pr *httputil.ProxyRequest) {
+			b.portLock.RLock()
+			base, err := url.Parse(b.baseURL())
+			b.portLock.RUnlock()
+			if err != nil {
+				base = &url.URL{}
+			}
+
 			*pr.Out.URL = *pr.In.URL
-			pr.Out.URL.Host = fmt.Sprintf("127.0.0.1:%v", b.port)
-			pr.Out.URL.Scheme = "http"
+			pr.Out.URL.Scheme = base.Scheme
+			pr.Out.URL.Host = base.Host
+			pr.Out.URL.Path = base.Path + pr.In.URL.Path
+			pr.Out.URL.RawPath = ""
+			pr.Out.Host = ""
+
+			// never forward the client's credentials for rama-swap
+			pr.Out.Header.Del("Authorization")
+			pr.Out.Header.Del("X-Api-Key")
+
+			if b.upstream != nil {
+				if b.upstream.APIKey != "" {
+					pr.Out.Header.Set("Authorization", "Bearer "+b.upstream.APIKey)
+				}
+				if b.upstream.Model != "" {
+					rewriteModel(pr.Out, b.upstream.Model)
+				}
+			}
 		},
 	}
 }
+
+// rewriteModel replaces the model named by a request's query parameter or JSON body.
+// Other kinds of bodies are left unchanged.
+func rewriteModel(r *http.Request, model string) {
+	if query := r.URL.Query(); query.Has("model") {
+		query.Set("model", model)
+		r.URL.RawQuery = query.Encode()
+	}
+
+	// bodies without the right content type might still be JSON, as with curl -d
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); r.Body == nil || strings.HasPrefix(mediaType, "multipart/") {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+
+	var fields map[string]json.RawMessage
+	if err == nil && json.Unmarshal(body, &fields) == nil && fields["model"] != nil {
+		fields["model"], _ = json.Marshal(model)
+		if rewritten, err := json.Marshal(fields); err == nil {
+			body = rewritten
+		}
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+}
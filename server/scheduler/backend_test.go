@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRewriteModel(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		wantQuery   string
+		wantModel   string // model in the rewritten JSON body, if any
+		wantBody    string // exact body, if not JSON with a model
+	}{
+		{"json", "/v1/chat/completions", "application/json", `{"model":"local","messages":[]}`, "", "remote", ""},
+		{"json without content type", "/v1/chat/completions", "", `{"model":"local"}`, "", "remote", ""},
+		{"json without model", "/v1/embeddings", "application/json", `{"input":"x"}`, "", "", `{"input":"x"}`},
+		{"not json", "/completion", "text/plain", `model=local`, "", "", `model=local`},
+		{"multipart", "/v1/audio/transcriptions", "multipart/form-data; boundary=x", "--x--", "", "", "--x--"},
+		{"query", "/v1/models?model=local&x=1", "", ``, "model=remote&x=1", "", ``},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tc.target, strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+
+			rewriteModel(r, "remote")
+
+			if tc.wantQuery != "" && r.URL.RawQuery != tc.wantQuery {
+				t.Errorf("Expected query %q, got %q", tc.wantQuery, r.URL.RawQuery)
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.wantModel != "" {
+				var fields map[string]any
+				if err := json.Unmarshal(body, &fields); err != nil || fields["model"] != tc.wantModel {
+					t.Errorf("Expected model %q in body, got %s", tc.wantModel, body)
+				}
+			} else if string(body) != tc.wantBody {
+				t.Errorf("Expected body %q, got %q", tc.wantBody, body)
+			}
+
+			if length := r.Header.Get("Content-Length"); length != "" && length != strconv.Itoa(len(body)) {
+				t.Errorf("Content-Length %s doesn't match the body length %d", length, len(body))
+			}
+			if r.ContentLength != int64(len(body)) {
+				t.Errorf("ContentLength %d doesn't match the body length %d", r.ContentLength, len(body))
+			}
+		})
+	}
+}
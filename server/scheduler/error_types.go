@@ -0,0 +1,48 @@
+package scheduler
+
+import "fmt"
+
+// ErrModelNotFound is returned by Lock when the requested model is not installed.
+type ErrModelNotFound struct {
+	Model string
+}
+
+// Error implements error.
+func (e ErrModelNotFound) Error() string {
+	return fmt.Sprintf("model %q not found", e.Model)
+}
+
+var _ error = ErrModelNotFound{}
+
+// ErrBackendFailed is returned by Lock when the backend for a model could not
+// be started or exited before becoming ready.
+type ErrBackendFailed struct {
+	Model string
+	Err   error
+}
+
+// Error implements error.
+func (e ErrBackendFailed) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("backend for model %q failed", e.Model)
+	}
+	return fmt.Sprintf("backend for model %q failed: %v", e.Model, e.Err)
+}
+
+func (e ErrBackendFailed) Unwrap() error {
+	return e.Err
+}
+
+var _ error = ErrBackendFailed{}
+
+// ErrNoFreePort is returned when every port in the backend port range is in use.
+type ErrNoFreePort struct {
+	Ports PortRange
+}
+
+// Error implements error.
+func (e ErrNoFreePort) Error() string {
+	return fmt.Sprintf("no free port in range %v", e.Ports)
+}
+
+var _ error = ErrNoFreePort{}
@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// EventType identifies a scheduler lifecycle event.
+type EventType string
+
+const (
+	EventLoadStart  EventType = "load-start"  // a backend process was started
+	EventReady      EventType = "ready"       // a backend became ready to serve requests
+	EventUnload     EventType = "unload"      // a backend was stopped by the scheduler
+	EventCrash      EventType = "crash"       // a backend exited without being stopped
+	EventQueueEnter EventType = "queue-enter" // a request started waiting for a model
+	EventQueueExit  EventType = "queue-exit"  // a request stopped waiting for a model
+	EventUnlock     EventType = "unlock"      // a request finished using the local backend
+)
+
+// Event is published by the scheduler when backends or requests change state.
+// Fields that don't apply to the event's type are left empty.
+type Event struct {
+	Type  EventType `json:"type"`
+	Time  time.Time `json:"time"`
+	Model string    `json:"model"`
+
+	Port int `json:"port,omitempty"` // load-start
+
+	LoadDuration time.Duration `json:"load_duration,omitempty"` // ready
+	Uptime       time.Duration `json:"uptime,omitempty"`        // unload, crash
+	QueueWait    time.Duration `json:"queue_wait,omitempty"`    // queue-exit
+
+	Reason string `json:"reason,omitempty"` // unload: "swap", "idle" or "request"
+	Error  string `json:"error,omitempty"`  // crash, and queue-exit when Lock failed
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind before events are dropped.
+const subscriberBuffer = 64
+
+// eventBus delivers events to subscribers without blocking the scheduler.
+type eventBus struct {
+	lock        sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// Subscribe returns a channel of published events, and a function that must be called to stop receiving them.
+// Events are dropped if the channel isn't drained quickly enough.
+func (b *eventBus) Subscribe() (<-chan Event, func()) {
+	events := make(chan Event, subscriberBuffer)
+
+	b.lock.Lock()
+	if b.subscribers == nil {
+		b.subscribers = map[chan Event]struct{}{}
+	}
+	b.subscribers[events] = struct{}{}
+	b.lock.Unlock()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			b.lock.Lock()
+			delete(b.subscribers, events)
+			b.lock.Unlock()
+			close(events)
+		})
+	}
+}
+
+func (b *eventBus) publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for events := range b.subscribers {
+		select {
+		case events <- event:
+		default:
+			log.Printf("Dropped %s event for a slow subscriber\n", event.Type)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package scheduler
+
+import "testing"
+
+func TestEventBus(t *testing.T) {
+	var bus eventBus
+
+	events, cancel := bus.Subscribe()
+	bus.publish(Event{Type: EventReady, Model: "a"})
+
+	event := <-events
+	if event.Type != EventReady || event.Model != "a" || event.Time.IsZero() {
+		t.Errorf("Unexpected event %+v", event)
+	}
+
+	cancel()
+	cancel()
+	bus.publish(Event{Type: EventUnload, Model: "a"})
+
+	if _, ok := <-events; ok {
+		t.Error("Expected no events after cancelling the subscription")
+	}
+}
+
+func TestEventBusDropsForSlowSubscribers(t *testing.T) {
+	var bus eventBus
+
+	events, cancel := bus.Subscribe()
+	defer cancel()
+
+	for range subscriberBuffer + 10 {
+		bus.publish(Event{Type: EventQueueEnter})
+	}
+
+	if len(events) != subscriberBuffer {
+		t.Errorf("Expected %d buffered events, got %d", subscriberBuffer, len(events))
+	}
+}
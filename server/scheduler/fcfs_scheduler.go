@@ -2,8 +2,8 @@ package scheduler
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"runtime"
@@ -16,11 +16,12 @@ import (
 // fcfsScheduler is a ModelScheduler that implements (roughly) first-come-first-serve
 // access with at most one model loaded at a time.
 type fcfsScheduler struct {
-	port        int // port to attach the backend to
+	ports       *portManager // ports to attach backends to
 	idleTimeout time.Duration
 
 	lock     sync.Mutex
-	ramalama ramalama.Ramalama
+	provider ramalama.ModelProvider
+	catalog  *ramalama.Catalog
 
 	// rules for using the backend properties:
 	// backendCond must be held while changing any of the backend properties
@@ -32,28 +33,72 @@ type fcfsScheduler struct {
 	backendIdleAt  time.Time
 	backendLocking bool
 
-	// cached set of valid model names
-	ramalamaModelsCache     map[string]struct{}
-	ramalamaModelsCacheLock sync.Mutex
+	// keep alive duration requested by the backend's most recent user, see WithKeepAlive
+	backendKeepAlive    time.Duration
+	backendKeepAliveSet bool
+
+	// externally managed backends, by model name
+	upstreams map[string]*backend
+
+	// per-model settings, which must not be changed after the scheduler is used
+	options map[string]ModelOptions
+
+	// copy of backend and backendModel that can be read without waiting for backendCond,
+	// which is held while a model loads
+	statusLock    sync.Mutex
+	statusBackend *backend
+	statusModel   string
+	statusUsers   int
+	statusQueued  int
+	swaps         []Swap
+
+	logs   logBuffer
+	events eventBus
 }
 
 // Lock implements ModelScheduler.
 func (f *fcfsScheduler) Lock(ctx context.Context, model string) (*backend, error) {
+	// upstreams are always available, and don't affect the loaded model
+	if upstream, ok := f.upstreams[model]; ok {
+		return upstream, nil
+	}
+
 	exists, err := f.modelExists(model)
 	if err != nil {
 		return nil, err
 	}
 
 	if !exists {
-		return nil, errors.New("nonexistent model")
+		return nil, ErrModelNotFound{Model: model}
+	}
+
+	// status changes come before their events, so subscribers reading Status see them
+	f.addQueued(1)
+	f.events.publish(Event{Type: EventQueueEnter, Model: model})
+	queueStart := time.Now()
+
+	backend, err := f.lockLocal(ctx, model, queueStart)
+
+	f.addQueued(-1)
+	exit := Event{Type: EventQueueExit, Model: model, QueueWait: time.Since(queueStart)}
+	if err != nil {
+		exit.Error = err.Error()
 	}
+	f.events.publish(exit)
+
+	return backend, err
+}
+
+// lockLocal is Lock for models with a local backend.
+func (f *fcfsScheduler) lockLocal(ctx context.Context, model string, queueStart time.Time) (*backend, error) {
+	stats := lockStatsFrom(ctx)
 
 	f.lock.Lock()
 	defer f.lock.Unlock()
 
 	select {
 	case <-ctx.Done():
-		return nil, errors.New("context cancelled")
+		return nil, ctx.Err()
 	default:
 	}
 
@@ -61,12 +106,21 @@ func (f *fcfsScheduler) Lock(ctx context.Context, model string) (*backend, error
 	defer f.backendCond.L.Unlock()
 
 	if f.backend != nil && f.backendModel == model {
+		// the backend may still be loading if the Lock that started it gave up waiting
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-f.backend.Ready:
+		}
+
 		// if it is exited, don't return the backend
 		select {
 		case <-f.backend.Exited:
 		default:
-			f.backendUsers++
+			f.addUsers(1)
+			f.setKeepAlive(ctx)
 			f.backendCond.Broadcast()
+			stats.QueueWait = time.Since(queueStart)
 			return f.backend, nil
 		}
 	}
@@ -75,76 +129,305 @@ func (f *fcfsScheduler) Lock(ctx context.Context, model string) (*backend, error
 		f.backendCond.Wait()
 	}
 
+	previous := f.backendModel
 	if f.backend != nil {
-		f.backend.cancel()
-		<-f.backend.Exited
-		f.backend = nil
+		f.stopBackend("swap")
 	}
 
-	backend, err := f.startBackend(model)
-	if err != nil {
-		return nil, err
-	}
-	f.backend = backend
-	f.backendModel = model
+	loadStart := time.Now()
+	stats.QueueWait = loadStart.Sub(queueStart)
 
-	select {
-	case <-ctx.Done():
-		return nil, errors.New("context cancelled")
-	case <-backend.Ready:
-		f.backendUsers++
-		return f.backend, nil
+	for attempt := 1; ; attempt++ {
+		backend, err := f.startBackend(model, previous)
+		if err != nil {
+			return nil, ErrBackendFailed{Model: model, Err: err}
+		}
+		f.setBackend(backend, model)
+		f.events.publish(Event{Type: EventLoadStart, Model: model, Port: backend.startPort})
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-backend.Ready:
+			stats.LoadDuration = time.Since(loadStart)
+		}
+
+		// Ready is also closed when the backend exits before becoming healthy
+		select {
+		case <-backend.Exited:
+		default:
+			f.addUsers(1)
+			f.setKeepAlive(ctx)
+			return f.backend, nil
+		}
+
+		f.setBackend(nil, "")
+
+		backend.RLock()
+		err = backend.err
+		collision := backend.portTaken
+		backend.RUnlock()
+
+		// something else took the port before the backend could bind it
+		if collision && attempt < maxStartAttempts {
+			log.Printf("Port %d was taken while starting %s, retrying on another port\n", backend.startPort, model)
+			continue
+		}
+
+		return nil, ErrBackendFailed{Model: model, Err: err}
 	}
 }
 
+// maxStartAttempts is how many times Lock tries to start a backend
+// when its port turns out to be in use.
+const maxStartAttempts = 3
+
 // Unlock implements ModelScheduler.
 func (f *fcfsScheduler) Unlock(backend *backend) {
+	// upstreams aren't counted, so they don't wait for a local backend that is loading
+	if backend.upstream != nil {
+		return
+	}
+
 	f.backendCond.L.Lock()
 	defer f.backendCond.L.Unlock()
 	if f.backend == backend {
-		f.backendUsers--
+		f.addUsers(-1)
 		if f.backendUsers == 0 {
 			f.backendIdleAt = time.Now()
 		}
 		f.backendCond.Broadcast()
+		f.events.publish(Event{Type: EventUnlock, Model: f.backendModel})
 	}
 }
 
-func (f *fcfsScheduler) modelExists(modelName string) (bool, error) {
-	f.ramalamaModelsCacheLock.Lock()
-	defer f.ramalamaModelsCacheLock.Unlock()
+// setBackend changes the current backend.
+// backendCond must be held.
+func (f *fcfsScheduler) setBackend(backend *backend, model string) {
+	f.backend = backend
+	f.backendModel = model
+	f.backendKeepAliveSet = false
+	if backend != nil {
+		f.backendIdleAt = time.Now()
+	}
 
-	_, ok := f.ramalamaModelsCache[modelName]
-	if ok {
-		return true, nil
+	f.statusLock.Lock()
+	f.statusBackend = backend
+	f.statusModel = model
+	f.statusLock.Unlock()
+}
+
+// stopBackend stops the current backend and waits for it to exit.
+// reason is reported in the unload event.
+// backendCond must be held, and the backend must not be in use.
+func (f *fcfsScheduler) stopBackend(reason string) {
+	f.backend.Lock()
+	f.backend.stopReason = reason
+	f.backend.Unlock()
+
+	f.backend.cancel()
+	<-f.backend.Exited
+	f.setBackend(nil, "")
+}
+
+// setKeepAlive applies the keep alive duration attached to ctx to the current backend.
+// Like Ollama, keep alive applies per request, so a ctx without one restores the idle timeout.
+// backendCond must be held.
+func (f *fcfsScheduler) setKeepAlive(ctx context.Context) {
+	f.backendKeepAlive, f.backendKeepAliveSet = keepAliveFrom(ctx)
+}
+
+// idleTimeoutLocked returns how long the current backend may stay idle, or a negative duration if forever.
+// A keep alive from the backend's last user takes precedence over the model's idle timeout,
+// which takes precedence over the scheduler's.
+// backendCond must be held.
+func (f *fcfsScheduler) idleTimeoutLocked() time.Duration {
+	if f.backendKeepAliveSet {
+		return f.backendKeepAlive
 	}
 
-	models, err := f.ramalama.GetModels()
-	if err != nil {
-		return false, err
+	if timeout := f.modelOptions(f.backendModel).IdleTimeout; timeout != nil {
+		return *timeout
+	}
+
+	if f.idleTimeout == 0 {
+		return -1
+	}
+	return f.idleTimeout
+}
+
+// addUsers changes the number of users of the current backend.
+// backendCond must be held.
+func (f *fcfsScheduler) addUsers(n int) {
+	f.backendUsers += n
+
+	f.statusLock.Lock()
+	f.statusUsers = f.backendUsers
+	f.statusLock.Unlock()
+}
+
+func (f *fcfsScheduler) addQueued(n int) {
+	f.statusLock.Lock()
+	f.statusQueued += n
+	f.statusLock.Unlock()
+}
+
+func (f *fcfsScheduler) recordSwap(swap Swap) {
+	f.statusLock.Lock()
+	f.swaps = append(f.swaps, swap)
+	if len(f.swaps) > maxSwaps {
+		f.swaps = append(f.swaps[:0], f.swaps[len(f.swaps)-maxSwaps:]...)
+	}
+	f.statusLock.Unlock()
+}
+
+// Loaded implements ModelScheduler.
+// Upstreams are always considered loaded.
+func (f *fcfsScheduler) Loaded() []string {
+	var loaded []string
+	for name := range f.upstreams {
+		loaded = append(loaded, name)
+	}
+
+	f.statusLock.Lock()
+	defer f.statusLock.Unlock()
+
+	if f.statusBackend == nil {
+		return loaded
+	}
+
+	select {
+	case <-f.statusBackend.Exited:
+		return loaded
+	default:
+	}
+
+	select {
+	case <-f.statusBackend.Ready:
+		return append(loaded, f.statusModel)
+	default: // still loading
+		return loaded
+	}
+}
+
+// Unload implements ModelScheduler.
+// It waits for earlier Lock calls and for current users to finish first.
+func (f *fcfsScheduler) Unload(model string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.backendCond.L.Lock()
+	defer f.backendCond.L.Unlock()
+
+	for f.backendUsers > 0 {
+		f.backendCond.Wait()
 	}
 
-	f.ramalamaModelsCache = make(map[string]struct{}, len(models))
-	for _, model := range models {
-		f.ramalamaModelsCache[model.Name] = struct{}{}
+	if f.backend == nil || (model != "" && f.backendModel != model) {
+		return
+	}
+
+	model = f.backendModel
+	log.Printf("Unloading %s\n", model)
+	f.recordSwap(Swap{Time: time.Now(), From: model}) // before the unload event
+	f.stopBackend("request")
+}
+
+// Status implements ModelScheduler.
+func (f *fcfsScheduler) Status() Status {
+	f.statusLock.Lock()
+	defer f.statusLock.Unlock()
+
+	status := Status{
+		Users:  f.statusUsers,
+		Queued: f.statusQueued,
+		Swaps:  append([]Swap{}, f.swaps...),
+	}
+
+	if f.statusBackend == nil {
+		return status
+	}
+
+	select {
+	case <-f.statusBackend.Exited:
+		return status
+	default:
+	}
+
+	status.Model = f.statusModel
+	select {
+	case <-f.statusBackend.Ready:
+		status.State = "ready"
+	default:
+		status.State = "loading"
+	}
+	return status
+}
+
+// Subscribe implements ModelScheduler.
+func (f *fcfsScheduler) Subscribe() (<-chan Event, func()) {
+	return f.events.Subscribe()
+}
+
+// Logs implements ModelScheduler.
+func (f *fcfsScheduler) Logs(after uint64) []LogLine {
+	return f.logs.since(after)
+}
+
+// SubscribeLogs implements ModelScheduler.
+func (f *fcfsScheduler) SubscribeLogs() (<-chan LogLine, func()) {
+	return f.logs.subscribe()
+}
+
+// AddUpstream makes requests for u.Name go to an externally managed server.
+// It must be called before the scheduler is used.
+func (f *fcfsScheduler) AddUpstream(u Upstream) error {
+	back, err := newUpstreamBackend(u)
+	if err != nil {
+		return err
 	}
 
-	_, ok = f.ramalamaModelsCache[modelName]
-	return ok, nil
+	f.upstreams[u.Name] = back
+	return nil
+}
+
+// SetModelOptions changes the settings used for model.
+// It must be called before the scheduler is used.
+func (f *fcfsScheduler) SetModelOptions(model string, options ModelOptions) {
+	f.options[model] = options
 }
 
-func (f *fcfsScheduler) startBackend(modelName string) (*backend, error) {
+func (f *fcfsScheduler) modelOptions(model string) ModelOptions {
+	return f.options[model]
+}
+
+func (f *fcfsScheduler) modelExists(modelName string) (bool, error) {
+	_, ok, err := f.catalog.Find(modelName)
+	return ok, err
+}
+
+// startBackend starts a backend for modelName, recording it as a swap from previous once it is ready.
+func (f *fcfsScheduler) startBackend(modelName string, previous string) (*backend, error) {
+	// ReservePort checks that the port is free just before the backend starts,
+	// and the ready check below catches anything that takes it afterwards
+	port, err := f.ports.ReservePort()
+	if err != nil {
+		return nil, err
+	}
+
 	back := &backend{}
-	back.port = f.port
+	back.port = port
+	back.startPort = port
 
 	ctx, cancel := context.WithCancel(context.Background())
 	back.cancel = cancel
 
-	cmd := f.ramalama.ServeCommand(ctx, ramalama.ServeArgs{
+	cmd := f.provider.ServeCommand(ctx, ramalama.ServeArgs{
 		Model: modelName,
 		Port:  back.port,
 	})
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = f.logs.writer(modelName)
+	cmd.Stderr = io.MultiWriter(os.Stderr, f.logs.writer(modelName))
 
 	switch runtime.GOOS {
 	case "linux":
@@ -157,51 +440,94 @@ func (f *fcfsScheduler) startBackend(modelName string) (*backend, error) {
 		log.Println("[WARN] Graceful shutdown of ramalama not supported for OS, switching may not work correctly")
 	}
 
-	err := cmd.Start()
+	err = cmd.Start()
 	if err != nil {
 		cancel()
-		return nil, fmt.Errorf("failed to start ramalama: %v\n", err)
+		f.ports.ReleasePort(port)
+		return nil, fmt.Errorf("failed to start backend: %v", err)
 	}
 
 	back.Ready = make(chan struct{})
 	back.Exited = make(chan struct{})
 
+	started := time.Now()
+
 	// waits for ready
 	go func() {
-		defer close(back.Ready)
+		ready := f.modelOptions(modelName).Readiness.waitReady(back)
+
+		swap := Swap{
+			Time:         started,
+			From:         previous,
+			To:           modelName,
+			LoadDuration: time.Since(started),
+		}
+
+		if !ready {
+			back.RLock()
+			swap.Error = fmt.Sprint("backend exited: ", back.err)
+			back.RUnlock()
+		}
 
-		for !back.healthCheck() {
-			select {
-			case <-back.Exited:
-				return
-			default:
-			}
+		// recorded before the ready event, or before Lock publishes queue-exit or retries after a failure
+		f.recordSwap(swap)
+		close(back.Ready)
 
-			time.Sleep(time.Second) // fixme
+		if ready {
+			f.events.publish(Event{Type: EventReady, Model: modelName, LoadDuration: swap.LoadDuration})
 		}
 	}()
 
 	// waits for exit
 	go func() {
 		err := cmd.Wait()
+		stopped := ctx.Err() != nil
 		back.cancel()
 
+		// a backend that failed while something else holds its port most likely couldn't bind it
+		taken := !stopped && !portFree(port)
+		if taken {
+			log.Printf("Port %d is used by another server, %s exited\n", port, modelName)
+			err = fmt.Errorf("port %d is used by another server: %v", port, err)
+		}
+
 		back.Lock()
 		back.err = err
+		back.portTaken = taken
+		reason := back.stopReason
 
 		back.portLock.Lock()
 		back.port = 0
 		back.portLock.Unlock()
+		f.ports.ReleasePort(port)
 
 		close(back.Exited) // must be after portLock unlock
 
 		back.Unlock()
+
+		event := Event{Model: modelName, Uptime: time.Since(started)}
+		if stopped {
+			event.Type = EventUnload
+			event.Reason = reason
+		} else {
+			event.Type = EventCrash
+			event.Error = fmt.Sprint(err)
+		}
+		f.events.publish(event)
 	}()
 
 	return back, nil
 }
 
 func (f *fcfsScheduler) startIdleTimeout() {
+	// a single timer wakes the loop, so repeated waits don't pile up sleeping goroutines
+	timer := time.AfterFunc(time.Hour, func() {
+		f.backendCond.L.Lock()
+		defer f.backendCond.L.Unlock()
+		f.backendCond.Broadcast()
+	})
+	timer.Stop()
+
 	f.backendCond.L.Lock()
 	for {
 		if f.backend == nil || f.backendUsers > 0 {
@@ -209,36 +535,36 @@ func (f *fcfsScheduler) startIdleTimeout() {
 			continue
 		}
 
-		if waitingTime := time.Until(f.backendIdleAt.Add(f.idleTimeout)); waitingTime > 0 {
-			go func() {
-				time.Sleep(waitingTime)
-				f.backendCond.L.Lock()
-				defer f.backendCond.L.Unlock()
-				f.backendCond.Broadcast()
-			}()
+		timeout := f.idleTimeoutLocked()
+		if timeout < 0 {
+			f.backendCond.Wait()
+			continue
+		}
+
+		if waitingTime := time.Until(f.backendIdleAt.Add(timeout)); waitingTime > 0 {
+			timer.Reset(waitingTime)
 			f.backendCond.Wait()
 			continue
 		}
 
-		log.Printf("Stopping backend after being idle for %v\n", f.idleTimeout)
-		f.backend.cancel()
-		<-f.backend.Exited
-		f.backend = nil
+		log.Printf("Stopping backend after being idle for %v\n", timeout)
+		f.recordSwap(Swap{Time: time.Now(), From: f.backendModel}) // before the unload event
+		f.stopBackend("idle")
 	}
 }
 
-func NewFcfsScheduler(ramalama ramalama.Ramalama, port int, idleTimeout time.Duration) *fcfsScheduler {
+func NewFcfsScheduler(provider ramalama.ModelProvider, catalog *ramalama.Catalog, ports PortRange, idleTimeout time.Duration) *fcfsScheduler {
 	scheduler := &fcfsScheduler{
-		ramalama:            ramalama,
-		port:                port,
-		idleTimeout:         idleTimeout,
-		ramalamaModelsCache: map[string]struct{}{},
-		backendCond:         *sync.NewCond(&sync.Mutex{}),
+		provider:    provider,
+		catalog:     catalog,
+		ports:       newPortManager(ports),
+		idleTimeout: idleTimeout,
+		backendCond: *sync.NewCond(&sync.Mutex{}),
+		upstreams:   map[string]*backend{},
+		options:     map[string]ModelOptions{},
 	}
 
-	if idleTimeout != 0 {
-		go scheduler.startIdleTimeout()
-	}
+	go scheduler.startIdleTimeout()
 	return scheduler
 }
 
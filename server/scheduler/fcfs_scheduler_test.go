@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIdleTimeoutPrecedence(t *testing.T) {
+	minute, forever := time.Minute, time.Duration(-1)
+
+	for _, tc := range []struct {
+		name         string
+		global       time.Duration
+		model        *time.Duration
+		keepAlive    time.Duration
+		hasKeepAlive bool
+		want         time.Duration
+	}{
+		{"global", 10 * time.Minute, nil, 0, false, 10 * time.Minute},
+		{"no timeout", 0, nil, 0, false, -1},
+		{"model overrides global", 10 * time.Minute, &minute, 0, false, time.Minute},
+		{"model overrides no timeout", 0, &minute, 0, false, time.Minute},
+		{"model keeps loaded", 10 * time.Minute, &forever, 0, false, -1},
+		{"keep alive overrides model", 10 * time.Minute, &minute, 5 * time.Second, true, 5 * time.Second},
+		{"zero keep alive", 0, &forever, 0, true, 0},
+		{"negative keep alive", 10 * time.Minute, &minute, -1, true, -1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := NewFcfsScheduler(noModels{}, nil, DefaultPortRange, tc.global)
+			f.SetModelOptions("model", ModelOptions{IdleTimeout: tc.model})
+
+			ctx := context.Background()
+			if tc.hasKeepAlive {
+				ctx = WithKeepAlive(ctx, tc.keepAlive)
+			}
+
+			f.backendCond.L.Lock()
+			defer f.backendCond.L.Unlock()
+
+			f.backendModel = "model"
+			f.setKeepAlive(ctx)
+			if got := f.idleTimeoutLocked(); got != tc.want {
+				t.Errorf("Expected an idle timeout of %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+)
+
+type keepAliveKey struct{}
+
+// WithKeepAlive returns a context that makes Lock keep the model loaded for d after it was last used,
+// instead of the idle timeout. A negative d keeps the model loaded until another model is needed,
+// and 0 stops it as soon as it is unused.
+func WithKeepAlive(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, keepAliveKey{}, d)
+}
+
+// keepAliveFrom returns the keep alive duration attached to ctx, if any.
+func keepAliveFrom(ctx context.Context) (time.Duration, bool) {
+	d, ok := ctx.Value(keepAliveKey{}).(time.Duration)
+	return d, ok
+}
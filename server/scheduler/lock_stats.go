@@ -0,0 +1,29 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+)
+
+// LockStats receives timing information about a Lock call.
+type LockStats struct {
+	QueueWait    time.Duration // time spent waiting for other users of the scheduler
+	LoadDuration time.Duration // time spent loading the model, zero if it was already loaded
+}
+
+type lockStatsKey struct{}
+
+// WithLockStats returns a context that makes Lock record its timing information in stats.
+func WithLockStats(ctx context.Context, stats *LockStats) context.Context {
+	return context.WithValue(ctx, lockStatsKey{}, stats)
+}
+
+// lockStatsFrom returns the LockStats attached to ctx.
+// If there is none, a LockStats that is not read by anything is returned.
+func lockStatsFrom(ctx context.Context) *LockStats {
+	stats, ok := ctx.Value(lockStatsKey{}).(*LockStats)
+	if !ok {
+		return &LockStats{}
+	}
+	return stats
+}
@@ -0,0 +1,119 @@
+package scheduler
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// maxLogLines is how many backend log lines are kept in memory.
+const maxLogLines = 500
+
+// maxLogLineLength is the longest line kept. Longer lines are split,
+// so that a backend writing without newlines can't use unlimited memory.
+const maxLogLineLength = 16 << 10
+
+// LogLine is a line of output from a backend.
+type LogLine struct {
+	Seq   uint64    `json:"seq"`
+	Time  time.Time `json:"time"`
+	Model string    `json:"model"`
+	Text  string    `json:"text"`
+}
+
+// logBuffer keeps the most recent lines written by backends,
+// and passes new lines on to subscribers.
+type logBuffer struct {
+	lock        sync.Mutex
+	lines       []LogLine
+	seq         uint64
+	subscribers map[chan LogLine]struct{}
+}
+
+func (b *logBuffer) add(model, text string) {
+	b.lock.Lock()
+	b.seq++
+	line := LogLine{
+		Seq:   b.seq,
+		Time:  time.Now(),
+		Model: model,
+		Text:  text,
+	}
+	b.lines = append(b.lines, line)
+	if len(b.lines) > maxLogLines {
+		b.lines = append(b.lines[:0], b.lines[len(b.lines)-maxLogLines:]...)
+	}
+
+	for lines := range b.subscribers {
+		select {
+		case lines <- line:
+		default: // the line can still be read with since
+		}
+	}
+	b.lock.Unlock()
+}
+
+// subscribe returns a channel of new lines, and a function that must be called to stop receiving them.
+// Lines are dropped if the channel isn't drained quickly enough.
+func (b *logBuffer) subscribe() (<-chan LogLine, func()) {
+	lines := make(chan LogLine, subscriberBuffer)
+
+	b.lock.Lock()
+	if b.subscribers == nil {
+		b.subscribers = map[chan LogLine]struct{}{}
+	}
+	b.subscribers[lines] = struct{}{}
+	b.lock.Unlock()
+
+	var once sync.Once
+	return lines, func() {
+		once.Do(func() {
+			b.lock.Lock()
+			delete(b.subscribers, lines)
+			b.lock.Unlock()
+			close(lines)
+		})
+	}
+}
+
+// since returns the lines with sequence numbers greater than after.
+func (b *logBuffer) since(after uint64) []LogLine {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for i, line := range b.lines {
+		if line.Seq > after {
+			return append([]LogLine(nil), b.lines[i:]...)
+		}
+	}
+	return nil
+}
+
+// writer returns an io.Writer that adds each line written to it to b.
+func (b *logBuffer) writer(model string) *logWriter {
+	return &logWriter{buffer: b, model: model}
+}
+
+type logWriter struct {
+	buffer  *logBuffer
+	model   string
+	partial []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.buffer.add(w.model, string(bytes.TrimRight(w.partial[:i], "\r")))
+		w.partial = w.partial[i+1:]
+	}
+
+	for len(w.partial) >= maxLogLineLength {
+		w.buffer.add(w.model, string(w.partial[:maxLogLineLength]))
+		w.partial = w.partial[maxLogLineLength:]
+	}
+	return len(p), nil
+}
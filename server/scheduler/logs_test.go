@@ -0,0 +1,56 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLogWriter(t *testing.T) {
+	var buffer logBuffer
+	w := buffer.writer("m")
+
+	w.Write([]byte("first\r\nsec"))
+	w.Write([]byte("ond\n"))
+
+	lines := buffer.since(0)
+	if len(lines) != 2 || lines[0].Text != "first" || lines[1].Text != "second" || lines[1].Model != "m" {
+		t.Errorf("Unexpected lines %+v", lines)
+	}
+
+	// output without newlines is split instead of growing without limit
+	w.Write([]byte(strings.Repeat("x", maxLogLineLength+10)))
+	if len(w.partial) != 10 {
+		t.Errorf("Expected 10 bytes to be left over, got %d", len(w.partial))
+	}
+	if lines := buffer.since(2); len(lines) != 1 || len(lines[0].Text) != maxLogLineLength {
+		t.Errorf("Expected one line of %d bytes, got %d lines", maxLogLineLength, len(lines))
+	}
+}
+
+func TestLogBufferSubscribe(t *testing.T) {
+	var buffer logBuffer
+
+	lines, cancel := buffer.subscribe()
+	buffer.add("m", "hello")
+
+	if line := <-lines; line.Text != "hello" || line.Seq != 1 {
+		t.Errorf("Unexpected line %+v", line)
+	}
+
+	// a slow subscriber doesn't block the backend's output
+	for range subscriberBuffer + 10 {
+		buffer.add("m", "burst")
+	}
+	if len(lines) != subscriberBuffer {
+		t.Errorf("Expected %d buffered lines, got %d", subscriberBuffer, len(lines))
+	}
+
+	cancel()
+	cancel()
+	buffer.add("m", "after")
+	for line := range lines {
+		if line.Text == "after" {
+			t.Error("Expected no lines after cancelling the subscription")
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+// PortRange is an inclusive range of ports for backends to listen on.
+type PortRange struct {
+	First int
+	Last  int
+}
+
+// DefaultPortRange is used for backends unless configured otherwise.
+var DefaultPortRange = PortRange{First: 49170, Last: 49269}
+
+// String formats r as FIRST-LAST.
+func (r PortRange) String() string {
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+type portManager struct {
+	Ports             PortRange
+	reservedPortsLock sync.Mutex
+	reservedPorts     map[int]struct{}
+}
+
+func newPortManager(ports PortRange) *portManager {
+	return &portManager{
+		Ports:         ports,
+		reservedPorts: map[int]struct{}{},
+	}
+}
+
+// ReservePort returns the lowest port in the range that isn't reserved and can be bound.
+func (p *portManager) ReservePort() (int, error) {
+	p.reservedPortsLock.Lock()
+	defer p.reservedPortsLock.Unlock()
+	for port := p.Ports.First; port <= p.Ports.Last; port++ {
+		if _, ok := p.reservedPorts[port]; ok {
+			continue
+		}
+
+		if !portFree(port) {
+			continue
+		}
+
+		p.reservedPorts[port] = struct{}{}
+		return port, nil
+	}
+	return 0, ErrNoFreePort{Ports: p.Ports}
+}
+
+func (p *portManager) ReleasePort(port int) {
+	p.reservedPortsLock.Lock()
+	delete(p.reservedPorts, port)
+	p.reservedPortsLock.Unlock()
+}
+
+// portFree returns whether nothing else is listening on port.
+func portFree(port int) bool {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+// freePortRange returns a range of n ports that are currently free.
+func freePortRange(t *testing.T, n int) PortRange {
+	t.Helper()
+
+	for range 100 {
+		l, err := net.Listen("tcp", ":0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := l.Addr().(*net.TCPAddr).Port
+		l.Close()
+
+		free := first+n-1 <= 65535
+		for port := first; free && port < first+n; port++ {
+			free = portFree(port)
+		}
+		if free {
+			return PortRange{First: first, Last: first + n - 1}
+		}
+	}
+
+	t.Fatalf("Failed to find %d free ports", n)
+	return PortRange{}
+}
+
+func TestPortManager(t *testing.T) {
+	ports := freePortRange(t, 3)
+	pm := newPortManager(ports)
+
+	port, err := pm.ReservePort()
+	if err != nil || port != ports.First {
+		t.Errorf("Expected lowest available port to be reserved, got %d, %v", port, err)
+	}
+
+	pm.ReleasePort(port)
+	port, err = pm.ReservePort()
+	if err != nil || port != ports.First {
+		t.Errorf("Expected port to be reused, got %d, %v", port, err)
+	}
+
+	port2, err := pm.ReservePort()
+	if err != nil || port2 != ports.First+1 {
+		t.Errorf("Expected next available port to be reserved, got %d, %v", port2, err)
+	}
+
+	port3, err := pm.ReservePort()
+	if err != nil || port3 != ports.Last {
+		t.Errorf("Expected the last port to be reserved, got %d, %v", port3, err)
+	}
+
+	if port, err := pm.ReservePort(); !errors.As(err, &ErrNoFreePort{}) {
+		t.Errorf("Expected ErrNoFreePort once every port is reserved, got port %d and error %v", port, err)
+	}
+}
+
+func TestPortManagerSkipsUsedPorts(t *testing.T) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	used := l.Addr().(*net.TCPAddr).Port
+
+	pm := newPortManager(PortRange{First: used, Last: used})
+	port, err := pm.ReservePort()
+	if !errors.As(err, &ErrNoFreePort{}) {
+		t.Errorf("Expected ErrNoFreePort for a port in use, got port %d and error %v", port, err)
+	}
+}
@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ReadinessProbe describes how to tell that a backend is ready to serve requests.
+// The zero value polls GET /health until it returns 200 OK, which suits llama-server.
+type ReadinessProbe struct {
+	// TCP only checks that the backend accepts connections.
+	TCP bool
+
+	Path   string // HTTP path to request, "/health" by default
+	Status int    // expected HTTP status, 200 by default
+
+	// If JSONField is set, the response must be a JSON object whose field
+	// (a dot separated path) has the string value JSONValue.
+	JSONField string
+	JSONValue string
+
+	Interval    time.Duration // time between the first checks, 250ms by default
+	MaxInterval time.Duration // checks back off up to this interval, 2s by default
+}
+
+// check returns whether the backend listening on port is ready.
+func (p ReadinessProbe) check(client *http.Client, port int) bool {
+	address := fmt.Sprintf("127.0.0.1:%v", port)
+
+	if p.TCP {
+		return tcpReady(address)
+	}
+
+	path := p.Path
+	if path == "" {
+		path = "/health"
+	}
+
+	resp, err := client.Get("http://" + address + path)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	status := p.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	if resp.StatusCode != status {
+		return false
+	}
+
+	if p.JSONField == "" {
+		return true
+	}
+
+	var body any
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return false
+	}
+
+	for field := range strings.SplitSeq(p.JSONField, ".") {
+		object, ok := body.(map[string]any)
+		if !ok {
+			return false
+		}
+		body = object[field]
+	}
+
+	value, ok := body.(string)
+	return ok && value == p.JSONValue
+}
+
+func tcpReady(address string) bool {
+	conn, err := net.DialTimeout("tcp", address, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// waitReady polls the backend until it is ready or exits, and returns whether it became ready.
+func (p ReadinessProbe) waitReady(back *backend) bool {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = 250 * time.Millisecond
+	}
+
+	maxInterval := p.MaxInterval
+	if maxInterval <= 0 {
+		maxInterval = 2 * time.Second
+	}
+	maxInterval = max(maxInterval, interval)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	for {
+		back.portLock.RLock()
+		port := back.port
+		back.portLock.RUnlock()
+
+		if port != 0 && p.check(client, port) {
+			return true
+		}
+
+		select {
+		case <-back.Exited:
+			return false
+		case <-time.After(interval):
+		}
+
+		interval = min(interval*2, maxInterval)
+	}
+}
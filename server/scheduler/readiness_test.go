@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serverPort returns the port that server listens on.
+func serverPort(t *testing.T, server *httptest.Server) int {
+	t.Helper()
+	return server.Listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestReadinessProbeCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			w.Write([]byte(`{"status": "ok"}`))
+		case "/loading":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/nested":
+			w.Write([]byte(`{"model": {"state": "loaded"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	port := serverPort(t, server)
+
+	for _, tc := range []struct {
+		name  string
+		probe ReadinessProbe
+		ready bool
+	}{
+		{"default", ReadinessProbe{}, true},
+		{"unhealthy", ReadinessProbe{Path: "/loading"}, false},
+		{"expected status", ReadinessProbe{Path: "/loading", Status: http.StatusServiceUnavailable}, true},
+		{"json field", ReadinessProbe{JSONField: "status", JSONValue: "ok"}, true},
+		{"json field mismatch", ReadinessProbe{JSONField: "status", JSONValue: "loading"}, false},
+		{"nested json field", ReadinessProbe{Path: "/nested", JSONField: "model.state", JSONValue: "loaded"}, true},
+		{"missing json field", ReadinessProbe{Path: "/nested", JSONField: "model.state.name", JSONValue: "loaded"}, false},
+		{"tcp", ReadinessProbe{TCP: true, Path: "/loading"}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if ready := tc.probe.check(server.Client(), port); ready != tc.ready {
+				t.Errorf("Expected ready to be %v", tc.ready)
+			}
+		})
+	}
+
+	server.Close()
+	if (ReadinessProbe{TCP: true}).check(http.DefaultClient, port) || (ReadinessProbe{}).check(http.DefaultClient, port) {
+		t.Errorf("Expected a closed port not to be ready")
+	}
+}
+
+func TestReadinessProbeWaitReady(t *testing.T) {
+	var checks atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if checks.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	probe := ReadinessProbe{Interval: time.Millisecond, MaxInterval: 5 * time.Millisecond}
+
+	back := &backend{port: serverPort(t, server), Exited: make(chan struct{})}
+	if !probe.waitReady(back) {
+		t.Errorf("Expected the backend to become ready")
+	}
+	if n := checks.Load(); n != 3 {
+		t.Errorf("Expected 3 checks, got %d", n)
+	}
+
+	// a backend that exits before becoming ready is never ready
+	exited := &backend{Exited: make(chan struct{})}
+	time.AfterFunc(20*time.Millisecond, func() { close(exited.Exited) })
+
+	done := make(chan bool)
+	go func() { done <- probe.waitReady(exited) }()
+
+	select {
+	case ready := <-done:
+		if ready {
+			t.Errorf("Expected an exited backend not to be ready")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected waitReady to return once the backend exited")
+	}
+}
@@ -1,6 +1,9 @@
 package scheduler
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type ModelScheduler interface {
 	// Lock waits for the model to be ready.
@@ -10,4 +13,34 @@ type ModelScheduler interface {
 
 	// Unlock must after a successful Lock call to signal that the backend is no longer in use.
 	Unlock(*backend)
+
+	// Loaded returns the names of the models that currently have a running backend.
+	Loaded() []string
+
+	// Unload stops the local backend once it is no longer in use.
+	// If model isn't empty, the backend is only stopped if it is serving model.
+	Unload(model string)
+
+	// Status describes the local backend and recent swaps.
+	Status() Status
+
+	// Subscribe returns a channel of lifecycle events, and a function to call when done with it.
+	// Changes to Status are followed by an event, so subscribers can read it again.
+	Subscribe() (events <-chan Event, cancel func())
+
+	// Logs returns the buffered backend log lines with sequence numbers after after.
+	Logs(after uint64) []LogLine
+
+	// SubscribeLogs returns a channel of new backend log lines, and a function to call when done with it.
+	// Lines that a subscriber falls behind on are dropped, but can still be read with Logs.
+	SubscribeLogs() (lines <-chan LogLine, cancel func())
+}
+
+// ModelOptions are per-model scheduler settings.
+type ModelOptions struct {
+	Readiness ReadinessProbe
+
+	// IdleTimeout overrides the scheduler's idle timeout if not nil.
+	// A negative timeout keeps the model loaded until another model is needed.
+	IdleTimeout *time.Duration
 }
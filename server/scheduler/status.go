@@ -0,0 +1,27 @@
+package scheduler
+
+import "time"
+
+// maxSwaps is how many recent swaps are kept for Status.
+const maxSwaps = 20
+
+// Status is a snapshot of the scheduler's local backend.
+type Status struct {
+	Model  string `json:"model"`  // model of the local backend, "" if none is running
+	State  string `json:"state"`  // "loading", "ready" or "" if no backend is running
+	Users  int    `json:"users"`  // requests currently using the backend
+	Queued int    `json:"queued"` // requests waiting in Lock
+
+	// Swaps are the most recent backend changes, oldest first.
+	Swaps []Swap `json:"swaps"`
+}
+
+// Swap is a change of the local backend.
+type Swap struct {
+	Time time.Time `json:"time"`
+	From string    `json:"from"` // previous model, "" if none was running
+	To   string    `json:"to"`   // new model, "" when a model was unloaded
+
+	LoadDuration time.Duration `json:"load_duration"` // time until the new backend was ready
+	Error        string        `json:"error,omitempty"`
+}
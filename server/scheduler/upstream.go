@@ -0,0 +1,39 @@
+package scheduler
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Upstream is an externally managed OpenAI-compatible server that models can be routed to.
+type Upstream struct {
+	Name    string `json:"name"`     // name clients use for the model
+	BaseURL string `json:"base_url"` // root URL of the server, without /v1
+	APIKey  string `json:"api_key"`  // optional
+	Model   string `json:"model"`    // model name sent to the server, or Name if empty
+}
+
+// newUpstreamBackend creates an always ready backend for u.
+func newUpstreamBackend(u Upstream) (*backend, error) {
+	base, err := url.Parse(u.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url for upstream %s: %v", u.Name, err)
+	}
+
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("base url for upstream %s must be http or https", u.Name)
+	}
+
+	u.BaseURL = strings.TrimSuffix(strings.TrimSuffix(u.BaseURL, "/"), "/v1")
+
+	back := &backend{
+		Ready:    make(chan struct{}),
+		Exited:   make(chan struct{}), // never closed
+		cancel:   func() {},
+		upstream: &u,
+	}
+	close(back.Ready)
+
+	return back, nil
+}
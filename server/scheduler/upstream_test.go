@@ -0,0 +1,130 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+	"github.com/wk-y/rama-swap/ramalama"
+)
+
+// noModels is a ModelProvider without any local models.
+type noModels struct{}
+
+func (noModels) GetModels() ([]ramalama.Model, error) { return nil, nil }
+
+func (noModels) Inspect(name string) (ramalama.InspectInfo, error) {
+	return ramalama.InspectInfo{}, ramalama.ErrModelNotFound{Model: name}
+}
+
+func (noModels) ServeCommand(ctx context.Context, args ramalama.ServeArgs) *exec.Cmd {
+	return exec.CommandContext(ctx, "false")
+}
+
+func TestUpstreamLock(t *testing.T) {
+	type seen struct {
+		path, authorization, model string
+	}
+	requests := make(chan seen, 2)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		requests <- seen{r.URL.Path, r.Header.Get("Authorization"), body.Model}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"x","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstream.Close()
+
+	provider := noModels{}
+	f := NewFcfsScheduler(provider, ramalama.NewCatalog(provider), DefaultPortRange, 0)
+	err := f.AddUpstream(Upstream{Name: "remote", BaseURL: upstream.URL + "/v1/", APIKey: "upstream-key", Model: "real-model"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.AddUpstream(Upstream{Name: "bad", BaseURL: "ftp://example.com"}); err == nil {
+		t.Errorf("Expected a non-http base url to be rejected")
+	}
+
+	backend, err := f.Lock(context.Background(), "remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Unlock(backend)
+
+	select {
+	case <-backend.Ready:
+	default:
+		t.Errorf("Expected an upstream to be ready immediately")
+	}
+
+	if loaded := f.Loaded(); !slices.Equal(loaded, []string{"remote"}) {
+		t.Errorf("Expected the upstream to be loaded, got %v", loaded)
+	}
+
+	if status := f.Status(); status.Model != "" || status.Users != 0 {
+		t.Errorf("Expected upstreams not to affect the local backend, got %+v", status)
+	}
+
+	// proxied requests go to the upstream with its key and model, not the client's
+	r := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"remote"}`))
+	r.Header.Set("Authorization", "Bearer client-key")
+	backend.Proxy().ServeHTTP(httptest.NewRecorder(), r)
+
+	if got := <-requests; got != (seen{"/v1/chat/completions", "Bearer upstream-key", "real-model"}) {
+		t.Errorf("Unexpected proxied request %+v", got)
+	}
+
+	// so do requests made with the backend's client
+	err = backend.WithClient(func(client openai.Client) error {
+		_, err := client.Chat.Completions.New(context.Background(), openai.ChatCompletionNewParams{Model: "remote"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := <-requests; got != (seen{"/v1/chat/completions", "Bearer upstream-key", "real-model"}) {
+		t.Errorf("Unexpected client request %+v", got)
+	}
+}
+
+func TestUpstreamUnlockDuringLoad(t *testing.T) {
+	provider := noModels{}
+	f := NewFcfsScheduler(provider, ramalama.NewCatalog(provider), DefaultPortRange, 0)
+	if err := f.AddUpstream(Upstream{Name: "remote", BaseURL: "http://127.0.0.1:1/v1/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	backend, err := f.Lock(context.Background(), "remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a local backend loading holds the lock until it is ready
+	f.backendCond.L.Lock()
+	defer f.backendCond.L.Unlock()
+
+	unlocked := make(chan struct{})
+	go func() {
+		f.Unlock(backend)
+		close(unlocked)
+	}()
+
+	select {
+	case <-unlocked:
+	case <-time.After(time.Second):
+		t.Fatal("Expected unlocking an upstream not to wait for a local load")
+	}
+}
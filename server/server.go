@@ -3,10 +3,11 @@ package server
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
 	"log"
 	"net/http"
+	"net/http/httputil"
 	"sync"
 
 	"github.com/wk-y/rama-swap/internal/util"
@@ -16,41 +17,94 @@ import (
 
 type Server struct {
 	ModelNameMangler func(string) string
-	BasePort         int // starting port number to use for underlying instances
 
-	ramalama  ramalama.Ramalama
+	// APIKeys are the keys accepted for bearer token authentication.
+	// If empty, authentication is disabled.
+	APIKeys []APIKey
+
+	// RateLimits are the default per-client rate limits.
+	RateLimits RateLimits
+
+	// UsageLedger records completed requests, if not nil.
+	UsageLedger *UsageLedger
+
+	// Recorder records the requests sent to model backends, if not nil.
+	Recorder *Recorder
+
+	// StripThinkTags moves <think> sections out of Ollama chat message content,
+	// for backends that don't separate reasoning themselves.
+	StripThinkTags bool
+
+	catalog   *ramalama.Catalog
 	scheduler scheduler.ModelScheduler
 
 	demangleCacheLock sync.RWMutex
 	demangleCache     map[string]string
+
+	rateLimiter *rateLimiter
+	metrics     requestMetrics
 }
 
-func NewServer(r ramalama.Ramalama, scheduler scheduler.ModelScheduler) *Server {
+type contextKey int
+
+const (
+	apiKeyContextKey contextKey = iota
+	usageContextKey
+	recordingContextKey
+)
+
+func NewServer(catalog *ramalama.Catalog, scheduler scheduler.ModelScheduler) *Server {
 	return &Server{
-		ramalama:      r,
+		catalog:       catalog,
 		scheduler:     scheduler,
 		demangleCache: map[string]string{},
+		rateLimiter:   newRateLimiter(),
 	}
 }
 
-func (s *Server) HandleHttp(mux *http.ServeMux) {
+func (s *Server) HandleHttp(outer *http.ServeMux) {
+	mux := http.NewServeMux()
+	outer.Handle("/", s.authenticate(s.trackUsage(s.recordRequests(s.rateLimit(mux)))))
+
 	// OpenAI-compatible endpoints
-	mux.HandleFunc("/v1/models", s.handleModels)
-	mux.HandleFunc("POST /v1/chat/completions", s.handleChatCompletions)
-	mux.HandleFunc("POST /v1/completions", s.handleCompletions)
+	mux.HandleFunc("GET /v1/models", s.handleModels)
+	mux.HandleFunc("GET /v1/models/{model...}", s.handleModel)
+	mux.HandleFunc("POST /v1/responses", s.createResponse)
+	mux.HandleFunc("POST /v1/messages", s.anthropicMessages)
+	mux.HandleFunc("/v1/", s.handleModelRouted)
+
+	// llama-server specific endpoints
+	for _, endpoint := range llamaServerEndpoints {
+		mux.HandleFunc("POST "+endpoint, s.handleModelRouted)
+	}
 
 	// Ollama-compatible endpoints
 	mux.HandleFunc("/api/version", s.ollamaVersion)
 	mux.HandleFunc("/api/tags", s.ollamaTags)
 	mux.HandleFunc("/api/chat", s.ollamaChat)
+	mux.HandleFunc("POST /api/show", s.ollamaShow)
 
 	// llama-swap style endpoint
 	mux.HandleFunc("/upstream/{model}/{rest...}", s.serveUpstream)
-	mux.HandleFunc("/upstream/{$}", s.serveUpstreamSelect)
+	mux.Handle("/upstream/{$}", http.RedirectHandler("/dashboard/", http.StatusFound))
+
+	// scheduler lifecycle events
+	mux.HandleFunc("GET /events", s.schedulerEvents)
+
+	// web dashboard
+	mux.HandleFunc("GET /dashboard/{$}", s.serveDashboard)
+	mux.HandleFunc("GET /dashboard/models", s.dashboardModels)
+	mux.HandleFunc("GET /dashboard/events", s.dashboardEvents)
+	mux.HandleFunc("POST /dashboard/load", s.dashboardLoad)
+	mux.HandleFunc("POST /dashboard/unload", s.dashboardUnload)
+
+	// administration endpoints
+	mux.HandleFunc("GET /admin/usage", s.adminUsage)
+	mux.HandleFunc("GET /admin/metrics", s.adminMetrics)
 
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		log.Println("Unhandled endpoint ", r.URL)
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, r, errUnknownEndpoint())
 	})
 }
 
@@ -60,16 +114,29 @@ func (s *Server) proxyEndpoint(w http.ResponseWriter, r *http.Request, modelFind
 
 	model, err := modelFinder(tee)
 
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		writeError(w, r, apiErr)
+		return
+	}
+
 	if err != nil {
 		log.Println("Failed to determine model for request:", err)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("missing or invalid 'model' key"))
+		writeError(w, r, errBadRequest("missing or invalid 'model' key"))
+		return
+	}
+
+	if err := authorizeModel(r, model); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
+	requestUsageOf(r).SetModel(model)
+
 	backend, err := s.scheduler.Lock(r.Context(), model)
 	if err != nil {
 		log.Printf("Failed to start model %s: %v\n", model, err)
+		writeError(w, r, err)
 		return
 	}
 	defer s.scheduler.Unlock(backend)
@@ -80,70 +147,112 @@ func (s *Server) proxyEndpoint(w http.ResponseWriter, r *http.Request, modelFind
 		Closer: body.Close,
 	}
 
-	backend.Proxy().ServeHTTP(w, r)
+	configureProxy(backend.Proxy(), r).ServeHTTP(w, r)
 }
 
-func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
-	s.proxyEndpoint(w, r, func(body io.Reader) (model string, err error) {
-		var modelGet struct {
-			Model *string
-		}
+// configureProxy makes proxy report backend connection failures as API errors,
+// record token usage from backend responses to r, and record the exchange if r is being recorded.
+// Streaming chat and text completion requests are changed to ask for usage, see requestStreamUsage.
+func configureProxy(proxy *httputil.ReverseProxy, r *http.Request) *httputil.ReverseProxy {
+	usage := requestUsageOf(r)
+	if err := requestStreamUsage(r, usage); err != nil {
+		log.Println("Failed to request stream usage:", err)
+	}
+	proxy.Transport = recordingTransport(r)
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		trackResponseUsage(resp, usage)
+		return nil
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Println("Error proxying to backend:", err)
+		writeError(w, r, errBackend("failed to reach model backend"))
+	}
+	return proxy
+}
 
-		err = json.NewDecoder(body).Decode(&modelGet)
-		if err != nil {
-			return
-		}
+// openaiModel converts ramaModel to an OpenAI model object, inspecting it for additional details.
+func (s *Server) openaiModel(ramaModel ramalama.Model, loaded []string) (Model, error) {
+	model, err := convertModel(ramaModel, loaded)
+	if err != nil {
+		return Model{}, err
+	}
 
-		if modelGet.Model == nil {
-			return "", fmt.Errorf("missing model key")
-		}
+	info, err := s.catalog.Inspect(ramaModel.Name)
+	if err != nil {
+		log.Printf("Failed to inspect full details of model %s: %v\n", ramaModel.Name, err)
+	} else {
+		addModelInfo(&model, info)
+	}
 
-		return *modelGet.Model, nil
-	})
+	return model, nil
 }
 
-func (s *Server) handleCompletions(w http.ResponseWriter, r *http.Request) {
-	s.proxyEndpoint(w, r, func(body io.Reader) (model string, err error) {
-		var modelGet struct {
-			Model *string
-		}
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	ramaModels, err := s.catalog.Models()
+	if err != nil {
+		log.Printf("Failed to get models: %v\n", err)
+		writeError(w, r, errInternal("failed to list models"))
+		return
+	}
+
+	loaded := s.scheduler.Loaded()
 
-		err = json.NewDecoder(body).Decode(&modelGet)
+	models := ModelList{
+		Object: "list",
+		Data:   []Model{},
+	}
+	for _, ramaModel := range filterAllowedModels(r, ramaModels) {
+		model, err := s.openaiModel(ramaModel, loaded)
 		if err != nil {
+			log.Printf("Failed to convert model: %v\n", err)
+			writeError(w, r, errInternal("failed to convert model list"))
 			return
 		}
+		models.Data = append(models.Data, model)
+	}
 
-		if modelGet.Model == nil {
-			return "", fmt.Errorf("missing model key")
-		}
+	w.Header().Add("Content-Type", "application/json; charset=utf-8")
+	err = json.NewEncoder(w).Encode(models)
 
-		return *modelGet.Model, nil
-	})
+	if err != nil {
+		log.Printf("Failed to reply: %v\n", err)
+	}
 }
 
-func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
-	internalServerError := func(reason string) {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Internal Server Error: "))
-		w.Write([]byte(reason))
+func (s *Server) handleModel(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("model")
+
+	// also accept names mangled like in /upstream, since slashes are awkward in paths
+	if demangled, err := s.demangle(name); err == nil {
+		name = demangled
 	}
 
-	ramaModels, err := s.ramalama.GetModels()
+	if err := authorizeModel(r, name); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	ramaModel, ok, err := s.catalog.Find(name)
 	if err != nil {
-		log.Printf("Failed to get models: %v\n", ramaModels)
-		internalServerError("E_MODEL_GET")
+		log.Printf("Failed to get models: %v\n", err)
+		writeError(w, r, errInternal("failed to list models"))
 		return
 	}
 
-	models, err := convertModelList(ramaModels)
+	if !ok {
+		writeError(w, r, scheduler.ErrModelNotFound{Model: name})
+		return
+	}
+
+	model, err := s.openaiModel(ramaModel, s.scheduler.Loaded())
 	if err != nil {
-		log.Printf("Failed to convert models: %v\n", models)
-		internalServerError("E_MODEL_LIST_CONVERT")
+		log.Printf("Failed to convert model: %v\n", err)
+		writeError(w, r, errInternal("failed to convert model"))
 		return
 	}
 
 	w.Header().Add("Content-Type", "application/json; charset=utf-8")
-	err = json.NewEncoder(w).Encode(models)
+	err = json.NewEncoder(w).Encode(model)
 
 	if err != nil {
 		log.Printf("Failed to reply: %v\n", err)
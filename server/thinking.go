@@ -0,0 +1,79 @@
+package server
+
+import "strings"
+
+const (
+	thinkOpenTag  = "<think>"
+	thinkCloseTag = "</think>"
+)
+
+// thinkSplitter separates <think>...</think> sections from content that is received in pieces.
+// Tags may be split across pieces.
+type thinkSplitter struct {
+	thinking bool
+	pending  string // end of the previous piece, which may be the start of a tag
+}
+
+// Next returns the content and thinking text of the next piece.
+func (t *thinkSplitter) Next(piece string) (content, thinking string) {
+	text := t.pending + piece
+	t.pending = ""
+
+	var contentOut, thinkingOut strings.Builder
+	out := func() *strings.Builder {
+		if t.thinking {
+			return &thinkingOut
+		}
+		return &contentOut
+	}
+
+	for {
+		tag := thinkOpenTag
+		if t.thinking {
+			tag = thinkCloseTag
+		}
+
+		if i := strings.Index(text, tag); i >= 0 {
+			out().WriteString(text[:i])
+			text = text[i+len(tag):]
+			t.thinking = !t.thinking
+			continue
+		}
+
+		// hold back anything that could be the start of the tag
+		keep := partialSuffix(text, tag)
+		out().WriteString(text[:len(text)-keep])
+		t.pending = text[len(text)-keep:]
+		break
+	}
+
+	return contentOut.String(), thinkingOut.String()
+}
+
+// Flush returns the text held back by Next, once there are no more pieces.
+func (t *thinkSplitter) Flush() (content, thinking string) {
+	pending := t.pending
+	t.pending = ""
+	if t.thinking {
+		return "", pending
+	}
+	return pending, ""
+}
+
+// partialSuffix returns the length of the longest suffix of text that is a proper prefix of tag.
+func partialSuffix(text, tag string) int {
+	for n := min(len(tag)-1, len(text)); n > 0; n-- {
+		if strings.HasSuffix(text, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// splitThinking separates <think>...</think> sections from complete content.
+func splitThinking(text string) (content, thinking string) {
+	var splitter thinkSplitter
+	content, thinking = splitter.Next(text)
+	restContent, restThinking := splitter.Flush()
+	return content + restContent, thinking + restThinking
+}
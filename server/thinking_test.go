@@ -0,0 +1,36 @@
+package server
+
+import "testing"
+
+func TestThinkSplitter(t *testing.T) {
+	var splitter thinkSplitter
+	var content, thinking string
+	for _, piece := range []string{"<thi", "nk>Let me ", "think.</th", "ink>\n\nThe answer", " is <", "b>4</b>"} {
+		c, th := splitter.Next(piece)
+		content += c
+		thinking += th
+	}
+	c, th := splitter.Flush()
+	content += c
+	thinking += th
+
+	if thinking != "Let me think." {
+		t.Errorf("Unexpected thinking %q", thinking)
+	}
+
+	if content != "\n\nThe answer is <b>4</b>" {
+		t.Errorf("Unexpected content %q", content)
+	}
+}
+
+func TestSplitThinking(t *testing.T) {
+	content, thinking := splitThinking("no tags <thin")
+	if content != "no tags <thin" || thinking != "" {
+		t.Errorf("Unexpected split %q, %q", content, thinking)
+	}
+
+	content, thinking = splitThinking("<think>unfinished")
+	if content != "" || thinking != "unfinished" {
+		t.Errorf("Unexpected split %q, %q", content, thinking)
+	}
+}
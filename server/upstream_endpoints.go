@@ -2,24 +2,31 @@ package server
 
 import (
 	"fmt"
-	"html"
 	"log"
 	"net/http"
+
+	"github.com/wk-y/rama-swap/server/scheduler"
 )
 
 func (s *Server) serveUpstream(w http.ResponseWriter, r *http.Request) {
 	name, err := s.demangle(r.PathValue("model"))
 	if err != nil {
 		log.Printf("Demangling model name failed: %v\n", err)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("invalid model name"))
+		writeError(w, r, err)
+		return
+	}
+
+	if err := authorizeModel(r, name); err != nil {
+		writeError(w, r, err)
 		return
 	}
 
+	requestUsageOf(r).SetModel(name)
+
 	backend, err := s.scheduler.Lock(r.Context(), name)
 	if err != nil {
 		log.Println(err)
-		w.Write([]byte(fmt.Sprint(err)))
+		writeError(w, r, err)
 		return
 	}
 	defer s.scheduler.Unlock(backend)
@@ -27,25 +34,7 @@ func (s *Server) serveUpstream(w http.ResponseWriter, r *http.Request) {
 	<-backend.Ready
 
 	r.URL.Path = "/" + r.PathValue("rest")
-	backend.Proxy().ServeHTTP(w, r)
-}
-
-func (s *Server) serveUpstreamSelect(w http.ResponseWriter, r *http.Request) {
-	models, err := s.ramalama.GetModels()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	w.Write([]byte("<html><body>"))
-	w.Write([]byte("<p>Models:</p>"))
-	// write the list of models
-	w.Write([]byte("<ul>"))
-	for _, model := range models {
-		fmt.Fprintf(w, `<li><a href="/upstream/%s">%s</a></li>`, html.EscapeString(s.ModelNameMangler(model.Name)), html.EscapeString(model.Name))
-	}
-	w.Write([]byte("</ul>"))
-	w.Write([]byte("</html></body>"))
+	configureProxy(backend.Proxy(), r).ServeHTTP(w, r)
 }
 
 func (s *Server) demangle(name string) (string, error) {
@@ -61,7 +50,7 @@ func (s *Server) demangle(name string) (string, error) {
 		return cached, nil
 	}
 
-	models, err := s.ramalama.GetModels()
+	models, err := s.catalog.Models()
 	if err != nil {
 		return "", fmt.Errorf("failed to get models: %v", err)
 	}
@@ -78,5 +67,5 @@ func (s *Server) demangle(name string) (string, error) {
 		return demangled, nil
 	}
 
-	return "", fmt.Errorf("model not found")
+	return "", scheduler.ErrModelNotFound{Model: name}
 }
@@ -0,0 +1,301 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wk-y/rama-swap/internal/util"
+	"github.com/wk-y/rama-swap/server/scheduler"
+)
+
+// requestUsage collects accounting information about a request while it is handled.
+type requestUsage struct {
+	lock             sync.Mutex
+	pending          sync.WaitGroup // response bodies still being scanned for usage
+	model            string
+	promptTokens     int64
+	completionTokens int64
+
+	// hideStreamUsage is set when the usage chunk of a streamed response was only requested for accounting
+	hideStreamUsage bool
+
+	// LockStats is filled in by the scheduler when the request locks a model.
+	LockStats scheduler.LockStats
+}
+
+// requestUsageOf returns the usage tracker attached to r.
+// If there is none, a tracker that is not read by anything is returned.
+func requestUsageOf(r *http.Request) *requestUsage {
+	usage, ok := r.Context().Value(usageContextKey).(*requestUsage)
+	if !ok {
+		return &requestUsage{}
+	}
+	return usage
+}
+
+// trackUsage attaches a usage tracker to each request.
+// Every request is counted in the server's metrics,
+// and requests that used a model are recorded to the usage ledger, if there is one.
+func (s *Server) trackUsage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		usage := &requestUsage{}
+		ctx := context.WithValue(r.Context(), usageContextKey, usage)
+		ctx = scheduler.WithLockStats(ctx, &usage.LockStats)
+		r = r.WithContext(ctx)
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		prompt, completion := usage.Tokens()
+		s.metrics.record(clientIdentity(r), recorder.status, prompt, completion)
+
+		model := usage.Model()
+		if s.UsageLedger == nil || model == "" {
+			return
+		}
+
+		err := s.UsageLedger.Record(UsageRecord{
+			Time:             start.UTC(),
+			Client:           clientIdentity(r),
+			Model:            model,
+			Endpoint:         r.URL.Path,
+			Status:           recorder.status,
+			PromptTokens:     prompt,
+			CompletionTokens: completion,
+			QueueWait:        usage.LockStats.QueueWait,
+			LoadDuration:     usage.LockStats.LoadDuration,
+			TotalDuration:    time.Since(start),
+		})
+		if err != nil {
+			log.Printf("Failed to record usage: %v\n", err)
+		}
+	})
+}
+
+// SetModel records the model used by the request.
+func (u *requestUsage) SetModel(model string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.model = model
+}
+
+func (u *requestUsage) Model() string {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return u.model
+}
+
+func (u *requestUsage) AddTokens(prompt, completion int64) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.promptTokens += prompt
+	u.completionTokens += completion
+}
+
+// Tokens returns the number of tokens used by the request.
+// It must only be called after the request has been handled.
+func (u *requestUsage) Tokens() (prompt, completion int64) {
+	u.pending.Wait()
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return u.promptTokens, u.completionTokens
+}
+
+// oaiUsage is the usage block of an OpenAI-compatible response.
+type oaiUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+}
+
+// streamUsagePaths are the endpoints whose streamed responses only report usage when asked to.
+var streamUsagePaths = []string{"/v1/chat/completions", "/v1/completions"}
+
+// requestStreamUsage makes a streaming request to one of streamUsagePaths ask for usage,
+// so that tokens are counted even when the client didn't ask for them.
+// The usage chunk is then hidden from the client by trackResponseUsage.
+func requestStreamUsage(r *http.Request, usage *requestUsage) error {
+	if r.Body == nil || !slices.Contains(streamUsagePaths, r.URL.Path) {
+		return nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return nil // not JSON, so leave it for the backend to reject
+	}
+
+	var stream bool
+	if json.Unmarshal(fields["stream"], &stream); !stream {
+		return nil
+	}
+
+	var options map[string]json.RawMessage
+	if raw, ok := fields["stream_options"]; ok {
+		if json.Unmarshal(raw, &options) != nil {
+			return nil
+		}
+	}
+
+	var includeUsage bool
+	if json.Unmarshal(options["include_usage"], &includeUsage); includeUsage {
+		return nil
+	}
+
+	if options == nil {
+		options = map[string]json.RawMessage{}
+	}
+	options["include_usage"] = json.RawMessage("true")
+	if fields["stream_options"], err = json.Marshal(options); err != nil {
+		return err
+	}
+
+	if body, err = json.Marshal(fields); err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Del("Content-Length")
+
+	usage.hideStreamUsage = true
+	return nil
+}
+
+// trackResponseUsage wraps the body of an OpenAI-compatible backend response
+// so that the usage block is recorded in usage as the body is read.
+func trackResponseUsage(resp *http.Response, usage *requestUsage) {
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		trackStreamUsage(resp, usage)
+		return
+	}
+
+	body := resp.Body
+	pr, pw := io.Pipe()
+	resp.Body = util.ReadCloserWrapper{
+		Reader: io.TeeReader(body, pw),
+		Closer: func() error {
+			pw.Close()
+			return body.Close()
+		},
+	}
+
+	usage.pending.Add(1)
+	go func() {
+		defer usage.pending.Done()
+		defer io.Copy(io.Discard, pr) // never block the proxied body
+
+		var response struct {
+			Usage *oaiUsage `json:"usage"`
+		}
+		if json.NewDecoder(pr).Decode(&response) == nil && response.Usage != nil {
+			usage.AddTokens(response.Usage.PromptTokens, response.Usage.CompletionTokens)
+		}
+	}()
+}
+
+// trackStreamUsage is trackResponseUsage for server-sent event streams.
+// Backends may report running totals in several chunks, so only the last usage block is recorded.
+func trackStreamUsage(resp *http.Response, usage *requestUsage) {
+	body := resp.Body
+	pr, pw := io.Pipe()
+	resp.Body = util.ReadCloserWrapper{
+		Reader: pr,
+		Closer: func() error {
+			pr.Close()
+			return body.Close()
+		},
+	}
+
+	usage.pending.Add(1)
+	go func() {
+		defer usage.pending.Done()
+
+		var last *oaiUsage
+		defer func() {
+			if last != nil {
+				usage.AddTokens(last.PromptTokens, last.CompletionTokens)
+			}
+		}()
+
+		reader := bufio.NewReader(body)
+		skipBlank := false // drops the blank line ending a hidden event
+		for {
+			line, err := reader.ReadBytes('\n')
+
+			chunkUsage, usageOnly := parseChunkUsage(line)
+			if chunkUsage != nil {
+				last = chunkUsage
+			}
+
+			switch {
+			case usageOnly && usage.hideStreamUsage:
+				skipBlank = true
+			case skipBlank && len(bytes.TrimSpace(line)) == 0:
+				skipBlank = false
+			default:
+				skipBlank = false
+				if _, err := pw.Write(line); err != nil {
+					return // the proxied body was closed
+				}
+			}
+
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+}
+
+// parseChunkUsage returns the usage block of an SSE data line, if there is one,
+// and whether the chunk holds nothing else.
+func parseChunkUsage(line []byte) (usage *oaiUsage, usageOnly bool) {
+	data, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok || !bytes.Contains(data, []byte(`"usage"`)) {
+		return nil, false
+	}
+
+	var chunk struct {
+		Usage   *oaiUsage         `json:"usage"`
+		Choices []json.RawMessage `json:"choices"`
+	}
+	if json.Unmarshal(data, &chunk) != nil || chunk.Usage == nil {
+		return nil, false
+	}
+	return chunk.Usage, len(chunk.Choices) == 0
+}
+
+// statusRecorder records the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap allows http.ResponseController to access the underlying ResponseWriter.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestStreamUsage(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		path   string
+		body   string
+		forced bool
+	}{
+		{"not streaming", "/v1/chat/completions", `{"model":"m"}`, false},
+		{"streaming", "/v1/chat/completions", `{"model":"m","stream":true}`, true},
+		{"other options", "/v1/completions", `{"stream":true,"stream_options":{"include_obfuscation":false}}`, true},
+		{"already included", "/v1/chat/completions", `{"stream":true,"stream_options":{"include_usage":true}}`, false},
+		{"other endpoint", "/v1/embeddings", `{"stream":true}`, false},
+		{"invalid", "/v1/chat/completions", `{"stream":`, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			usage := &requestUsage{}
+			if err := requestStreamUsage(r, usage); err != nil {
+				t.Fatal(err)
+			}
+
+			if usage.hideStreamUsage != tc.forced {
+				t.Errorf("Expected hideStreamUsage to be %v", tc.forced)
+			}
+
+			body, _ := io.ReadAll(r.Body)
+			if !tc.forced {
+				if string(body) != tc.body {
+					t.Errorf("Expected the body to be unchanged, got %s", body)
+				}
+				return
+			}
+
+			if r.ContentLength != int64(len(body)) {
+				t.Errorf("Content length %d doesn't match the body length %d", r.ContentLength, len(body))
+			}
+
+			var request struct {
+				StreamOptions map[string]any `json:"stream_options"`
+			}
+			if err := json.Unmarshal(body, &request); err != nil || request.StreamOptions["include_usage"] != true {
+				t.Errorf("Expected include_usage to be set, got %s", body)
+			}
+		})
+	}
+}
+
+func TestTrackStreamUsage(t *testing.T) {
+	const stream = "data: {\"choices\":[{\"delta\":{\"content\":\"a\"}}],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":1}}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"b\"}}],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":2}}\n\n" +
+		"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":3}}\n\n" +
+		"data: [DONE]\n\n"
+
+	for _, hide := range []bool{false, true} {
+		resp := &http.Response{
+			Header: http.Header{"Content-Type": {"text/event-stream"}},
+			Body:   io.NopCloser(strings.NewReader(stream)),
+		}
+		usage := &requestUsage{hideStreamUsage: hide}
+		trackResponseUsage(resp, usage)
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		// running totals are not added up
+		if prompt, completion := usage.Tokens(); prompt != 10 || completion != 3 {
+			t.Errorf("Expected the last usage to be recorded, got %d and %d tokens", prompt, completion)
+		}
+
+		want := stream
+		if hide {
+			want = strings.Replace(stream, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":3}}\n\n", "", 1)
+		}
+		if string(body) != want {
+			t.Errorf("Expected body %q, got %q", want, body)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// tlsReloader provides TLS configuration from certificate files,
+// reloading them whenever their modification times change.
+type tlsReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string // optional, enables mutual TLS
+
+	lock      sync.Mutex
+	modTimes  [3]time.Time
+	config    *tls.Config
+	checkedAt time.Time
+}
+
+// tlsCheckInterval is the minimum time between checks for changed certificate files.
+const tlsCheckInterval = 5 * time.Second
+
+func newTLSReloader(certFile, keyFile, clientCAFile string) (*tlsReloader, error) {
+	t := &tlsReloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+	}
+
+	if err := t.reload(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// reload loads the certificate files if they have changed since they were last loaded.
+// t.lock must be held, unless t is being constructed.
+func (t *tlsReloader) reload() error {
+	files := [3]string{t.certFile, t.keyFile, t.clientCAFile}
+
+	var modTimes [3]time.Time
+	for i, file := range files {
+		if file == "" {
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[i] = info.ModTime()
+	}
+
+	if t.config != nil && modTimes == t.modTimes {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(t.certFile, t.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %v", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if t.clientCAFile != "" {
+		pem, err := os.ReadFile(t.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in client CA file")
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if t.config != nil {
+		log.Println("Reloaded TLS certificates")
+	}
+
+	t.config = config
+	t.modTimes = modTimes
+	return nil
+}
+
+// Config returns a tls.Config that uses the latest certificate files for each connection.
+func (t *tlsReloader) Config() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+
+			if time.Since(t.checkedAt) >= tlsCheckInterval {
+				t.checkedAt = time.Now()
+				if err := t.reload(); err != nil {
+					// keep serving the previous certificates until the files are fixed
+					log.Printf("Failed to reload TLS certificates: %v\n", err)
+				}
+			}
+
+			return t.config, nil
+		},
+	}
+}
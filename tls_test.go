@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCert writes a new self-signed certificate for commonName and its key to certFile and keyFile.
+// Their modification times are set to modified, so that rewrites are noticed however quickly they happen.
+func writeCert(t *testing.T, certFile, keyFile, commonName string, modified time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), modified)
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), modified)
+}
+
+func writeFile(t *testing.T, path string, data []byte, modified time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// servedName returns the common name of the certificate the reloader serves to a new connection.
+func servedName(t *testing.T, reloader *tlsReloader) string {
+	t.Helper()
+
+	// skip the wait between checks
+	reloader.lock.Lock()
+	reloader.checkedAt = time.Time{}
+	reloader.lock.Unlock()
+
+	config, err := reloader.Config().GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Subject.CommonName
+}
+
+func TestTLSReloaderRotation(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Hour)
+
+	writeCert(t, certFile, keyFile, "first", start)
+
+	reloader, err := newTLSReloader(certFile, keyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := servedName(t, reloader); name != "first" {
+		t.Errorf("Expected the first certificate, got %q", name)
+	}
+
+	writeCert(t, certFile, keyFile, "second", start.Add(time.Minute))
+	if name := servedName(t, reloader); name != "second" {
+		t.Errorf("Expected the rotated certificate, got %q", name)
+	}
+
+	// a key that doesn't match the certificate keeps the previous pair in use
+	otherDir := t.TempDir()
+	writeCert(t, filepath.Join(otherDir, "cert.pem"), keyFile, "unused", start.Add(2*time.Minute))
+	if name := servedName(t, reloader); name != "second" {
+		t.Errorf("Expected a broken pair to keep the previous certificate, got %q", name)
+	}
+
+	// as does a missing file
+	if err := os.Remove(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if name := servedName(t, reloader); name != "second" {
+		t.Errorf("Expected a missing key to keep the previous certificate, got %q", name)
+	}
+
+	// once the pair is fixed it is used
+	writeCert(t, certFile, keyFile, "third", start.Add(3*time.Minute))
+	if name := servedName(t, reloader); name != "third" {
+		t.Errorf("Expected the fixed certificate, got %q", name)
+	}
+}
+
+func TestTLSReloaderClientCA(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	caFile := filepath.Join(dir, "ca.pem")
+	start := time.Now().Add(-time.Hour)
+
+	writeCert(t, certFile, keyFile, "server", start)
+	writeCert(t, caFile, filepath.Join(dir, "ca-key.pem"), "client CA", start)
+
+	reloader, err := newTLSReloader(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := reloader.Config().GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientAuth != tls.RequireAndVerifyClientCert || config.ClientCAs == nil {
+		t.Errorf("Expected client certificates to be required, got %v", config.ClientAuth)
+	}
+
+	// a client CA file without certificates is rejected, keeping the previous one
+	writeFile(t, caFile, []byte("not a certificate"), start.Add(time.Minute))
+	reloader.lock.Lock()
+	err = reloader.reload()
+	reloader.lock.Unlock()
+	if err == nil || !strings.Contains(err.Error(), "no certificates found") {
+		t.Errorf("Expected an error for an empty client CA file, got %v", err)
+	}
+	if config, _ := reloader.Config().GetConfigForClient(&tls.ClientHelloInfo{}); config.ClientCAs == nil {
+		t.Error("Expected the previous client CA to stay in use")
+	}
+}
+
+func TestNewTLSReloaderErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, "server", time.Now())
+
+	emptyCA := filepath.Join(dir, "empty.pem")
+	writeFile(t, emptyCA, nil, time.Now())
+
+	for _, tc := range []struct {
+		name                  string
+		certFile, keyFile, ca string
+		wantError             string
+	}{
+		{name: "missing certificate", certFile: filepath.Join(dir, "missing.pem"), keyFile: keyFile, wantError: "no such file"},
+		{name: "mismatched pair", certFile: keyFile, keyFile: keyFile, wantError: "failed to load certificate"},
+		{name: "missing client CA", certFile: certFile, keyFile: keyFile, ca: filepath.Join(dir, "missing.pem"), wantError: "no such file"},
+		{name: "empty client CA", certFile: certFile, keyFile: keyFile, ca: emptyCA, wantError: "no certificates found"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newTLSReloader(tc.certFile, tc.keyFile, tc.ca)
+			if err == nil || !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Expected an error containing %q, got %v", tc.wantError, err)
+			}
+		})
+	}
+}